@@ -0,0 +1,22 @@
+package main
+
+import (
+	"embed"
+
+	"landing/assets"
+)
+
+// Chart.js is vendored so the charts work without internet access. The
+// download is checked against the upstream hash in static/SHA256SUMS,
+// the same one ntp-landing records.
+//go:generate sh -c "cd static && curl -fsSL -o chart.umd.min.js.new https://cdn.jsdelivr.net/npm/chart.js@4.4.1/dist/chart.umd.min.js && sed 's/ chart.umd.min.js/ chart.umd.min.js.new/' SHA256SUMS | sha256sum -c - && mv chart.umd.min.js.new chart.umd.min.js || { rm -f chart.umd.min.js.new; exit 1; }"
+
+//go:embed static
+var staticFS embed.FS
+
+// vendoredAssets must be embedded with the checksum recorded in
+// static/SHA256SUMS; serve refuses to start otherwise
+var vendoredAssets = []string{"chart.umd.min.js"}
+
+// siteAssets serves static/ under /static/ with content-hashed links
+var siteAssets = assets.Must(staticFS, "static")
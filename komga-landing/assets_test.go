@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPageUsesLocalAssets keeps CDN scripts and stylesheets out of the
+// page, which the CSP would block anyway. Plain links (to Komga itself)
+// are fine.
+func TestPageUsesLocalAssets(t *testing.T) {
+	for _, bad := range []string{`src="http`, `src="//`, `stylesheet" href="http`, `stylesheet" href="//`, "<style>", "<script>"} {
+		if strings.Contains(htmlTemplate, bad) {
+			t.Errorf("page contains %q", bad)
+		}
+	}
+	for _, name := range []string{"komga.js", "komga.css"} {
+		if !siteAssets.Has(name) {
+			t.Errorf("static/%s not embedded", name)
+		}
+	}
+}
+
+// TestVendoredAssets fails a checkout that would refuse to start: the
+// vendored files must be committed with their recorded checksums
+func TestVendoredAssets(t *testing.T) {
+	if err := siteAssets.Verify(vendoredAssets); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"landing/auth"
+)
+
+// newIdentifier returns who is behind a request for the configured
+// KOMGA_LANDING_AUTH_MODE: basic (KOMGA_LANDING_AUTH_USERS_FILE of
+// user:hash lines, SHA-256 or PBKDF2), header
+// (KOMGA_LANDING_AUTH_USER_HEADER from KOMGA_LANDING_AUTH_TRUSTED_PROXIES)
+// or tailscale (LocalAPI whois, cached for a minute). none gives nil and
+// everyone is anonymous.
+func newIdentifier(mode string) (auth.Identifier, error) {
+	switch mode {
+	case "none":
+		return nil, nil
+	case "basic":
+		return auth.LoadCredentialsFile(envOr("KOMGA_LANDING_AUTH_USERS_FILE", "/etc/komga-landing/users"))
+	case "header":
+		var list []string
+		for _, s := range strings.Split(envOr("KOMGA_LANDING_AUTH_TRUSTED_PROXIES", "127.0.0.1/32,::1/128"), ",") {
+			list = append(list, strings.TrimSpace(s))
+		}
+		trusted, err := auth.ParsePrefixes(list)
+		if err != nil {
+			return nil, err
+		}
+		return &auth.HeaderIdentity{Header: envOr("KOMGA_LANDING_AUTH_USER_HEADER", "Tailscale-User-Login"), Trusted: trusted}, nil
+	case "tailscale":
+		return auth.NewTailscaleWhois(envOr("KOMGA_LANDING_TAILSCALE_SOCKET", "/var/run/tailscale/tailscaled.sock"), time.Minute), nil
+	}
+	return nil, fmt.Errorf("unknown KOMGA_LANDING_AUTH_MODE %q (none, basic, header or tailscale)", mode)
+}
+
+// withAuth lets viewers through. A viewer is any authenticated user, or
+// only those in KOMGA_LANDING_AUTH_VIEWERS when set; anonymous callers are
+// viewers unless KOMGA_LANDING_AUTH_ANONYMOUS is "none". There are no
+// admin actions here, so there is no admin role. Static files, the stats
+// API and /metrics stay open for probes and scrapes.
+func withAuth(id auth.Identifier, next http.Handler) http.Handler {
+	viewers := map[string]bool{}
+	for _, u := range strings.Split(os.Getenv("KOMGA_LANDING_AUTH_VIEWERS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			viewers[u] = true
+		}
+	}
+	anonymous := envOr("KOMGA_LANDING_AUTH_ANONYMOUS", "viewer") == "viewer"
+	_, basic := id.(*auth.BasicCredentials)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") || openPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var user string
+		var err error
+		if id != nil {
+			user, err = id.Identify(r)
+		}
+		if err == nil && (user == "" && anonymous || user != "" && (len(viewers) == 0 || viewers[user])) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if errors.Is(err, auth.ErrBadCredentials) {
+			slog.Warn("bad credentials", "component", "auth", "user", user, "remote", r.RemoteAddr)
+		}
+		if basic && (err != nil || user == "") {
+			w.Header().Set("WWW-Authenticate", `Basic realm="komga-landing", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
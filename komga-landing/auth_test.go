@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"landing/auth"
+	"landing/auth/authtest"
+)
+
+func TestWithAuthBasic(t *testing.T) {
+	sum := sha256.Sum256([]byte("b"))
+	path := filepath.Join(t.TempDir(), "users")
+	os.WriteFile(path, []byte("# komga viewers\nalice:"+authtest.PBKDF2Entry(t, "a")+"\nbob:sha256:"+hex.EncodeToString(sum[:])+"\neve:"+authtest.PBKDF2Entry(t, "e")+"\n"), 0o600)
+	t.Setenv("KOMGA_LANDING_AUTH_USERS_FILE", path)
+	t.Setenv("KOMGA_LANDING_AUTH_VIEWERS", "alice, bob")
+	t.Setenv("KOMGA_LANDING_AUTH_ANONYMOUS", "none")
+	id, err := newIdentifier("basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withAuth(id, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, c := range []struct {
+		path, user, pass string
+		want             int
+	}{
+		{"/", "", "", 401},
+		{"/metrics", "", "", 200},
+		{"/api/v1/stats", "", "", 200},
+		{"/static/komga.css", "mallory", "x", 200},
+		{"/", "alice", "a", 200}, // PBKDF2
+		{"/", "alice", "a", 200}, // from the verified cache
+		{"/", "bob", "b", 200},   // legacy SHA-256
+		{"/api/v1/logs", "bob", "wrong", 401},
+		{"/", "eve", "e", 403}, // authenticated but not a listed viewer
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.user != "" {
+			req.SetBasicAuth(c.user, c.pass)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s as %q: code %d, want %d", c.path, c.user, rec.Code, c.want)
+		}
+		if rec.Code == 401 && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s as %q: 401 without a challenge", c.path, c.user)
+		}
+	}
+}
+
+func TestWithAuthHeader(t *testing.T) {
+	t.Setenv("KOMGA_LANDING_AUTH_TRUSTED_PROXIES", "127.0.0.1, fd00::/8")
+	t.Setenv("KOMGA_LANDING_AUTH_VIEWERS", "alice@github")
+	t.Setenv("KOMGA_LANDING_AUTH_ANONYMOUS", "viewer")
+	id, err := newIdentifier("header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withAuth(id, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, c := range []struct {
+		remote, user string
+		want         int
+	}{
+		{"127.0.0.1:5000", "alice@github", 200},
+		{"[fd00::5]:5000", "bob@github", 403},
+		{"127.0.0.1:5000", "", 200},              // anonymous viewer
+		{"172.16.16.50:5000", "bob@github", 200}, // header from an untrusted client is ignored
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		if c.user != "" {
+			req.Header.Set("Tailscale-User-Login", c.user)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s as %q: code %d, want %d", c.remote, c.user, rec.Code, c.want)
+		}
+	}
+}
+
+func TestNewIdentifier(t *testing.T) {
+	if id, err := newIdentifier("none"); id != nil || err != nil {
+		t.Errorf("none: %v %v", id, err)
+	}
+	if id, err := newIdentifier("tailscale"); err != nil {
+		t.Errorf("tailscale: %v", err)
+	} else if _, ok := id.(*auth.TailscaleWhois); !ok {
+		t.Errorf("tailscale: %T", id)
+	}
+	t.Setenv("KOMGA_LANDING_AUTH_USERS_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("KOMGA_LANDING_AUTH_TRUSTED_PROXIES", "not-an-ip")
+	for _, mode := range []string{"basic", "header", "kerberos"} {
+		if _, err := newIdentifier(mode); err == nil {
+			t.Errorf("%s accepted", mode)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+module komga-landing
+
+go 1.25.6
+
+require landing v0.0.0-00010101000000-000000000000
+
+replace landing => ../landing
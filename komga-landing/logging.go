@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"landing/logging"
+)
+
+// setupLogging installs the default slog logger from the
+// KOMGA_LANDING_LOG_*, _SYSLOG_* and _LOKI_* variables, the same sinks
+// ntp-landing has. The returned func flushes and closes them.
+func setupLogging() func() {
+	return logging.Setup(logging.Options{
+		App:            "komga-landing",
+		Level:          envOr("KOMGA_LANDING_LOG_LEVEL", "info"),
+		Format:         envOr("KOMGA_LANDING_LOG_FORMAT", "text"),
+		SyslogAddr:     os.Getenv("KOMGA_LANDING_SYSLOG_ADDR"),
+		SyslogFacility: envOr("KOMGA_LANDING_SYSLOG_FACILITY", "daemon"),
+		LokiURL:        os.Getenv("KOMGA_LANDING_LOKI_URL"),
+		LokiTenant:     os.Getenv("KOMGA_LANDING_LOKI_TENANT"),
+	})
+}
+
+// probePaths are scraped every few seconds and would drown the log at
+// info level
+var probePaths = map[string]bool{"/metrics": true}
+
+// logRequests logs every request with its outcome, scrapes at debug level
+func logRequests(next http.Handler) http.Handler {
+	return logging.Requests(probePaths, next)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"landing/loki"
+)
+
+// logsHandler serves /api/v1/logs from Loki. since and limit bound the
+// query; an invalid since is rejected rather than silently replaced.
+func logsHandler(q *loki.Querier, query string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if q == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(APIError{Error: "loki not configured"})
+			return
+		}
+		since := 24 * time.Hour
+		if v := r.URL.Query().Get("since"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(APIError{Error: "since: invalid duration"})
+				return
+			}
+			since = d
+		}
+		limit := 50
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+		start := time.Now()
+		resp, err := q.Recent(r.Context(), query, since, r.URL.Query().Get("level"), limit, start)
+		selfMetrics.upstream("loki", start, err)
+		if err != nil {
+			slog.Warn("loki query failed", "component", "logs", "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
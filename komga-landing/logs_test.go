@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"landing/loki"
+)
+
+func TestLogsHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer srv.Close()
+	h := logsHandler(loki.NewQuerier(srv.URL, "", time.Second), `{container="komga"}`)
+
+	for _, tc := range []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"?since=1h&limit=10", http.StatusOK},
+		{"?since=yesterday", http.StatusBadRequest},
+		{"?since=-1h", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/api/v1/logs"+tc.query, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%q: status %d, want %d", tc.query, rec.Code, tc.status)
+			continue
+		}
+		if tc.status == http.StatusBadRequest {
+			var e APIError
+			if err := json.NewDecoder(rec.Body).Decode(&e); err != nil || e.Error != "since: invalid duration" {
+				t.Errorf("%q: error body %+v (%v)", tc.query, e, err)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	logsHandler(nil, "")(rec, httptest.NewRequest("GET", "/api/v1/logs", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without loki: status %d", rec.Code)
+	}
+}
@@ -1,16 +1,34 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
+	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"landing/api"
+	"landing/listen"
+	"landing/loki"
+	"landing/security"
+	"landing/textview"
 )
 
 type SystemStats struct {
@@ -29,9 +47,12 @@ type SystemStats struct {
 }
 
 type KomgaStats struct {
-	Libraries int
-	Series    int
-	Books     int
+	Libraries       int
+	Series          int
+	Books           int
+	ContainerState  string
+	ContainerHealth string
+	Error           string `json:",omitempty"`
 }
 
 type HistoricalPoint struct {
@@ -42,12 +63,91 @@ type HistoricalPoint struct {
 type PageData struct {
 	System     SystemStats
 	Komga      KomgaStats
+	Network    NetworkInfo
 	CPUHistory []HistoricalPoint
 	MemHistory []HistoricalPoint
+	Logs       bool
 	Updated    string
 }
 
-func getSystemStats() SystemStats {
+// StatsV1 is GET /api/v1/stats, documented in openapi.json. The v1 types
+// mirror the page structs with camelCase names; the deprecated /api/stats
+// keeps emitting the page structs' Go field names for older clients.
+type StatsV1 struct {
+	System  SystemV1  `json:"system"`
+	Komga   KomgaV1   `json:"komga"`
+	Network NetworkV1 `json:"network"`
+}
+
+type SystemV1 struct {
+	Hostname    string  `json:"hostname"`
+	Uptime      string  `json:"uptime"`
+	CPUPercent  float64 `json:"cpuPercent"`
+	MemUsed     uint64  `json:"memUsed"`
+	MemTotal    uint64  `json:"memTotal"`
+	MemPercent  float64 `json:"memPercent"`
+	DiskUsed    uint64  `json:"diskUsed"`
+	DiskTotal   uint64  `json:"diskTotal"`
+	DiskPercent float64 `json:"diskPercent"`
+	LoadAvg     string  `json:"loadAvg"`
+	OS          string  `json:"os"`
+	Kernel      string  `json:"kernel"`
+}
+
+type KomgaV1 struct {
+	Libraries       int    `json:"libraries"`
+	Series          int    `json:"series"`
+	Books           int    `json:"books"`
+	ContainerState  string `json:"containerState"`
+	ContainerHealth string `json:"containerHealth"`
+	Error           string `json:"error,omitempty"`
+}
+
+type NetworkV1 struct {
+	Listeners []string    `json:"listeners"`
+	IPv4      []string    `json:"ipv4"`
+	IPv6      []NetAddrV1 `json:"ipv6"`
+	Routes    []string    `json:"routes"`
+	DNSName   string      `json:"dnsName"`
+	AAAA      []string    `json:"aaaa"`
+	AAAAMatch bool        `json:"aaaaMatch"`
+	DNSError  string      `json:"dnsError,omitempty"`
+}
+
+type NetAddrV1 struct {
+	Address string `json:"address"`
+	Kind    string `json:"kind"` // eui64, stable or temporary
+}
+
+// APIError is the body of every JSON error response
+type APIError struct {
+	Error string `json:"error"`
+}
+
+func statsV1(sys SystemStats, k KomgaStats, n NetworkInfo) StatsV1 {
+	nonNil := func(s []string) []string {
+		if s == nil {
+			return []string{}
+		}
+		return s
+	}
+	net := NetworkV1{
+		Listeners: nonNil(n.Listeners),
+		IPv4:      nonNil(n.IPv4),
+		IPv6:      []NetAddrV1{},
+		Routes:    nonNil(n.Routes),
+		DNSName:   n.DNSName,
+		AAAA:      nonNil(n.AAAA),
+		AAAAMatch: n.AAAAMatch,
+		DNSError:  n.DNSError,
+	}
+	for _, a := range n.IPv6 {
+		net.IPv6 = append(net.IPv6, NetAddrV1(a))
+	}
+	return StatsV1{System: SystemV1(sys), Komga: KomgaV1(k), Network: net}
+}
+
+func getSystemStats(ctx context.Context) SystemStats {
 	stats := SystemStats{}
 
 	hostname, _ := os.Hostname()
@@ -62,7 +162,7 @@ func getSystemStats() SystemStats {
 		stats.Uptime = fmt.Sprintf("%dd %dh %dm", days, hours, mins)
 	}
 
-	cmd := exec.Command("sh", "-c", "grep 'cpu ' /proc/stat | awk '{usage=($2+$4)*100/($2+$4+$5)} END {print usage}'")
+	cmd := exec.CommandContext(ctx, "sh", "-c", "grep 'cpu ' /proc/stat | awk '{usage=($2+$4)*100/($2+$4+$5)} END {print usage}'")
 	out, _ := cmd.Output()
 	stats.CPUPercent, _ = strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
 
@@ -82,7 +182,7 @@ func getSystemStats() SystemStats {
 		stats.MemPercent = float64(memTotal-memAvail) / float64(memTotal) * 100
 	}
 
-	cmd = exec.Command("df", "-B1", "/")
+	cmd = exec.CommandContext(ctx, "df", "-B1", "/")
 	out, _ = cmd.Output()
 	lines = strings.Split(string(out), "\n")
 	if len(lines) > 1 {
@@ -109,21 +209,89 @@ func getSystemStats() SystemStats {
 		}
 	}
 
-	cmd = exec.Command("uname", "-r")
+	cmd = exec.CommandContext(ctx, "uname", "-r")
 	out, _ = cmd.Output()
 	stats.Kernel = strings.TrimSpace(string(out))
 
 	return stats
 }
 
-func getKomgaStats() KomgaStats {
+// envOr returns the environment variable or def when it is unset or empty
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func getKomgaStats(ctx context.Context) KomgaStats {
 	stats := KomgaStats{}
-	cmd := exec.Command("docker", "exec", "komga", "ls", "-la", "/config")
-	cmd.Output()
+
+	start := time.Now()
+	out, err := exec.CommandContext(ctx, "docker", "inspect", "--format",
+		"{{.State.Status}} {{if .State.Health}}{{.State.Health.Status}}{{end}}",
+		envOr("KOMGA_LANDING_CONTAINER", "komga")).Output()
+	selfMetrics.upstream("docker", start, err)
+	if err == nil {
+		fields := strings.Fields(string(out))
+		if len(fields) > 0 {
+			stats.ContainerState = fields[0]
+		}
+		if len(fields) > 1 {
+			stats.ContainerHealth = fields[1]
+		}
+	} else {
+		stats.ContainerState = "unknown"
+	}
+
+	base := strings.TrimRight(envOr("KOMGA_LANDING_KOMGA_URL", "http://localhost:25600"), "/")
+	var libraries []json.RawMessage
+	if err := komgaGet(ctx, base+"/api/v1/libraries", &libraries); err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+	stats.Libraries = len(libraries)
+
+	// Paged endpoints report the total, so one element per request is enough
+	var page struct {
+		TotalElements int `json:"totalElements"`
+	}
+	if err := komgaGet(ctx, base+"/api/v1/series?size=1", &page); err == nil {
+		stats.Series = page.TotalElements
+	}
+	if err := komgaGet(ctx, base+"/api/v1/books?size=1", &page); err == nil {
+		stats.Books = page.TotalElements
+	}
 	return stats
 }
 
-func getHistoricalData(query string) []HistoricalPoint {
+// komgaGet calls the Komga REST API with an API key (KOMGA_LANDING_KOMGA_API_KEY)
+// or basic credentials (KOMGA_LANDING_KOMGA_USER / _PASSWORD)
+func komgaGet(ctx context.Context, url string, v interface{}) (err error) {
+	defer func(start time.Time) { selfMetrics.upstream("komga", start, err) }(time.Now())
+	client := &http.Client{Timeout: 5 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if key := os.Getenv("KOMGA_LANDING_KOMGA_API_KEY"); key != "" {
+		req.Header.Set("X-API-Key", key)
+	} else if user := os.Getenv("KOMGA_LANDING_KOMGA_USER"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("KOMGA_LANDING_KOMGA_PASSWORD"))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("komga %s: %s", req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func getHistoricalData(ctx context.Context, query string) []HistoricalPoint {
 	points := []HistoricalPoint{}
 
 	promURL := fmt.Sprintf("https://prometheus.sentinella.alpina/api/v1/query_range?query=%s&start=%d&end=%d&step=3600",
@@ -131,10 +299,12 @@ func getHistoricalData(query string) []HistoricalPoint {
 
 	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	client := &http.Client{Transport: tr, Timeout: 10 * time.Second}
-	req, _ := http.NewRequest("GET", promURL, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", promURL, nil)
 	req.SetBasicAuth("admin", "vURLumGa0GMu4/nR2+vejcenAQBqt1un")
 
+	start := time.Now()
 	resp, err := client.Do(req)
+	selfMetrics.upstream("prometheus", start, err)
 	if err != nil {
 		return points
 	}
@@ -174,49 +344,380 @@ func getHistoricalData(query string) []HistoricalPoint {
 	return points
 }
 
-func formatBytes(b uint64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
-	}
-	div, exp := uint64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+// openAPISpec documents /api/v1
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// configuredListenAddrs is KOMGA_LANDING_LISTEN_ADDR, comma separated;
+// literal addresses bind one address family only
+func configuredListenAddrs() []string {
+	addrs := strings.Split(envOr("KOMGA_LANDING_LISTEN_ADDR", ":80"), ",")
+	for i := range addrs {
+		addrs[i] = strings.TrimSpace(addrs[i])
 	}
-	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+	return addrs
 }
 
+const cliUsage = `usage: komga-landing [command] [flags]
+
+commands:
+  serve     run the landing page (the default)
+  status    print the summary for this host; -json for the /api/v1/stats body
+  check     exit 0 when the container runs healthy and Komga answers, 2
+            otherwise, like a Nagios plugin
+  collect   save raw docker inspect and /proc output under -fixture-dir
+`
+
 func main() {
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		serve()
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := runCommand(ctx, os.Args[1], os.Args[2:])
+	stop()
+	os.Exit(code)
+}
+
+// runCommand runs a one-shot subcommand with the collectors the page uses
+// and returns the exit code
+func runCommand(ctx context.Context, name string, args []string) int {
+	fs := flag.NewFlagSet("komga-landing "+name, flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of text (status, check)")
+	color := fs.String("color", "auto", "colour the summary: auto, always or never (status)")
+	dir := fs.String("fixture-dir", "", "directory to write the captured output to (collect)")
+	timeout := fs.Duration("timeout", 10*time.Second, "limit for docker, Komga and DNS calls")
+	switch name {
+	case "status", "check", "collect":
+	case "help", "-h", "-help", "--help":
+		fmt.Print(cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, cliUsage)
+		return 2
+	}
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil || fs.NArg() > 0 {
+		if name == "check" {
+			return 3
+		}
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	switch name {
+	case "status":
+		data := PageData{
+			System:  getSystemStats(ctx),
+			Komga:   getKomgaStats(ctx),
+			Network: getNetworkInfo(ctx, configuredListenAddrs()),
+			Updated: time.Now().Format("2006-01-02 15:04:05"),
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(statsV1(data.System, data.Komga, data.Network))
+			return 0
+		}
+		ansi := *color == "always"
+		if *color == "auto" {
+			fi, err := os.Stdout.Stat()
+			ansi = err == nil && fi.Mode()&os.ModeCharDevice != 0
+		}
+		writeTextSummary(os.Stdout, data, ansi)
+		return 0
+
+	case "check":
+		k := getKomgaStats(ctx)
+		var problems []string
+		if k.ContainerState != "running" {
+			problems = append(problems, "container "+k.ContainerState)
+		} else if k.ContainerHealth != "" && k.ContainerHealth != "healthy" {
+			problems = append(problems, "container "+k.ContainerHealth)
+		}
+		if k.Error != "" {
+			problems = append(problems, "Komga API: "+k.Error)
+		}
+		if *asJSON {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": len(problems) == 0, "problems": problems, "komga": KomgaV1(k)})
+		} else if len(problems) > 0 {
+			fmt.Println("KOMGA CRITICAL - " + strings.Join(problems, ", "))
+		} else {
+			fmt.Printf("KOMGA OK - container %s, %d libraries, %d series, %d books\n", k.ContainerState, k.Libraries, k.Series, k.Books)
+		}
+		if len(problems) > 0 {
+			return 2
+		}
+		return 0
+
+	default: // collect
+		if *dir == "" {
+			fmt.Fprintln(os.Stderr, "collect needs -fixture-dir")
+			return 2
+		}
+		save := func(rel string, data []byte) bool {
+			p := path.Join(*dir, rel)
+			if err := os.MkdirAll(path.Dir(p), 0o755); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return false
+			}
+			if err := os.WriteFile(p, data, 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return false
+			}
+			fmt.Println(p)
+			return true
+		}
+		container := envOr("KOMGA_LANDING_CONTAINER", "komga")
+		if out, err := exec.CommandContext(ctx, "docker", "inspect", container).Output(); err != nil {
+			fmt.Fprintf(os.Stderr, "skipped docker inspect %s: %v\n", container, err)
+		} else if !save("docker/inspect.json", out) {
+			return 1
+		}
+		// the /proc files getSystemStats and getNetworkInfo read
+		for _, name := range []string{"uptime", "stat", "meminfo", "loadavg", "net/if_inet6", "net/route", "net/ipv6_route"} {
+			data, err := os.ReadFile("/proc/" + name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipped /proc/%s: %v\n", name, err)
+				continue
+			}
+			if !save("proc/"+name, data) {
+				return 1
+			}
+		}
+		return 0
+	}
+}
+
+// serve runs the landing page until SIGINT or SIGTERM
+func serve() {
 	tmpl := template.Must(template.New("index").Funcs(template.FuncMap{
 		"formatBytes": formatBytes,
 		"printf":      fmt.Sprintf,
+		"asset":       siteAssets.URL,
 	}).Parse(htmlTemplate))
+	closeLogs := setupLogging()
+	defer closeLogs()
+	if err := siteAssets.Verify(vendoredAssets); err != nil {
+		log.Fatalf("Vendored assets: %v", err)
+	}
+
+	// ctx is cancelled on SIGINT/SIGTERM; requests keep their own contexts
+	// so they can finish during shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var mqttWG sync.WaitGroup
+	if broker := os.Getenv("KOMGA_LANDING_MQTT_BROKER"); broker != "" {
+		interval, err := time.ParseDuration(envOr("KOMGA_LANDING_MQTT_INTERVAL", "60s"))
+		if err != nil || interval <= 0 {
+			interval = time.Minute
+		}
+		mqttWG.Add(1)
+		go func() {
+			defer mqttWG.Done()
+			publishMQTT(ctx, broker, interval)
+		}()
+	}
+
+	listenAddrs := configuredListenAddrs()
+
+	// the logs panel reads from KOMGA_LANDING_LOKI_QUERY_URL, or from the
+	// Loki the logs are pushed to
+	var lokiClient *loki.Querier
+	if base := envOr("KOMGA_LANDING_LOKI_QUERY_URL", os.Getenv("KOMGA_LANDING_LOKI_URL")); base != "" {
+		lokiClient = loki.NewQuerier(base, os.Getenv("KOMGA_LANDING_LOKI_TENANT"), 10*time.Second)
+	}
+	logsQuery := envOr("KOMGA_LANDING_LOGS_QUERY", `{container="komga"}`)
+
+	// KOMGA_LANDING_METRICS_ADDR moves /metrics to its own listeners;
+	// otherwise it is served with the pages, open like the stats API
+	metricsAddrs := os.Getenv("KOMGA_LANDING_METRICS_ADDR")
+	if metricsAddrs == "" {
+		http.Handle("/metrics", selfMetrics)
+	}
+
+	http.Handle("/static/", siteAssets)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept, User-Agent")
+		switch format := textview.Format(r); format {
+		case "html":
+		case "ansi", "text":
+			// no history charts in a terminal, so Prometheus is not asked
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeTextSummary(w, PageData{
+				System:  getSystemStats(r.Context()),
+				Komga:   getKomgaStats(r.Context()),
+				Network: getNetworkInfo(r.Context(), listenAddrs),
+				Updated: time.Now().Format("2006-01-02 15:04:05"),
+			}, format == "ansi")
+			return
+		default:
+			http.Error(w, "format must be html, ansi or text", http.StatusBadRequest)
+			return
+		}
+
 		cpuQuery := `100-avg(rate(node_cpu_seconds_total{instance="komga.alpina:9100",mode="idle"}[5m]))*100`
 		memQuery := `(1-node_memory_MemAvailable_bytes{instance="komga.alpina:9100"}/node_memory_MemTotal_bytes{instance="komga.alpina:9100"})*100`
 
 		data := PageData{
-			System:     getSystemStats(),
-			Komga:      getKomgaStats(),
-			CPUHistory: getHistoricalData(cpuQuery),
-			MemHistory: getHistoricalData(memQuery),
+			System:     getSystemStats(r.Context()),
+			Komga:      getKomgaStats(r.Context()),
+			Network:    getNetworkInfo(r.Context(), listenAddrs),
+			CPUHistory: getHistoricalData(r.Context(), cpuQuery),
+			MemHistory: getHistoricalData(r.Context(), memQuery),
+			Logs:       lokiClient != nil,
 			Updated:    time.Now().Format("2006-01-02 15:04:05"),
 		}
-		tmpl.Execute(w, data)
+		// render into a buffer so a template error can still become a 500
+		var page bytes.Buffer
+		if err := tmpl.Execute(&page, data); err != nil {
+			slog.Error("rendering page failed", "component", "page", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		page.WriteTo(w)
 	})
 
-	http.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statsV1(getSystemStats(r.Context()), getKomgaStats(r.Context()), getNetworkInfo(r.Context(), listenAddrs)))
+	})
+	http.HandleFunc("/api/stats", api.DeprecatedAlias("/api/v1/stats", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"system": getSystemStats(),
-			"komga":  getKomgaStats(),
+			"system":  getSystemStats(r.Context()),
+			"komga":   getKomgaStats(r.Context()),
+			"network": getNetworkInfo(r.Context(), listenAddrs),
 		})
+	}))
+	http.HandleFunc("/api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(openAPISpec)
 	})
+	logs := logsHandler(lokiClient, logsQuery)
+	http.HandleFunc("/api/v1/logs", logs)
+	http.HandleFunc("/api/logs", api.DeprecatedAlias("/api/v1/logs", logs))
+
+	listenAll := func(addrs []string) []net.Listener {
+		lns, err := listen.All(addrs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return lns
+	}
+	// origins allowed to frame the pages, comma or space separated
+	frameAncestors := strings.Fields(strings.ReplaceAll(os.Getenv("KOMGA_LANDING_FRAME_ANCESTORS"), ",", " "))
+	newServer := func(h http.Handler) *http.Server {
+		return &http.Server{
+			Handler:           logRequests(security.Headers(frameAncestors, selfMetrics.instrument(http.DefaultServeMux, h))),
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		}
+	}
+	authMode := envOr("KOMGA_LANDING_AUTH_MODE", "none")
+	identify, err := newIdentifier(authMode)
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	pages := withAuth(identify, http.DefaultServeMux)
+	srv := newServer(pages)
+	servers := []*http.Server{srv}
+	plainSrv := srv
+	var secure []net.Listener
+	if certFile := os.Getenv("KOMGA_LANDING_TLS_CERT"); certFile != "" {
+		certs, err := watchCerts(ctx, certFile, os.Getenv("KOMGA_LANDING_TLS_KEY"), time.Minute)
+		if err != nil {
+			log.Fatalf("TLS: %v", err)
+		}
+		tlsAddrs := strings.Split(envOr("KOMGA_LANDING_TLS_LISTEN_ADDR", ":443"), ",")
+		for i := range tlsAddrs {
+			tlsAddrs[i] = strings.TrimSpace(tlsAddrs[i])
+		}
+		port, err := listen.TLSPort(tlsAddrs)
+		if err != nil {
+			log.Fatalf("TLS: %v", err)
+		}
+		securePages, redirect := tlsHandlers(http.DefaultServeMux, pages, port)
+		srv.TLSConfig = listen.TLSConfig(certs)
+		srv.Handler = logRequests(security.Headers(frameAncestors, selfMetrics.instrument(http.DefaultServeMux, securePages)))
+		secure = listenAll(tlsAddrs)
+		if envOr("KOMGA_LANDING_HTTP_MODE", "redirect") == "redirect" {
+			plainSrv = newServer(redirect)
+			servers = append(servers, plainSrv)
+		}
+	}
+	plain := listenAll(listenAddrs)
+	var metricsLns []net.Listener
+	if metricsAddrs != "" {
+		addrs := strings.Split(metricsAddrs, ",")
+		for i := range addrs {
+			addrs[i] = strings.TrimSpace(addrs[i])
+		}
+		metricsLns = listenAll(addrs)
+	}
+
+	serveErr := make(chan error, len(plain)+len(secure)+len(metricsLns))
+	if len(metricsLns) > 0 {
+		metricsSrv := &http.Server{
+			Handler:           logRequests(selfMetrics),
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		}
+		servers = append(servers, metricsSrv)
+		for _, ln := range metricsLns {
+			slog.Info("metrics listening", "addr", ln.Addr().String())
+			go func(ln net.Listener) {
+				if err := metricsSrv.Serve(ln); err != http.ErrServerClosed {
+					serveErr <- err
+				}
+			}(ln)
+		}
+	}
+	for _, ln := range plain {
+		slog.Info("Komga Landing Page listening", "addr", ln.Addr().String(), "tls", false, "redirect", plainSrv != srv)
+		go func(ln net.Listener) {
+			if err := plainSrv.Serve(ln); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}(ln)
+	}
+	for _, ln := range secure {
+		slog.Info("Komga Landing Page listening", "addr", ln.Addr().String(), "tls", true)
+		go func(ln net.Listener) {
+			if err := srv.ServeTLS(ln, "", ""); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}(ln)
+	}
 
-	fmt.Println("Komga Landing Page running on :80")
-	http.ListenAndServe(":80", nil)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("shutting down", "timeout", 15*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	for _, hs := range servers {
+		if err := hs.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("graceful shutdown incomplete", "error", err)
+		}
+	}
+	mqttWG.Wait()
+	slog.Info("stopped")
 }
 
 const htmlTemplate = `<!DOCTYPE html>
@@ -225,124 +726,8 @@ const htmlTemplate = `<!DOCTYPE html>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>Komga Server</title>
-    <script src="https://cdn.jsdelivr.net/npm/chart.js"></script>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, "Helvetica Neue", Arial, sans-serif;
-            background: linear-gradient(135deg, #1a1a2e 0%, #16213e 50%, #0f3460 100%);
-            color: #e4e4e4;
-            min-height: 100vh;
-            padding: 2rem;
-        }
-        .container { max-width: 1400px; margin: 0 auto; }
-        header {
-            text-align: center;
-            margin-bottom: 3rem;
-            padding: 2rem;
-            background: rgba(255,255,255,0.05);
-            border-radius: 20px;
-            backdrop-filter: blur(10px);
-            border: 1px solid rgba(255,255,255,0.1);
-        }
-        h1 {
-            font-size: 3rem;
-            background: linear-gradient(120deg, #e94560, #ff6b6b);
-            -webkit-background-clip: text;
-            -webkit-text-fill-color: transparent;
-            background-clip: text;
-            margin-bottom: 0.5rem;
-        }
-        .subtitle { color: #888; font-size: 1.1rem; }
-        .hostname { color: #e94560; font-weight: 600; }
-        .grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(280px, 1fr)); gap: 1.5rem; margin-bottom: 2rem; }
-        .card {
-            background: rgba(255,255,255,0.05);
-            border-radius: 16px;
-            padding: 1.5rem;
-            border: 1px solid rgba(255,255,255,0.1);
-            backdrop-filter: blur(10px);
-            transition: transform 0.3s, box-shadow 0.3s;
-        }
-        .card:hover {
-            transform: translateY(-5px);
-            box-shadow: 0 20px 40px rgba(0,0,0,0.3);
-        }
-        .card-title {
-            font-size: 0.85rem;
-            text-transform: uppercase;
-            letter-spacing: 1px;
-            color: #888;
-            margin-bottom: 1rem;
-            display: flex;
-            align-items: center;
-            gap: 0.5rem;
-        }
-        .card-title::before { content: ""; display: inline-block; width: 8px; height: 8px; background: #e94560; border-radius: 50%; }
-        .stat-value {
-            font-size: 2.5rem;
-            font-weight: 700;
-            background: linear-gradient(120deg, #fff, #ccc);
-            -webkit-background-clip: text;
-            -webkit-text-fill-color: transparent;
-            background-clip: text;
-        }
-        .stat-label { color: #666; margin-top: 0.25rem; }
-        .progress-bar {
-            height: 8px;
-            background: rgba(255,255,255,0.1);
-            border-radius: 4px;
-            overflow: hidden;
-            margin-top: 1rem;
-        }
-        .progress-fill {
-            height: 100%;
-            border-radius: 4px;
-            transition: width 0.5s ease;
-        }
-        .progress-fill.cpu { background: linear-gradient(90deg, #00c9ff, #92fe9d); }
-        .progress-fill.mem { background: linear-gradient(90deg, #f093fb, #f5576c); }
-        .progress-fill.disk { background: linear-gradient(90deg, #4facfe, #00f2fe); }
-        .chart-container {
-            background: rgba(255,255,255,0.05);
-            border-radius: 16px;
-            padding: 1.5rem;
-            border: 1px solid rgba(255,255,255,0.1);
-            margin-bottom: 2rem;
-        }
-        .chart-title { font-size: 1.2rem; margin-bottom: 1rem; color: #fff; }
-        .info-grid { display: grid; grid-template-columns: 1fr; gap: 0.5rem; }
-        .info-item { display: flex; justify-content: space-between; padding: 0.5rem 0; border-bottom: 1px solid rgba(255,255,255,0.05); }
-        .info-label { color: #888; }
-        .info-value { color: #fff; font-weight: 500; }
-        .komga-section {
-            background: linear-gradient(135deg, rgba(233,69,96,0.1), rgba(255,107,107,0.05));
-            border: 1px solid rgba(233,69,96,0.3);
-        }
-        footer {
-            text-align: center;
-            padding: 2rem;
-            color: #666;
-            font-size: 0.9rem;
-        }
-        .btn {
-            display: inline-block;
-            padding: 0.75rem 1.5rem;
-            background: linear-gradient(120deg, #e94560, #ff6b6b);
-            color: #fff;
-            text-decoration: none;
-            border-radius: 8px;
-            font-weight: 600;
-            transition: transform 0.2s, box-shadow 0.2s;
-        }
-        .btn:hover { transform: translateY(-2px); box-shadow: 0 10px 20px rgba(233,69,96,0.3); }
-        .charts-grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(400px, 1fr)); gap: 1.5rem; }
-        @media (max-width: 768px) {
-            h1 { font-size: 2rem; }
-            .stat-value { font-size: 1.8rem; }
-            .charts-grid { grid-template-columns: 1fr; }
-        }
-    </style>
+    <link rel="stylesheet" href="{{asset "komga.css"}}">
+    <script src="{{asset "chart.umd.min.js"}}"></script>
 </head>
 <body>
     <div class="container">
@@ -379,6 +764,18 @@ const htmlTemplate = `<!DOCTYPE html>
                     <div class="info-item"><span class="info-label">Uptime</span><span class="info-value">{{.System.Uptime}}</span></div>
                     <div class="info-item"><span class="info-label">OS</span><span class="info-value">{{.System.OS}}</span></div>
                     <div class="info-item"><span class="info-label">Kernel</span><span class="info-value">{{.System.Kernel}}</span></div>
+                    <div class="info-item"><span class="info-label">Container</span><span class="info-value">{{.Komga.ContainerState}}{{if .Komga.ContainerHealth}} ({{.Komga.ContainerHealth}}){{end}}</span></div>
+                    <div class="info-item"><span class="info-label">Library</span><span class="info-value">{{.Komga.Libraries}} libraries · {{.Komga.Series}} series · {{.Komga.Books}} books</span></div>
+                </div>
+            </div>
+            <div class="card">
+                <div class="card-title">Network</div>
+                <div class="info-grid">
+                    <div class="info-item"><span class="info-label">Listening</span><span class="info-value">{{range $i, $l := .Network.Listeners}}{{if $i}}, {{end}}{{$l}}{{end}}</span></div>
+                    {{range .Network.IPv4}}<div class="info-item"><span class="info-label">IPv4</span><span class="info-value">{{.}}</span></div>{{end}}
+                    {{range .Network.IPv6}}<div class="info-item"><span class="info-label">IPv6 · {{if eq .Kind "eui64"}}SLAAC EUI-64{{else if eq .Kind "temporary"}}temporary{{else}}stable{{end}}</span><span class="info-value">{{.Address}}</span></div>{{end}}
+                    {{range .Network.Routes}}<div class="info-item"><span class="info-label">Default route</span><span class="info-value">{{.}}</span></div>{{end}}
+                    <div class="info-item"><span class="info-label">AAAA {{.Network.DNSName}}</span><span class="info-value">{{if .Network.DNSError}}{{.Network.DNSError}}{{else}}{{range .Network.AAAA}}{{.}} {{else}}none {{end}}{{if .Network.AAAAMatch}}✓ matches{{else}}⚠ mismatch{{end}}{{end}}</span></div>
                 </div>
             </div>
         </div>
@@ -394,60 +791,26 @@ const htmlTemplate = `<!DOCTYPE html>
             </div>
         </div>
 
+        {{if .Logs}}
+        <div class="chart-container">
+            <div class="logs-header">
+                <div class="chart-title">📜 Komga / docker logs</div>
+                <div class="logs-tab active" data-level="">All</div>
+                <div class="logs-tab" data-level="info">Info+</div>
+                <div class="logs-tab" data-level="warning">Warning+</div>
+                <div class="logs-tab" data-level="error">Error</div>
+                <div class="logs-status" id="logsStatus"></div>
+            </div>
+            <div class="log-lines" id="logLines"></div>
+        </div>
+        {{end}}
+
         <footer>
             <p>Last updated: {{.Updated}} • Powered by Go</p>
         </footer>
     </div>
 
-    <script>
-        const cpuData = {{.CPUHistory}};
-        const memData = {{.MemHistory}};
-
-        const chartOptions = {
-            responsive: true,
-            maintainAspectRatio: true,
-            plugins: { legend: { display: false } },
-            scales: {
-                x: { grid: { color: 'rgba(255,255,255,0.05)' }, ticks: { color: '#888', maxTicksLimit: 8 } },
-                y: { grid: { color: 'rgba(255,255,255,0.05)' }, ticks: { color: '#888' }, min: 0, max: 100 }
-            }
-        };
-
-        if (cpuData && cpuData.length > 0) {
-            new Chart(document.getElementById('cpuChart'), {
-                type: 'line',
-                data: {
-                    labels: cpuData.map(p => p.time),
-                    datasets: [{
-                        data: cpuData.map(p => p.value),
-                        borderColor: '#00c9ff',
-                        backgroundColor: 'rgba(0,201,255,0.1)',
-                        fill: true,
-                        tension: 0.4,
-                        pointRadius: 0
-                    }]
-                },
-                options: chartOptions
-            });
-        }
-
-        if (memData && memData.length > 0) {
-            new Chart(document.getElementById('memChart'), {
-                type: 'line',
-                data: {
-                    labels: memData.map(p => p.time),
-                    datasets: [{
-                        data: memData.map(p => p.value),
-                        borderColor: '#f5576c',
-                        backgroundColor: 'rgba(245,87,108,0.1)',
-                        fill: true,
-                        tension: 0.4,
-                        pointRadius: 0
-                    }]
-                },
-                options: chartOptions
-            });
-        }
-    </script>
+    <script type="application/json" id="page-data">{"cpu":{{.CPUHistory}},"mem":{{.MemHistory}}}</script>
+    <script src="{{asset "komga.js"}}"></script>
 </body>
 </html>`
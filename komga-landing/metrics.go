@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"landing/metrics"
+)
+
+// instruments count the landing page's own requests and time the upstream
+// calls (Komga API, docker, Prometheus, Loki) behind them
+type instruments struct {
+	start    time.Time
+	requests *metrics.Requests
+
+	mu               sync.Mutex
+	upstreamSeconds  map[string]*metrics.Histogram
+	upstreamFailures map[string]uint64
+}
+
+var selfMetrics = newInstruments()
+
+func newInstruments() *instruments {
+	return &instruments{
+		start:            time.Now(),
+		requests:         metrics.NewRequests(),
+		upstreamSeconds:  map[string]*metrics.Histogram{},
+		upstreamFailures: map[string]uint64{},
+	}
+}
+
+// upstream records a call to a dependency that started at start
+func (in *instruments) upstream(name string, start time.Time, err error) {
+	d := time.Since(start)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	h, ok := in.upstreamSeconds[name]
+	if !ok {
+		h = metrics.NewHistogram(metrics.LatencyBuckets)
+		in.upstreamSeconds[name] = h
+	}
+	h.Observe(d.Seconds())
+	if err != nil {
+		in.upstreamFailures[name]++
+	}
+}
+
+// instrument counts requests under the ServeMux pattern that serves them
+func (in *instruments) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return in.requests.Middleware(mux, next)
+}
+
+// Write emits the metrics in a stable order
+func (in *instruments) Write(m *metrics.Writer) {
+	in.requests.Write(m, "komga_landing")
+
+	in.mu.Lock()
+	for _, name := range metrics.SortedKeys(in.upstreamSeconds) {
+		m.Histogram("komga_landing_upstream_duration_seconds", "Time of calls to Komga, docker, Prometheus and Loki.", in.upstreamSeconds[name], "upstream", name)
+	}
+	for _, name := range []string{"docker", "komga", "loki", "prometheus"} {
+		m.Counter("komga_landing_upstream_errors_total", "Failed calls to Komga, docker, Prometheus and Loki.", float64(in.upstreamFailures[name]), "upstream", name)
+	}
+	in.mu.Unlock()
+
+	metrics.WriteRuntime(m, in.start)
+}
+
+// ServeHTTP writes the Prometheus text format
+func (in *instruments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	in.Write(metrics.NewWriter(w))
+}
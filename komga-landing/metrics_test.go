@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstruments(t *testing.T) {
+	in := newInstruments()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {})
+	h := in.instrument(mux, mux)
+	for _, path := range []string{"/", "/?format=ansi", "/api/v1/logs?since=1h", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	in.upstream("komga", time.Now().Add(-30*time.Millisecond), nil)
+	in.upstream("komga", time.Now().Add(-3*time.Second), errors.New("timeout"))
+	in.upstream("loki", time.Now(), errors.New("502"))
+
+	rec := httptest.NewRecorder()
+	in.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		`komga_landing_http_requests_total{route="/{$}",method="GET",code="200"} 2`,
+		`komga_landing_http_requests_total{route="/api/v1/logs",method="GET",code="502"} 1`,
+		`komga_landing_http_requests_total{route="unmatched",method="GET",code="404"} 1`,
+		`komga_landing_http_request_duration_seconds_count{route="/{$}"} 2`,
+		`komga_landing_upstream_duration_seconds_bucket{upstream="komga",le="0.05"} 1`,
+		`komga_landing_upstream_duration_seconds_bucket{upstream="komga",le="5"} 2`,
+		`komga_landing_upstream_duration_seconds_count{upstream="loki"} 1`,
+		`komga_landing_upstream_errors_total{upstream="docker"} 0`,
+		`komga_landing_upstream_errors_total{upstream="komga"} 1`,
+		`komga_landing_upstream_errors_total{upstream="loki"} 1`,
+		"# TYPE process_start_time_seconds gauge\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	for _, name := range []string{"komga_landing_upstream_duration_seconds", "komga_landing_upstream_errors_total"} {
+		if n := strings.Count(out, "# HELP "+name+" "); n != 1 {
+			t.Errorf("%d HELP lines for %s", n, name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"landing/mqtt"
+)
+
+// komgaHAEntities are the Home Assistant sensors announced via discovery.
+// Their values come from the JSON state document built by komgaHAState.
+var komgaHAEntities = []mqtt.Entity{
+	{Component: "sensor", Object: "libraries", Config: map[string]interface{}{"name": "Libraries", "icon": "mdi:bookshelf", "state_class": "measurement", "value_template": "{{ value_json.libraries }}"}},
+	{Component: "sensor", Object: "series", Config: map[string]interface{}{"name": "Series", "icon": "mdi:book-multiple", "state_class": "measurement", "value_template": "{{ value_json.series }}"}},
+	{Component: "sensor", Object: "books", Config: map[string]interface{}{"name": "Books", "icon": "mdi:book-open-variant", "state_class": "measurement", "value_template": "{{ value_json.books }}"}},
+	{Component: "sensor", Object: "container_state", Config: map[string]interface{}{"name": "Container state", "icon": "mdi:docker", "value_template": "{{ value_json.container_state }}"}},
+	{Component: "binary_sensor", Object: "container_running", Config: map[string]interface{}{"name": "Container running", "device_class": "running", "value_template": "{{ value_json.container_running }}", "payload_on": "ON", "payload_off": "OFF"}},
+}
+
+func komgaHAState(stats KomgaStats) map[string]interface{} {
+	running := "OFF"
+	if stats.ContainerState == "running" {
+		running = "ON"
+	}
+	return map[string]interface{}{
+		"libraries":         stats.Libraries,
+		"series":            stats.Series,
+		"books":             stats.Books,
+		"container_state":   stats.ContainerState,
+		"container_health":  stats.ContainerHealth,
+		"container_running": running,
+	}
+}
+
+// newMQTTDevice is the Home Assistant device for this host, configured by
+// the KOMGA_LANDING_MQTT_* variables
+func newMQTTDevice(broker, host string) *mqtt.Device {
+	return mqtt.NewDevice(mqtt.Options{
+		Broker:          broker,
+		Username:        os.Getenv("KOMGA_LANDING_MQTT_USER"),
+		Password:        os.Getenv("KOMGA_LANDING_MQTT_PASSWORD"),
+		Model:           "komga-landing",
+		Name:            "Komga " + host,
+		Host:            host,
+		TopicPrefix:     envOr("KOMGA_LANDING_MQTT_TOPIC_PREFIX", "komga-landing"),
+		DiscoveryPrefix: envOr("KOMGA_LANDING_MQTT_DISCOVERY_PREFIX", "homeassistant"),
+		Entities:        komgaHAEntities,
+	})
+}
+
+// publishMQTT announces the Komga sensors to Home Assistant and publishes
+// their state every interval until ctx is cancelled, then marks them
+// offline
+func publishMQTT(ctx context.Context, broker string, interval time.Duration) {
+	host, _ := os.Hostname()
+	device := newMQTTDevice(broker, host)
+	defer device.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := device.Publish(komgaHAState(getKomgaStats(ctx))); err != nil {
+			slog.Warn("mqtt publish failed", "component", "mqtt", "broker", broker, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
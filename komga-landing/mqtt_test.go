@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"landing/mqtt/mqtttest"
+)
+
+func TestKomgaHAState(t *testing.T) {
+	state := komgaHAState(KomgaStats{Libraries: 2, Series: 40, Books: 900, ContainerState: "running", ContainerHealth: "healthy"})
+	if state["container_running"] != "ON" || state["books"] != 900 || state["container_health"] != "healthy" {
+		t.Errorf("running container: %v", state)
+	}
+	if state := komgaHAState(KomgaStats{ContainerState: "exited"}); state["container_running"] != "OFF" {
+		t.Errorf("stopped container: %v", state)
+	}
+}
+
+func TestMQTTDiscoveryAndState(t *testing.T) {
+	broker := mqtttest.NewBroker(t, 0)
+	t.Setenv("KOMGA_LANDING_MQTT_USER", "ha")
+	t.Setenv("KOMGA_LANDING_MQTT_PASSWORD", "pw")
+	t.Setenv("KOMGA_LANDING_MQTT_TOPIC_PREFIX", "")
+	t.Setenv("KOMGA_LANDING_MQTT_DISCOVERY_PREFIX", "")
+	d := newMQTTDevice(broker.Addr, "Books.lan")
+	defer d.Close()
+
+	if err := d.Publish(komgaHAState(KomgaStats{Series: 3, ContainerState: "running"})); err != nil {
+		t.Fatal(err)
+	}
+	if flags := (<-broker.Connects)[7]; flags != 0x80|0x40|0x20|0x04|0x02 {
+		t.Errorf("connect flags = %08b", flags)
+	}
+	got := map[string]mqtttest.Message{}
+	for i := 0; i < len(komgaHAEntities)+2; i++ {
+		select {
+		case m := <-broker.Messages:
+			got[m.Topic] = m
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d messages: %v", i, got)
+		}
+	}
+
+	disc, ok := got["homeassistant/binary_sensor/komga_landing_books_lan/container_running/config"]
+	if !ok || !disc.Retain {
+		t.Fatalf("container_running discovery missing or not retained: %v", got)
+	}
+	var dc map[string]interface{}
+	if err := json.Unmarshal([]byte(disc.Payload), &dc); err != nil {
+		t.Fatal(err)
+	}
+	if dc["state_topic"] != "komga-landing/Books.lan/state" || dc["availability_topic"] != "komga-landing/Books.lan/availability" || dc["device_class"] != "running" {
+		t.Errorf("container_running discovery = %v", dc)
+	}
+	if _, ok := got["homeassistant/sensor/komga_landing_books_lan/books/config"]; !ok {
+		t.Error("books sensor not announced")
+	}
+	var state map[string]interface{}
+	if err := json.Unmarshal([]byte(got["komga-landing/Books.lan/state"].Payload), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state["series"].(float64) != 3 || state["container_running"] != "ON" {
+		t.Errorf("state = %v", state)
+	}
+}
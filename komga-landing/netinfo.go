@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"landing/netinfo"
+)
+
+// NetworkInfo is the addressing shown on the page: IPv4, IPv6 tagged
+// eui64/stable/temporary, default routes and whether DNS has the live AAAA
+type NetworkInfo struct {
+	Listeners []string
+	IPv4      []string
+	IPv6      []NetAddr
+	Routes    []string
+	DNSName   string
+	AAAA      []string
+	AAAAMatch bool
+	DNSError  string `json:",omitempty"`
+}
+
+type NetAddr struct {
+	Address string
+	Kind    string
+}
+
+// getNetworkInfo reads the host's network and checks the AAAA records of
+// KOMGA_LANDING_DNS_NAME, the host name by default
+func getNetworkInfo(ctx context.Context, listeners []string) NetworkInfo {
+	dnsName := os.Getenv("KOMGA_LANDING_DNS_NAME")
+	if dnsName == "" {
+		dnsName, _ = os.Hostname()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return networkSummary(netinfo.Get(ctx, listeners, dnsName))
+}
+
+// networkSummary flattens the interfaces into the global addresses the
+// page lists. Configured IPv6 addresses count as stable, the kinds the v1
+// API documents.
+func networkSummary(info netinfo.NetworkInfo) NetworkInfo {
+	n := NetworkInfo{Listeners: info.Listeners}
+	for _, i := range info.Interfaces {
+		n.IPv4 = append(n.IPv4, i.IPv4...)
+		for _, a := range i.IPv6 {
+			if a.Scope != "global" {
+				continue
+			}
+			kind := a.Kind
+			if kind == "static" {
+				kind = "stable"
+			}
+			n.IPv6 = append(n.IPv6, NetAddr{Address: a.Address + "/" + strconv.Itoa(a.Prefix), Kind: kind})
+		}
+	}
+	for _, r := range info.Routes {
+		n.Routes = append(n.Routes, fmt.Sprintf("via %s dev %s", r.Gateway, r.Interface))
+	}
+	if dns := info.DNS; dns != nil {
+		n.DNSName = dns.Name
+		n.AAAA = dns.AAAA
+		n.AAAAMatch = dns.Match
+		n.DNSError = dns.Error
+	}
+	return n
+}
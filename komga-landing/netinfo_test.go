@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"landing/netinfo"
+)
+
+func TestNetworkSummary(t *testing.T) {
+	info := netinfo.NetworkInfo{
+		Listeners: []string{":80"},
+		Interfaces: []netinfo.NetInterface{{
+			Name: "eth0",
+			IPv4: []string{"172.16.16.202/16"},
+			IPv6: []netinfo.IPv6Addr{
+				{Address: "2603:8001:7400:fa9a:be24:11ff:fe09:c0b9", Prefix: 64, Scope: "global", Kind: "eui64"},
+				{Address: "2603:8001:7400:fa9a::202", Prefix: 128, Scope: "global", Kind: "static"},
+				{Address: "2603:8001:7400:fa9a:3c1d:2e4f:5a6b:7c8d", Prefix: 64, Scope: "global", Kind: "temporary"},
+				{Address: "fe80::be24:11ff:fe09:c0b9", Prefix: 64, Scope: "link", Kind: "eui64"},
+			},
+		}},
+		Routes: []netinfo.DefaultRoute{
+			{Family: "ipv4", Gateway: "172.16.16.16", Interface: "eth0", Metric: 100},
+			{Family: "ipv6", Gateway: "fe80::a236:9fff:fe66:27ac", Interface: "eth0", Metric: 1024},
+		},
+		DNS: &netinfo.DNSCheck{Name: "komga.alpina", AAAA: []string{"2603:8001:7400:fa9a:be24:11ff:fe09:c0b9"}, Match: true},
+	}
+	want := NetworkInfo{
+		Listeners: []string{":80"},
+		IPv4:      []string{"172.16.16.202/16"},
+		IPv6: []NetAddr{
+			{"2603:8001:7400:fa9a:be24:11ff:fe09:c0b9/64", "eui64"},
+			{"2603:8001:7400:fa9a::202/128", "stable"},
+			{"2603:8001:7400:fa9a:3c1d:2e4f:5a6b:7c8d/64", "temporary"},
+		},
+		Routes:    []string{"via 172.16.16.16 dev eth0", "via fe80::a236:9fff:fe66:27ac dev eth0"},
+		DNSName:   "komga.alpina",
+		AAAA:      []string{"2603:8001:7400:fa9a:be24:11ff:fe09:c0b9"},
+		AAAAMatch: true,
+	}
+	if got := networkSummary(info); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	info.DNS = &netinfo.DNSCheck{Name: "komga.alpina", Error: "no such host"}
+	if got := networkSummary(info); got.AAAAMatch || got.DNSError != "no such host" {
+		t.Errorf("failed lookup: %+v", got)
+	}
+	// the v1 API never sends null lists, even without addresses or DNS
+	v1 := statsV1(SystemStats{}, KomgaStats{}, networkSummary(netinfo.NetworkInfo{})).Network
+	if v1.IPv4 == nil || v1.IPv6 == nil || v1.Routes == nil || v1.AAAA == nil || v1.Listeners == nil {
+		t.Errorf("nil lists in %+v", v1)
+	}
+}
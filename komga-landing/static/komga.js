@@ -0,0 +1,91 @@
+const pageData = JSON.parse(document.getElementById('page-data').textContent);
+const cpuData = pageData.cpu;
+const memData = pageData.mem;
+
+const chartOptions = {
+    responsive: true,
+    maintainAspectRatio: true,
+    plugins: { legend: { display: false } },
+    scales: {
+        x: { grid: { color: 'rgba(255,255,255,0.05)' }, ticks: { color: '#888', maxTicksLimit: 8 } },
+        y: { grid: { color: 'rgba(255,255,255,0.05)' }, ticks: { color: '#888' }, min: 0, max: 100 }
+    }
+};
+
+if (cpuData && cpuData.length > 0) {
+    new Chart(document.getElementById('cpuChart'), {
+        type: 'line',
+        data: {
+            labels: cpuData.map(p => p.time),
+            datasets: [{
+                data: cpuData.map(p => p.value),
+                borderColor: '#00c9ff',
+                backgroundColor: 'rgba(0,201,255,0.1)',
+                fill: true,
+                tension: 0.4,
+                pointRadius: 0
+            }]
+        },
+        options: chartOptions
+    });
+}
+
+if (memData && memData.length > 0) {
+    new Chart(document.getElementById('memChart'), {
+        type: 'line',
+        data: {
+            labels: memData.map(p => p.time),
+            datasets: [{
+                data: memData.map(p => p.value),
+                borderColor: '#f5576c',
+                backgroundColor: 'rgba(245,87,108,0.1)',
+                fill: true,
+                tension: 0.4,
+                pointRadius: 0
+            }]
+        },
+        options: chartOptions
+    });
+}
+
+function updateLogs(level) {
+    const box = document.getElementById('logLines');
+    if (!box) return;
+    const status = document.getElementById('logsStatus');
+    fetch('/api/v1/logs?level=' + level)
+        .then(r => r.json())
+        .then(data => {
+            box.textContent = '';
+            if (data.error) {
+                status.textContent = data.error;
+                status.className = 'logs-status error';
+                return;
+            }
+            status.textContent = data.lines.length + ' lines from Loki';
+            status.className = 'logs-status';
+            data.lines.forEach(l => {
+                const row = document.createElement('div');
+                row.className = 'log-line lvl-' + l.level;
+                const ts = document.createElement('span');
+                ts.className = 'log-time';
+                ts.textContent = new Date(l.time).toLocaleString();
+                row.appendChild(ts);
+                row.appendChild(document.createTextNode(l.line));
+                box.appendChild(row);
+            });
+            if (!data.lines.length) box.textContent = 'No matching log lines.';
+        })
+        .catch(err => {
+            status.textContent = 'logs unavailable: ' + err;
+            status.className = 'logs-status error';
+        });
+}
+
+document.querySelectorAll('.logs-tab').forEach(tab => {
+    tab.addEventListener('click', () => {
+        document.querySelectorAll('.logs-tab').forEach(t => t.classList.remove('active'));
+        tab.classList.add('active');
+        updateLogs(tab.dataset.level);
+    });
+});
+updateLogs('');
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"landing/textview"
+)
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// writeTextSummary is the terminal version of the page: container state,
+// library counts, host stats and addresses, coloured when ansi is set
+func writeTextSummary(w io.Writer, data PageData, ansi bool) {
+	p := textview.Painter(ansi)
+	row := func(label, value string) {
+		fmt.Fprintf(w, "  %s %s\n", p.Paint(textview.Dim, textview.Pad(label, 12)), value)
+	}
+	bar := func(pct float64) string {
+		return textview.UsageBar(p, pct) + fmt.Sprintf(" %5.1f%%", pct)
+	}
+
+	fmt.Fprintf(w, "%s  %s\n\n", p.Paint(textview.Bold+textview.Blue, "Komga "+data.System.Hostname), p.Paint(textview.Dim, data.Updated))
+
+	k := data.Komga
+	state := k.ContainerState
+	if k.ContainerHealth != "" {
+		state += " (" + k.ContainerHealth + ")"
+	}
+	style := textview.Red
+	if k.ContainerState == "running" && (k.ContainerHealth == "" || k.ContainerHealth == "healthy") {
+		style = textview.Green
+	} else if k.ContainerState == "running" {
+		style = textview.Yellow
+	}
+	row("Container", p.Paint(textview.Bold+style, state))
+	if k.Error != "" {
+		row("Komga API", p.Paint(textview.Red, k.Error))
+	} else {
+		row("Library", fmt.Sprintf("%d libraries, %d series, %d books", k.Libraries, k.Series, k.Books))
+	}
+	fmt.Fprintln(w)
+
+	s := data.System
+	row("CPU", bar(s.CPUPercent))
+	row("Memory", bar(s.MemPercent)+p.Paint(textview.Dim, "  "+formatBytes(s.MemUsed)+" / "+formatBytes(s.MemTotal)))
+	row("Disk", bar(s.DiskPercent)+p.Paint(textview.Dim, "  "+formatBytes(s.DiskUsed)+" / "+formatBytes(s.DiskTotal)))
+	row("Load average", s.LoadAvg)
+	row("Uptime", s.Uptime)
+	row("OS / kernel", s.OS+", "+s.Kernel)
+	fmt.Fprintln(w)
+
+	n := data.Network
+	if len(n.IPv4) > 0 {
+		row("IPv4", strings.Join(n.IPv4, ", "))
+	}
+	for _, a := range n.IPv6 {
+		row("IPv6", a.Address+p.Paint(textview.Dim, " "+a.Kind))
+	}
+	if n.DNSName != "" {
+		aaaa := p.Paint(textview.Green, "matches")
+		if !n.AAAAMatch {
+			aaaa = p.Paint(textview.Red, "does not match")
+		}
+		row("DNS", n.DNSName+" AAAA "+aaaa)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"landing/textview"
+)
+
+func testSummaryData() PageData {
+	return PageData{
+		System: SystemStats{
+			Hostname: "komga", Uptime: "3d 4h", CPUPercent: 12.5,
+			MemUsed: 3 << 30, MemTotal: 8 << 30, MemPercent: 37.5,
+			DiskUsed: 900 << 30, DiskTotal: 1000 << 30, DiskPercent: 90.0,
+			LoadAvg: "0.42 0.30 0.25", OS: "Debian GNU/Linux 12", Kernel: "6.1.0-18-amd64",
+		},
+		Komga: KomgaStats{Libraries: 3, Series: 412, Books: 5120, ContainerState: "running", ContainerHealth: "healthy"},
+		Network: NetworkInfo{
+			IPv4:      []string{"172.16.16.40"},
+			IPv6:      []NetAddr{{Address: "2a02:1210::40", Kind: "stable"}},
+			DNSName:   "komga.alpina",
+			AAAAMatch: true,
+		},
+		Updated: "2026-10-19 12:00:00",
+	}
+}
+
+func TestTextSummaryPlain(t *testing.T) {
+	var buf bytes.Buffer
+	writeTextSummary(&buf, testSummaryData(), false)
+	out := buf.String()
+	if strings.Contains(out, "\x1b[") {
+		t.Error("plain summary contains escape codes")
+	}
+	for _, want := range []string{
+		"Komga komga  2026-10-19 12:00:00\n",
+		"  Container    running (healthy)\n",
+		"  Library      3 libraries, 412 series, 5120 books\n",
+		"  CPU          [###                 ]  12.5%\n",
+		"  Memory       [########            ]  37.5%  3.0 GB / 8.0 GB\n",
+		"  Disk         [##################  ]  90.0%  900.0 GB / 1000.0 GB\n",
+		"  IPv4         172.16.16.40\n",
+		"  IPv6         2a02:1210::40 stable\n",
+		"  DNS          komga.alpina AAAA matches\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTextSummaryANSI(t *testing.T) {
+	data := testSummaryData()
+	data.Komga.ContainerHealth = "unhealthy"
+	data.Komga.Error = "connection refused"
+	data.System.DiskPercent = 95
+	data.Network.AAAAMatch = false
+	var buf bytes.Buffer
+	writeTextSummary(&buf, data, true)
+	out := buf.String()
+	for _, want := range []string{
+		textview.Bold + textview.Blue + "Komga komga" + textview.Reset,
+		textview.Bold + textview.Yellow + "running (unhealthy)" + textview.Reset,
+		textview.Red + "connection refused" + textview.Reset,
+		"[" + textview.Red + "###################" + textview.Reset + " ]  95.0%",
+		"AAAA " + textview.Red + "does not match" + textview.Reset,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%q", want, out)
+		}
+	}
+	if strings.Contains(out, "Library") {
+		t.Error("library counts shown although the Komga API failed")
+	}
+
+	data.Komga.ContainerState = "exited"
+	buf.Reset()
+	writeTextSummary(&buf, data, true)
+	if !strings.Contains(buf.String(), textview.Bold+textview.Red+"exited (unhealthy)") {
+		t.Errorf("stopped container not red:\n%q", buf.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for b, want := range map[uint64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1536:      "1.5 KB",
+		3 << 30:   "3.0 GB",
+		5 << 40:   "5.0 TB",
+		1<<20 - 1: "1024.0 KB",
+	} {
+		if got := formatBytes(b); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", b, got, want)
+		}
+	}
+}
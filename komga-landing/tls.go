@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"landing/listen"
+)
+
+// hstsMaxAge is announced on TLS responses
+const hstsMaxAge = 180 * 24 * time.Hour
+
+// openPaths are used by stats probes and Prometheus scrapes. They skip
+// auth and are still answered over HTTP when it redirects to HTTPS, so
+// checks set up before either was enabled keep working.
+var openPaths = map[string]bool{"/api/stats": true, "/api/v1/stats": true, "/metrics": true}
+
+// tlsHandlers wraps pages for the TLS listeners and builds the plain HTTP
+// handler that redirects to tlsPort, serving openPaths from mux
+func tlsHandlers(mux, pages http.Handler, tlsPort string) (secure, redirect http.Handler) {
+	return listen.HSTS(hstsMaxAge, pages), listen.RedirectHTTPS(tlsPort, openPaths, mux)
+}
+
+// watchCerts loads the certificate pair and reloads it on SIGHUP or when
+// either file changes, polled every interval, until ctx is cancelled
+func watchCerts(ctx context.Context, certFile, keyFile string, interval time.Duration) (*listen.CertReloader, error) {
+	certs, err := listen.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	// registered before the watcher starts so an early SIGHUP cannot kill
+	// the process
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		certs.Watch(ctx, interval, hup)
+		signal.Stop(hup)
+	}()
+	return certs, nil
+}
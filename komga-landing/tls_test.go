@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"landing/listen"
+	"landing/listen/listentest"
+)
+
+// servedCN returns the common name of the certificate srv presents. SNI is
+// sent because httptest's own certificate wins for clients without it.
+func servedCN(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{ServerName: "komga.example", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func waitForCN(t *testing.T, srv *httptest.Server, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCN(t, srv) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("still serving %q, want %q", servedCN(t, srv), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func startTLS(t *testing.T, certs *listen.CertReloader, h http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(h)
+	srv.TLS = listen.TLSConfig(certs)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWatchCertsReloads(t *testing.T) {
+	dir := t.TempDir()
+	listentest.WriteCert(t, dir, "old", time.Now().Add(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	certs, err := watchCerts(ctx, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startTLS(t, certs, http.NotFoundHandler())
+	if cn := servedCN(t, srv); cn != "old" {
+		t.Fatalf("serving %q", cn)
+	}
+
+	// a rewritten pair is picked up by polling
+	listentest.WriteCert(t, dir, "polled", time.Now().Add(time.Hour))
+	future := time.Now().Add(time.Minute)
+	for _, f := range []string{"tls.crt", "tls.key"} {
+		os.Chtimes(filepath.Join(dir, f), future, future)
+	}
+	waitForCN(t, srv, "polled")
+}
+
+func TestWatchCertsSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	listentest.WriteCert(t, dir, "old", time.Now().Add(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	certs, err := watchCerts(ctx, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startTLS(t, certs, http.NotFoundHandler())
+
+	// the modification time is left in the past, so only the signal can
+	// trigger the reload
+	listentest.WriteCert(t, dir, "hup", time.Now().Add(time.Hour))
+	past := time.Now().Add(-time.Hour)
+	for _, f := range []string{"tls.crt", "tls.key"} {
+		os.Chtimes(filepath.Join(dir, f), past, past)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitForCN(t, srv, "hup")
+}
+
+func TestWatchCertsMissing(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := watchCerts(context.Background(), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), time.Hour); err == nil {
+		t.Fatal("missing pair loaded")
+	}
+}
+
+func TestTLSHandlers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("page")) })
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("metrics")) })
+	secure, redirect := tlsHandlers(mux, mux, "8443")
+
+	dir := t.TempDir()
+	listentest.WriteCert(t, dir, "komga", time.Now().Add(time.Hour))
+	certs, err := listen.NewCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startTLS(t, certs, secure)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "max-age=15552000" {
+		t.Errorf("HSTS over TLS = %q", hsts)
+	}
+
+	// plain responses never carry HSTS
+	rec := httptest.NewRecorder()
+	secure.ServeHTTP(rec, httptest.NewRequest("GET", "http://komga.example/", nil))
+	if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("HSTS over HTTP = %q", hsts)
+	}
+
+	for _, tc := range []struct {
+		url, location string
+		code          int
+	}{
+		{"http://komga.example/series?page=2", "https://komga.example:8443/series?page=2", http.StatusPermanentRedirect},
+		{"http://komga.example:8080/", "https://komga.example:8443/", http.StatusPermanentRedirect},
+		{"http://[fd00::1]/", "https://[fd00::1]:8443/", http.StatusPermanentRedirect},
+		{"http://komga.example/metrics", "", http.StatusOK},
+		{"http://komga.example/api/v1/stats", "", http.StatusOK},
+		{"http://komga.example/api/stats", "", http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		redirect.ServeHTTP(rec, httptest.NewRequest("GET", tc.url, nil))
+		if rec.Code != tc.code || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s: %d to %q, want %d to %q", tc.url, rec.Code, rec.Header().Get("Location"), tc.code, tc.location)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+// Package api holds what the landing pages' JSON APIs have in common
+// across versions.
+package api
+
+import "net/http"
+
+// DeprecatedSince is when the unversioned /api/ paths were deprecated, as
+// an RFC 9745 Deprecation date (2026-10-19)
+const DeprecatedSince = "@1792368000"
+
+// DeprecatedAlias answers like h for an unversioned /api/ path, with a
+// Deprecation header and a Link pointing clients at successor
+func DeprecatedAlias(successor string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", DeprecatedSince)
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		h(w, r)
+	}
+}
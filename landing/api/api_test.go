@@ -0,0 +1,26 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeprecatedAlias(t *testing.T) {
+	h := DeprecatedAlias("/api/v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"error":"x"}`)
+	})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/api/stats", nil))
+	if rec.Header().Get("Deprecation") != DeprecatedSince {
+		t.Errorf("Deprecation = %q", rec.Header().Get("Deprecation"))
+	}
+	if link := rec.Header().Get("Link"); link != `</api/v1/stats>; rel="successor-version"` {
+		t.Errorf("Link = %q", link)
+	}
+	if rec.Body.String() != `{"error":"x"}` || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("body %q, type %q", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+}
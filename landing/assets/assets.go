@@ -0,0 +1,155 @@
+// Package assets serves the landing pages' embedded front-end files and
+// checks the vendored ones against the checksums recorded when they were
+// downloaded.
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// SumsFile lists the SHA-256 of the vendored files in sha256sum format. It
+// sits next to them in the embedded directory and is not served.
+const SumsFile = "SHA256SUMS"
+
+// file is one embedded file and its content hash
+type file struct {
+	data    []byte
+	sum     string
+	etag    string
+	version string
+	ctype   string
+}
+
+// Assets serves embedded front-end files. Pages link them with the content
+// hash as ?v=, so those URLs are cached as immutable; requests without a
+// matching version are revalidated against the ETag.
+type Assets struct {
+	files map[string]file
+	sums  map[string]string
+}
+
+// New hashes every file in fsys and reads SumsFile if there is one
+func New(fsys fs.FS) (*Assets, error) {
+	a := &Assets{files: map[string]file{}, sums: map[string]string{}}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if name == SumsFile {
+			return a.parseSums(data)
+		}
+		sum := sha256.Sum256(data)
+		hexSum := hex.EncodeToString(sum[:])
+		version := hexSum[:12]
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = http.DetectContentType(data)
+		}
+		a.files[name] = file{data: data, sum: hexSum, etag: `"` + version + `"`, version: version, ctype: ctype}
+		return nil
+	})
+	return a, err
+}
+
+// Must is New for the embedded directory dir, panicking on errors
+func Must(fsys fs.FS, dir string) *Assets {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	a, err := New(sub)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// parseSums reads "<sha256>  <name>" lines as written by sha256sum
+func (a *Assets) parseSums(data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if !ok || len(sum) != sha256.Size*2 || name == "" {
+			return fmt.Errorf("%s:%d: malformed line", SumsFile, n)
+		}
+		a.sums[name] = strings.ToLower(sum)
+	}
+	return sc.Err()
+}
+
+// URL is the versioned link for name, used by the asset template func
+func (a *Assets) URL(name string) string {
+	if f, ok := a.files[name]; ok {
+		return "/static/" + name + "?v=" + f.version
+	}
+	return "/static/" + name
+}
+
+// Has reports whether name was embedded
+func (a *Assets) Has(name string) bool {
+	_, ok := a.files[name]
+	return ok
+}
+
+// Verify checks that every vendored file was embedded and matches the
+// checksum recorded for it, so a build missing Chart.js or carrying a
+// different copy is caught before it serves pages whose charts cannot run
+func (a *Assets) Verify(vendored []string) error {
+	var errs []error
+	for _, name := range vendored {
+		f, ok := a.files[name]
+		want, recorded := a.sums[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s is not embedded; run go generate", name))
+		case !recorded:
+			errs = append(errs, fmt.Errorf("%s has no checksum in %s", name, SumsFile))
+		case f.sum != want:
+			errs = append(errs, fmt.Errorf("%s has SHA-256 %s, %s records %s", name, f.sum, SumsFile, want))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, ok := a.files[strings.TrimPrefix(r.URL.Path, "/static/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", f.ctype)
+	h.Set("ETag", f.etag)
+	if r.URL.Query().Get("v") == f.version {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+	// ServeContent answers If-None-Match with 304 using the ETag above
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(f.data))
+}
@@ -0,0 +1,135 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticAssets(t *testing.T) {
+	a, err := New(fstest.MapFS{
+		"app.js":    {Data: []byte("console.log(1);\n")},
+		"style.css": {Data: []byte("body{color:red}\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := a.URL("app.js")
+	if !strings.HasPrefix(url, "/static/app.js?v=") {
+		t.Fatalf("URL = %q", url)
+	}
+	if got := a.URL("nope.js"); got != "/static/nope.js" {
+		t.Errorf("URL for unknown file = %q", got)
+	}
+
+	get := func(target, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(url, "")
+	if rec.Code != 200 || rec.Body.String() != "console.log(1);\n" {
+		t.Fatalf("GET %s = %d %q", url, rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("versioned Cache-Control = %q", cc)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	rec = get("/static/app.js", "")
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("unversioned Cache-Control = %q", cc)
+	}
+	if rec := get("/static/app.js?v=stale", ""); rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("stale version cached as %q", rec.Header().Get("Cache-Control"))
+	}
+
+	rec = get("/static/app.js", etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match = %d with %d bytes, want 304", rec.Code, rec.Body.Len())
+	}
+	if rec := get("/static/style.css", etag); rec.Code != 200 {
+		t.Errorf("other file's ETag gave %d", rec.Code)
+	}
+	if rec := get("/static/missing.js", ""); rec.Code != 404 {
+		t.Errorf("missing file = %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/static/app.js", nil)
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", rec.Code)
+	}
+}
+
+func TestSumsFileNotServed(t *testing.T) {
+	a, err := New(fstest.MapFS{SumsFile: {Data: []byte("")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest("GET", "/static/"+SumsFile, nil))
+	if rec.Code != 404 || a.Has(SumsFile) {
+		t.Errorf("GET %s = %d", SumsFile, rec.Code)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	chart := []byte("/* chart */\n")
+	sum := sha256.Sum256(chart)
+	good := hex.EncodeToString(sum[:])
+
+	for _, tc := range []struct {
+		name string
+		fsys fstest.MapFS
+		err  string
+	}{
+		{"recorded", fstest.MapFS{
+			"chart.js": {Data: chart},
+			SumsFile:   {Data: []byte(good + "  chart.js\n")},
+		}, ""},
+		{"binary mode", fstest.MapFS{
+			"chart.js": {Data: chart},
+			SumsFile:   {Data: []byte(strings.ToUpper(good) + " *chart.js\n")},
+		}, ""},
+		{"missing", fstest.MapFS{
+			SumsFile: {Data: []byte(good + "  chart.js\n")},
+		}, "chart.js is not embedded"},
+		{"unrecorded", fstest.MapFS{
+			"chart.js": {Data: chart},
+		}, "chart.js has no checksum"},
+		{"changed", fstest.MapFS{
+			"chart.js": {Data: []byte("/* other */\n")},
+			SumsFile:   {Data: []byte(good + "  chart.js\n")},
+		}, "SHA256SUMS records " + good},
+	} {
+		a, err := New(tc.fsys)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		err = a.Verify([]string{"chart.js"})
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: Verify = %v, want %q", tc.name, err, tc.err)
+		}
+	}
+
+	if _, err := New(fstest.MapFS{SumsFile: {Data: []byte("deadbeef chart.js\n")}}); err == nil {
+		t.Error("malformed SHA256SUMS accepted")
+	}
+}
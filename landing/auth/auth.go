@@ -0,0 +1,316 @@
+// Package auth identifies the user behind a landing page request: HTTP
+// Basic credentials checked against hashed passwords, a user header set
+// by a trusted reverse proxy, or a whois lookup at the local tailscaled.
+// Which users get in is up to the page.
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Identifier finds the user behind a request. An anonymous request gives
+// "" and no error; credentials that were presented but are wrong give the
+// claimed user and ErrBadCredentials.
+type Identifier interface {
+	Identify(r *http.Request) (string, error)
+}
+
+// ErrBadCredentials is returned for a wrong user or password
+var ErrBadCredentials = errors.New("bad credentials")
+
+// PasswordHash is "sha256:<hex>" (or bare hex) or
+// "pbkdf2-sha256:<iterations>:<base64 salt>:<base64 key>"
+type PasswordHash struct {
+	Iterations int // 0 for plain SHA-256
+	Salt, Key  []byte
+}
+
+// ParsePasswordHash reads either form of PasswordHash
+func ParsePasswordHash(s string) (PasswordHash, error) {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "pbkdf2-sha256:"); ok {
+		parts := strings.Split(rest, ":")
+		if len(parts) != 3 {
+			return PasswordHash{}, errors.New("pbkdf2-sha256 hash must be iterations:salt:key")
+		}
+		iter, err := strconv.Atoi(parts[0])
+		if err != nil || iter < 1 {
+			return PasswordHash{}, fmt.Errorf("bad pbkdf2 iterations %q", parts[0])
+		}
+		salt, err1 := base64.StdEncoding.DecodeString(parts[1])
+		key, err2 := base64.StdEncoding.DecodeString(parts[2])
+		if err1 != nil || err2 != nil || len(key) == 0 {
+			return PasswordHash{}, errors.New("pbkdf2 salt and key must be base64")
+		}
+		return PasswordHash{Iterations: iter, Salt: salt, Key: key}, nil
+	}
+	h, err := hex.DecodeString(strings.TrimPrefix(s, "sha256:"))
+	if err != nil || len(h) != sha256.Size {
+		return PasswordHash{}, errors.New("password hash must be a hex SHA-256 digest or pbkdf2-sha256")
+	}
+	return PasswordHash{Key: h}, nil
+}
+
+// Match reports whether pass hashes to h, in constant time
+func (h PasswordHash) Match(pass string) bool {
+	var got []byte
+	if h.Iterations == 0 {
+		sum := sha256.Sum256([]byte(pass))
+		got = sum[:]
+	} else {
+		var err error
+		got, err = pbkdf2.Key(sha256.New, pass, h.Salt, h.Iterations, len(h.Key))
+		if err != nil {
+			return false
+		}
+	}
+	return subtle.ConstantTimeCompare(got, h.Key) == 1
+}
+
+// BasicCredentials checks HTTP Basic credentials against hashed passwords.
+// Successful checks are remembered for a few minutes because browsers send
+// the credentials with every request and PBKDF2 is deliberately slow.
+type BasicCredentials struct {
+	Users map[string]PasswordHash
+
+	mu       sync.Mutex
+	verified map[[32]byte]time.Time
+}
+
+// LoadCredentialsFile reads user:hash lines; blank lines and # comments
+// are skipped. A PBKDF2 entry can be made with
+//
+//	python3 -c 'import hashlib,os,base64,getpass; s=os.urandom(16); print("pbkdf2-sha256:600000:%s:%s" % (base64.b64encode(s).decode(), base64.b64encode(hashlib.pbkdf2_hmac("sha256", getpass.getpass().encode(), s, 600000)).decode()))'
+func LoadCredentialsFile(path string) (*BasicCredentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := &BasicCredentials{Users: map[string]PasswordHash{}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: want user:hash", path, n)
+		}
+		h, err := ParsePasswordHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		c.Users[user] = h
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.Users) == 0 {
+		return nil, fmt.Errorf("%s: no users", path)
+	}
+	return c, nil
+}
+
+// Check verifies the request's Basic credentials
+func (c *BasicCredentials) Check(r *http.Request) (string, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + pass))
+	c.mu.Lock()
+	if exp, ok := c.verified[key]; ok && time.Now().Before(exp) {
+		c.mu.Unlock()
+		return user, true
+	}
+	c.mu.Unlock()
+
+	h, known := c.Users[user]
+	if !known || !h.Match(pass) {
+		return user, false
+	}
+	c.mu.Lock()
+	if c.verified == nil || len(c.verified) > 1000 {
+		c.verified = map[[32]byte]time.Time{}
+	}
+	c.verified[key] = time.Now().Add(5 * time.Minute)
+	c.mu.Unlock()
+	return user, true
+}
+
+func (c *BasicCredentials) Identify(r *http.Request) (string, error) {
+	if _, _, sent := r.BasicAuth(); !sent {
+		return "", nil
+	}
+	user, ok := c.Check(r)
+	if !ok {
+		return user, ErrBadCredentials
+	}
+	return user, nil
+}
+
+// HeaderIdentity trusts a user header set by a reverse proxy (e.g.
+// Tailscale-User-Login from tailscale serve). The header is ignored unless
+// the connection comes from one of the Trusted proxies.
+type HeaderIdentity struct {
+	Header  string
+	Trusted []netip.Prefix
+}
+
+func (h *HeaderIdentity) Identify(r *http.Request) (string, error) {
+	addr, err := netip.ParseAddr(remoteHost(r))
+	if err != nil {
+		return "", nil
+	}
+	addr = addr.Unmap()
+	for _, p := range h.Trusted {
+		if p.Contains(addr) {
+			return strings.TrimSpace(r.Header.Get(h.Header)), nil
+		}
+	}
+	return "", nil
+}
+
+// ParsePrefixes reads CIDR prefixes; a bare address is a single host
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			a, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// TailscaleWhois asks the local tailscaled which tailnet user owns the
+// connecting address. This needs tailscaled on this host: behind the
+// OPNsense subnet router, connections arrive from the router's LAN
+// address and stay anonymous.
+type TailscaleWhois struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]whoisEntry
+}
+
+type whoisEntry struct {
+	user    string
+	expires time.Time
+}
+
+// NewTailscaleWhois talks to tailscaled on socket and remembers answers
+// for ttl
+func NewTailscaleWhois(socket string, ttl time.Duration) *TailscaleWhois {
+	return &TailscaleWhois{
+		client: &http.Client{
+			Timeout: 2 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		ttl:   ttl,
+		cache: map[string]whoisEntry{},
+	}
+}
+
+func (t *TailscaleWhois) Identify(r *http.Request) (string, error) {
+	host := remoteHost(r)
+	t.mu.Lock()
+	e, ok := t.cache[host]
+	t.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.user, nil
+	}
+	user, err := t.whois(r.Context(), r.RemoteAddr)
+	if err != nil {
+		// tailscaled being down must not lock anyone out of the read-only
+		// pages, so the caller is treated as anonymous
+		slog.Warn("tailscale whois failed", "component", "auth", "remote", host, "error", err)
+		return "", nil
+	}
+	t.mu.Lock()
+	if len(t.cache) > 1000 {
+		t.cache = map[string]whoisEntry{}
+	}
+	t.cache[host] = whoisEntry{user: user, expires: time.Now().Add(t.ttl)}
+	t.mu.Unlock()
+	return user, nil
+}
+
+// whois returns the login name for addr, or "" when it is not a tailnet
+// peer or is a tagged device
+func (t *TailscaleWhois) whois(ctx context.Context, addr string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://local-tailscaled.sock/localapi/v0/whois?addr="+url.QueryEscape(addr), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("whois: %s", resp.Status)
+	}
+	var who struct {
+		Node struct {
+			Tags []string
+		}
+		UserProfile struct {
+			LoginName string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&who); err != nil {
+		return "", err
+	}
+	if len(who.Node.Tags) > 0 {
+		return "", nil
+	}
+	return who.UserProfile.LoginName, nil
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
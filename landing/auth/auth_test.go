@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"landing/auth/authtest"
+)
+
+func TestPasswordHash(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	for _, s := range []string{hex.EncodeToString(sum[:]), "sha256:" + hex.EncodeToString(sum[:]), authtest.PBKDF2Entry(t, "s3cret")} {
+		h, err := ParsePasswordHash(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if !h.Match("s3cret") || h.Match("wrong") {
+			t.Errorf("%s: Match wrong", s)
+		}
+	}
+	for _, bad := range []string{"", "abc", "pbkdf2-sha256:x:AAAA:AAAA", "pbkdf2-sha256:1000:AAAA", "pbkdf2-sha256:1000:!!:AAAA"} {
+		if _, err := ParsePasswordHash(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestLoadCredentialsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	content := "# landing users\n\nalice:" + authtest.PBKDF2Entry(t, "wonderland") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCredentialsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", "wonderland")
+	if user, ok := c.Check(req); !ok || user != "alice" {
+		t.Errorf("Check = %q %v", user, ok)
+	}
+	// served from the verified cache the second time
+	if _, ok := c.Check(req); !ok {
+		t.Error("cached Check failed")
+	}
+	req.SetBasicAuth("alice", "rabbit")
+	if _, ok := c.Check(req); ok {
+		t.Error("wrong password accepted")
+	}
+
+	os.WriteFile(path, []byte("alice\n"), 0o600)
+	if _, err := LoadCredentialsFile(path); err == nil {
+		t.Error("line without hash accepted")
+	}
+	os.WriteFile(path, []byte("# nobody\n"), 0o600)
+	if _, err := LoadCredentialsFile(path); err == nil {
+		t.Error("empty file accepted")
+	}
+}
+
+func TestHeaderIdentity(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"127.0.0.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &HeaderIdentity{Header: "Tailscale-User-Login", Trusted: trusted}
+	for remote, want := range map[string]string{
+		"127.0.0.1:5000":        "alice@github",
+		"[fd00::5]:5000":        "alice@github",
+		"[::ffff:127.0.0.1]:80": "alice@github",
+		"172.16.16.50:5000":     "", // spoofed header from a LAN client
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Tailscale-User-Login", "alice@github")
+		if got, err := h.Identify(req); got != want || err != nil {
+			t.Errorf("%s: %q %v, want %q", remote, got, err, want)
+		}
+	}
+}
+
+func TestTailscaleWhois(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "tailscaled.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix socket: %v", err)
+	}
+	var calls atomic.Int32
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/localapi/v0/whois" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("addr") {
+		case "100.64.0.5:41000":
+			json.NewEncoder(w).Encode(map[string]any{"Node": map[string]any{"Name": "phone."}, "UserProfile": map[string]any{"LoginName": "alice@github"}})
+		case "100.64.0.9:41000":
+			json.NewEncoder(w).Encode(map[string]any{"Node": map[string]any{"Tags": []string{"tag:server"}}, "UserProfile": map[string]any{"LoginName": "tagged-devices"}})
+		default:
+			http.Error(w, "no match for IP:port", http.StatusNotFound)
+		}
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	ts := NewTailscaleWhois(socket, time.Minute)
+	identify := func(remote string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		user, err := ts.Identify(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	if got := identify("100.64.0.5:41000"); got != "alice@github" {
+		t.Errorf("tailnet user = %q", got)
+	}
+	if got := identify("100.64.0.9:41000"); got != "" {
+		t.Errorf("tagged device = %q", got)
+	}
+	if got := identify("172.16.16.50:5000"); got != "" {
+		t.Errorf("LAN client = %q", got)
+	}
+	before := calls.Load()
+	identify("100.64.0.5:41000")
+	if calls.Load() != before {
+		t.Error("whois not cached")
+	}
+
+	down := NewTailscaleWhois(filepath.Join(t.TempDir(), "missing.sock"), time.Minute)
+	req := httptest.NewRequest("GET", "/", nil)
+	if user, err := down.Identify(req); user != "" || err != nil {
+		t.Errorf("tailscaled down: %q %v", user, err)
+	}
+}
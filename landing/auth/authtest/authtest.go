@@ -0,0 +1,23 @@
+// Package authtest makes users-file entries for tests of code that
+// authenticates through package auth.
+package authtest
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+// PBKDF2Entry hashes pass the way a users file stores it, with a fixed
+// salt and few iterations to keep tests fast
+func PBKDF2Entry(t *testing.T, pass string) string {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, pass, salt, 1000, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256:1000:%s:%s", base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key))
+}
@@ -0,0 +1,3 @@
+module landing
+
+go 1.25.6
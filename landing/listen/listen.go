@@ -0,0 +1,223 @@
+// Package listen opens the landing pages' sockets and serves them over
+// TLS: listen addresses, a reloading certificate, the HTTP to HTTPS
+// redirect and HSTS.
+package listen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Network picks the socket family for a listen address. A literal
+// IPv6 address gets an IPV6_V6ONLY socket so it never also accepts IPv4,
+// a literal IPv4 address an AF_INET one; an empty host (":80") keeps Go's
+// dual-stack wildcard socket.
+func Network(addr string) (string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i] // zone of a link-local address
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case host == "":
+		return "tcp", nil
+	case ip == nil:
+		return "tcp", nil
+	case ip.To4() != nil:
+		return "tcp4", nil
+	}
+	return "tcp6", nil
+}
+
+// All opens every configured address, closing those already opened when
+// one fails
+func All(addrs []string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		network, err := Network(addr)
+		if err == nil {
+			var ln net.Listener
+			ln, err = net.Listen(network, addr)
+			if err == nil {
+				listeners = append(listeners, ln)
+				continue
+			}
+		}
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return nil, err
+	}
+	return listeners, nil
+}
+
+// CertReloader serves the certificate from certFile/keyFile and swaps it
+// when the files change or on SIGHUP. A broken pair (e.g. key written but
+// certificate not yet) is logged and the previous certificate kept.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	notAfter time.Time
+	certMod  time.Time
+	keyMod   time.Time
+}
+
+// NewCertReloader loads the pair, failing when it cannot be read
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the pair from disk
+func (r *CertReloader) Reload() error {
+	certMod, keyMod := modTime(r.certFile), modTime(r.keyFile)
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+	r.mu.Lock()
+	r.cert = &cert
+	r.notAfter = leaf.NotAfter
+	r.certMod, r.keyMod = certMod, keyMod
+	r.mu.Unlock()
+	slog.Info("TLS certificate loaded", "component", "tls",
+		"subject", leaf.Subject.CommonName, "dns", leaf.DNSNames, "not_after", leaf.NotAfter)
+	return nil
+}
+
+// changed reports whether either file was modified since the last load
+func (r *CertReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime(r.certFile).Equal(r.certMod) || !modTime(r.keyFile).Equal(r.keyMod)
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// NotAfter is the expiry of the certificate being served
+func (r *CertReloader) NotAfter() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.notAfter
+}
+
+// Watch reloads when the files change (polled every interval) or a value
+// arrives on hup, until ctx is cancelled
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, hup <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.Reload(); err != nil {
+			slog.Error("TLS certificate reload failed, keeping the previous one", "component", "tls", "error", err)
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// TLSConfig serves certificates from r
+func TLSConfig(r *CertReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// RedirectHTTPS sends plain HTTP requests to the HTTPS listener on
+// tlsPort. Requests for the probes paths are still handed to plain and
+// served over HTTP, so blackbox checks and Prometheus scrapes configured
+// before TLS keep working.
+func RedirectHTTPS(tlsPort string, probes map[string]bool, plain http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probes[r.URL.Path] {
+			plain.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "missing Host header", http.StatusBadRequest)
+			return
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		if tlsPort != "443" {
+			host += ":" + tlsPort
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// HSTS sets Strict-Transport-Security on responses sent over TLS
+func HSTS(maxAge time.Duration, next http.Handler) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TLSPort returns the port of the first TLS listen address, used to build
+// redirect targets
+func TLSPort(addrs []string) (string, error) {
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no TLS listen address")
+	}
+	_, port, err := net.SplitHostPort(addrs[0])
+	if err != nil {
+		return "", err
+	}
+	return port, nil
+}
@@ -0,0 +1,62 @@
+package listen
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNetwork(t *testing.T) {
+	cases := map[string]string{
+		":80":                           "tcp",
+		"0.0.0.0:80":                    "tcp4",
+		"172.16.16.108:80":              "tcp4",
+		"[::]:80":                       "tcp6",
+		"[2603:8001:7400:fa9a::108]:80": "tcp6",
+		"[fe80::1%eth0]:80":             "tcp6",
+		"ntp.alpina:80":                 "tcp",
+	}
+	for addr, want := range cases {
+		if got, err := Network(addr); err != nil || got != want {
+			t.Errorf("Network(%q) = %q, %v; want %q", addr, got, err, want)
+		}
+	}
+	if _, err := Network("172.16.16.108"); err == nil {
+		t.Error("address without port accepted")
+	}
+}
+
+func TestAll(t *testing.T) {
+	addrs := []string{"127.0.0.1:0"}
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+		ln.Close()
+		addrs = append(addrs, "[::1]:0")
+	}
+	listeners, err := All(addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	defer srv.Close()
+	for _, ln := range listeners {
+		go srv.Config.Serve(ln)
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Errorf("GET via %s: %v", ln.Addr(), err)
+			continue
+		}
+		resp.Body.Close()
+	}
+
+	// a bad address closes the listeners already opened
+	taken := listeners[0].Addr().String()
+	if _, err := All([]string{"127.0.0.1:0", taken}); err == nil {
+		t.Errorf("listening twice on %s succeeded", taken)
+	}
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
@@ -0,0 +1,136 @@
+package listen
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"landing/listen/listentest"
+)
+
+func TestCertReloaderServesAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	first := listentest.WriteCert(t, dir, "ntp.alpina", time.Now().Add(24*time.Hour))
+	certs, err := NewCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(HSTS(180*24*time.Hour, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+	srv.TLS = TLSConfig(certs)
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(trust *x509.Certificate) (*http.Response, error) {
+		pool := x509.NewCertPool()
+		pool.AddCert(trust)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "ntp.alpina"}}}
+		return client.Get(srv.URL)
+	}
+	resp, err := get(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=15552000" {
+		t.Errorf("HSTS = %q", got)
+	}
+
+	// a rotated pair is picked up by the file watcher
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	go certs.Watch(ctx, 10*time.Millisecond, hup)
+
+	second := listentest.WriteCert(t, dir, "ntp.alpina", time.Now().Add(48*time.Hour))
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "tls.crt"), future, future)
+	deadline := time.Now().Add(2 * time.Second)
+	for !certs.NotAfter().Equal(second.NotAfter) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !certs.NotAfter().Equal(second.NotAfter) {
+		t.Fatal("rotated certificate not loaded")
+	}
+	if resp, err := get(second); err != nil {
+		t.Errorf("after rotation: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// a broken pair keeps the current certificate; with polling out of the
+	// way only SIGHUP can load the next one
+	cancel()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go certs.Watch(ctx, time.Hour, hup)
+	os.WriteFile(filepath.Join(dir, "tls.key"), []byte("garbage"), 0o600)
+	if err := certs.Reload(); err == nil {
+		t.Error("reload of broken pair succeeded")
+	}
+	if !certs.NotAfter().Equal(second.NotAfter) {
+		t.Error("broken reload replaced the certificate")
+	}
+	third := listentest.WriteCert(t, dir, "ntp.alpina", time.Now().Add(72*time.Hour))
+	hup <- os.Interrupt
+	deadline = time.Now().Add(2 * time.Second)
+	for !certs.NotAfter().Equal(third.NotAfter) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !certs.NotAfter().Equal(third.NotAfter) {
+		t.Error("SIGHUP did not reload")
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	if _, err := NewCertReloader("testdata/none.crt", "testdata/none.key"); err == nil {
+		t.Error("missing files accepted")
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	plain := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	})
+	probes := map[string]bool{"/status/ntp": true}
+	cases := []struct {
+		port, host, path, want string
+	}{
+		{"443", "ntp.alpina", "/api/charts?range=7d", "https://ntp.alpina/api/charts?range=7d"},
+		{"443", "ntp.alpina:80", "/", "https://ntp.alpina/"},
+		{"8443", "172.16.16.108:8080", "/config", "https://172.16.16.108:8443/config"},
+		{"443", "[2603:8001:7400:fa9a::108]:80", "/", "https://[2603:8001:7400:fa9a::108]/"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://"+c.host+c.path, nil)
+		req.Host = c.host
+		rec := httptest.NewRecorder()
+		RedirectHTTPS(c.port, probes, plain).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != c.want {
+			t.Errorf("%s%s: %d %q, want %q", c.host, c.path, rec.Code, rec.Header().Get("Location"), c.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	RedirectHTTPS("443", probes, plain).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://ntp.alpina/status/ntp", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "plain" {
+		t.Errorf("probe path redirected: %d", rec.Code)
+	}
+}
+
+func TestHSTSOnlyOverTLS(t *testing.T) {
+	h := HSTS(time.Hour, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://ntp.alpina/", nil))
+	if rec.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent over plain HTTP")
+	}
+}
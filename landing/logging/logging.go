@@ -0,0 +1,571 @@
+// Package logging sets up slog the same way for every landing page: text
+// or JSON on stderr for journald, plus optional RFC 5424 syslog and Loki
+// sinks, and logs HTTP requests through it.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Options configure Setup. App names the program in syslog headers and
+// the Loki job label.
+type Options struct {
+	App string
+	// Level is debug, info, warn or error; Format is text or json
+	Level  string
+	Format string
+	// SyslogAddr (host:port) additionally sends RFC 5424 syslog over UDP
+	SyslogAddr     string
+	SyslogFacility string
+	// LokiURL additionally pushes logs to Loki; LokiTenant sets
+	// X-Scope-OrgID
+	LokiURL    string
+	LokiTenant string
+}
+
+// Setup installs the default slog logger: text or JSON on stderr
+// (journald), plus the syslog and Loki sinks when configured. The standard
+// log package is routed through it as well, so plain log.Printf calls reach
+// every sink. The returned func flushes and closes the sinks.
+func Setup(cfg Options) func() {
+	level := parseLogLevel(cfg.Level)
+	opts := &slog.HandlerOptions{Level: level}
+	var console slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if cfg.Format == "json" {
+		console = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	handlers := []slog.Handler{console}
+	var closers []func()
+
+	host, _ := os.Hostname()
+	if cfg.SyslogAddr != "" {
+		h, err := newSyslogHandler(cfg.SyslogAddr, parseSyslogFacility(cfg.SyslogFacility), host, cfg.App, level)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "syslog %s: %v\n", cfg.SyslogAddr, err)
+		} else {
+			handlers = append(handlers, h)
+			closers = append(closers, func() { h.Close() })
+		}
+	}
+	if cfg.LokiURL != "" {
+		h := newLokiHandler(cfg.LokiURL, cfg.LokiTenant, map[string]string{"job": cfg.App, "host": host}, level, time.Second)
+		handlers = append(handlers, h)
+		closers = append(closers, h.Close)
+	}
+
+	var h slog.Handler = multiHandler(handlers)
+	if len(handlers) == 1 {
+		h = console
+	}
+	slog.SetDefault(slog.New(h))
+	return func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+}
+
+func parseLogLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// multiHandler sends every record to all handlers that accept its level
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(multiHandler, len(m))
+	for i, h := range m {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	out := make(multiHandler, len(m))
+	for i, h := range m {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// flatAttrs collects a record's attributes as flattened key/value pairs
+// ("group.key"), shared by the syslog and Loki handlers which both need
+// flat fields.
+type flatAttrs struct {
+	prefix string
+	attrs  []slog.Attr
+}
+
+func (f flatAttrs) withAttrs(attrs []slog.Attr) flatAttrs {
+	out := flatAttrs{prefix: f.prefix, attrs: append([]slog.Attr(nil), f.attrs...)}
+	for _, a := range attrs {
+		out.attrs = append(out.attrs, slog.Attr{Key: f.prefix + a.Key, Value: a.Value})
+	}
+	return out
+}
+
+func (f flatAttrs) withGroup(name string) flatAttrs {
+	if name == "" {
+		return f
+	}
+	return flatAttrs{prefix: f.prefix + name + ".", attrs: f.attrs}
+}
+
+// pairs returns the handler's and the record's attributes flattened
+func (f flatAttrs) pairs(r slog.Record) [][2]string {
+	var out [][2]string
+	var add func(prefix string, a slog.Attr)
+	add = func(prefix string, a slog.Attr) {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			return
+		}
+		if a.Value.Kind() == slog.KindGroup {
+			p := prefix
+			if a.Key != "" {
+				p += a.Key + "."
+			}
+			for _, g := range a.Value.Group() {
+				add(p, g)
+			}
+			return
+		}
+		out = append(out, [2]string{prefix + a.Key, a.Value.String()})
+	}
+	for _, a := range f.attrs {
+		add("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(f.prefix, a)
+		return true
+	})
+	return out
+}
+
+// logfmtLine renders a message and fields as logfmt
+func logfmtLine(level slog.Level, msg string, pairs [][2]string) string {
+	var b strings.Builder
+	b.WriteString("level=")
+	b.WriteString(strings.ToLower(level.String()))
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+	for _, p := range pairs {
+		b.WriteByte(' ')
+		b.WriteString(p[0])
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(p[1]))
+	}
+	return b.String()
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// syslog facilities by name (RFC 5424 section 6.2.1)
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func parseSyslogFacility(name string) int {
+	if f, ok := syslogFacilities[strings.ToLower(name)]; ok {
+		return f
+	}
+	return syslogFacilities["daemon"]
+}
+
+func syslogSeverity(l slog.Level) int {
+	switch {
+	case l >= slog.LevelError:
+		return 3
+	case l >= slog.LevelWarn:
+		return 4
+	case l >= slog.LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// syslogSDID is the structured data element carrying the log fields; the
+// number is the IANA "example" enterprise, as there is no registered one.
+const syslogSDID = "fields@32473"
+
+// syslogHandler sends RFC 5424 messages over UDP, one datagram per record,
+// with the fields as structured data. The "component" field, when present,
+// becomes the MSGID so collectors can filter on it.
+type syslogHandler struct {
+	conn     net.Conn
+	facility int
+	host     string
+	app      string
+	level    slog.Leveler
+	attrs    flatAttrs
+	mu       *sync.Mutex
+}
+
+func newSyslogHandler(addr string, facility int, host, app string, level slog.Leveler) (*syslogHandler, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHandler{conn: conn, facility: facility, host: host, app: app, level: level, mu: &sync.Mutex{}}, nil
+}
+
+func (h *syslogHandler) Close() error { return h.conn.Close() }
+
+func (h *syslogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = h.attrs.withAttrs(attrs)
+	return &c
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.attrs = h.attrs.withGroup(name)
+	return &c
+}
+
+func (h *syslogHandler) Handle(_ context.Context, r slog.Record) error {
+	msg := formatSyslog(h.facility, h.host, h.app, os.Getpid(), r.Time, r.Level, r.Message, h.attrs.pairs(r))
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.conn.Write([]byte(msg))
+	return err
+}
+
+// formatSyslog renders one RFC 5424 message:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func formatSyslog(facility int, host, app string, pid int, t time.Time, level slog.Level, msg string, pairs [][2]string) string {
+	msgID := "-"
+	var sd strings.Builder
+	for _, p := range pairs {
+		if p[0] == "component" && msgID == "-" {
+			msgID = syslogToken(p[1], 32)
+		}
+		if sd.Len() == 0 {
+			sd.WriteString("[" + syslogSDID)
+		}
+		fmt.Fprintf(&sd, " %s=\"%s\"", syslogToken(p[0], 32), syslogParamEscaper.Replace(p[1]))
+	}
+	if sd.Len() == 0 {
+		sd.WriteString("-")
+	} else {
+		sd.WriteString("]")
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		facility*8+syslogSeverity(level), t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogToken(host, 255), syslogToken(app, 48), pid, msgID, sd.String(), msg)
+}
+
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogToken restricts header fields and SD names to printable ASCII
+// without spaces, '=', ']' or '"', as RFC 5424 requires
+func syslogToken(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// lokiHandler batches records and pushes them to Loki's HTTP push API.
+// Records are queued without blocking the caller; a background loop sends
+// the batch every interval. The level is a stream label, fields go into
+// the line as logfmt so they can be parsed with "| logfmt".
+type lokiHandler struct {
+	*lokiPusher
+	level slog.Leveler
+	attrs flatAttrs
+}
+
+type lokiPusher struct {
+	url      string
+	tenant   string
+	labels   map[string]string
+	client   *http.Client
+	maxQueue int
+
+	mu    sync.Mutex
+	queue []lokiEntry
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+type lokiEntry struct {
+	level string
+	ts    time.Time
+	line  string
+}
+
+func newLokiHandler(url, tenant string, labels map[string]string, level slog.Leveler, interval time.Duration) *lokiHandler {
+	p := &lokiPusher{
+		url:      strings.TrimRight(url, "/") + "/loki/api/v1/push",
+		tenant:   tenant,
+		labels:   labels,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		maxQueue: 10000,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run(interval)
+	return &lokiHandler{lokiPusher: p, level: level}
+}
+
+func (h *lokiHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *lokiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &lokiHandler{lokiPusher: h.lokiPusher, level: h.level, attrs: h.attrs.withAttrs(attrs)}
+}
+
+func (h *lokiHandler) WithGroup(name string) slog.Handler {
+	return &lokiHandler{lokiPusher: h.lokiPusher, level: h.level, attrs: h.attrs.withGroup(name)}
+}
+
+func (h *lokiHandler) Handle(_ context.Context, r slog.Record) error {
+	ts := r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	e := lokiEntry{level: strings.ToLower(r.Level.String()), ts: ts, line: logfmtLine(r.Level, r.Message, h.attrs.pairs(r))}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.queue) >= h.maxQueue {
+		// Loki is unreachable; drop the oldest rather than grow forever
+		h.queue = h.queue[1:]
+	}
+	h.queue = append(h.queue, e)
+	return nil
+}
+
+func (p *lokiPusher) run(interval time.Duration) {
+	defer close(p.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.stop:
+			p.flush()
+			return
+		}
+	}
+}
+
+// Close pushes what is queued and stops the background loop
+func (p *lokiPusher) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+	})
+}
+
+func (p *lokiPusher) flush() {
+	p.mu.Lock()
+	batch := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	if err := p.push(batch); err != nil {
+		// Not through slog: that would queue the error for Loki again
+		fmt.Fprintf(os.Stderr, "loki push: %v (%d entries dropped)\n", err, len(batch))
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (p *lokiPusher) push(batch []lokiEntry) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, e := range batch {
+		s, ok := streams[e.level]
+		if !ok {
+			labels := map[string]string{"level": e.level}
+			for k, v := range p.labels {
+				labels[k] = v
+			}
+			s = &lokiStream{Stream: labels}
+			streams[e.level] = s
+			order = append(order, e.level)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, l := range order {
+		body.Streams = append(body.Streams, streams[l])
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", p.tenant)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// StatusRecorder captures the status code and size of a response, for
+// request logs and metrics
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int
+}
+
+func (r *StatusRecorder) WriteHeader(code int) {
+	r.Status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Flush keeps streaming responses working through the recorder
+func (r *StatusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Requests logs every request with its outcome. The probes paths, such as
+// Prometheus scrapes and health checks, are logged at debug level to keep
+// the log readable, or at warn level when they fail.
+func Requests(probes map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case probes[r.URL.Path] && rec.Status >= 500:
+			// a failing probe is an answer, not a server error
+			level = slog.LevelWarn
+		case probes[r.URL.Path]:
+			level = slog.LevelDebug
+		case rec.Status >= 500:
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "request",
+			"component", "http",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.Status,
+			"bytes", rec.Bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote", remoteHost(r),
+			"user_agent", truncateUTF8(r.UserAgent(), 200),
+		)
+	})
+}
+
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
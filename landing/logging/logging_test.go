@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatSyslog(t *testing.T) {
+	at := time.Date(2026, 10, 19, 12, 0, 0, 123456000, time.UTC)
+	msg := formatSyslog(3, "ntp.alpina", "ntp-landing", 42, at, slog.LevelWarn, "reach lost",
+		[][2]string{{"component", "events"}, {"source", `a"b]c\d`}, {"bad key", "x"}})
+	want := `<28>1 2026-10-19T12:00:00.123456Z ntp.alpina ntp-landing 42 events [fields@32473 component="events" source="a\"b\]c\\d" bad_key="x"] reach lost`
+	if msg != want {
+		t.Errorf("got  %s\nwant %s", msg, want)
+	}
+	if got := formatSyslog(16, "h", "a", 1, at, slog.LevelDebug, "m", nil); !strings.HasPrefix(got, "<135>1 ") || !strings.Contains(got, " 1 - - m") {
+		t.Errorf("no fields: %s", got)
+	}
+}
+
+func TestSyslogHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	h, err := newSyslogHandler(pc.LocalAddr().String(), syslogFacilities["local0"], "ntp.alpina", "ntp-landing", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	logger := slog.New(h).With("component", "collector").WithGroup("chrony")
+	logger.Debug("dropped")
+	logger.Error("chronyc failed", "cmd", "tracking")
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"<131>1 ", " ntp.alpina ntp-landing ", " collector [fields@32473 ", `component="collector"`, `chrony.cmd="tracking"`, "] chronyc failed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("datagram %q missing %q", got, want)
+		}
+	}
+}
+
+func TestLokiHandlerPush(t *testing.T) {
+	type push struct {
+		tenant string
+		body   struct {
+			Streams []lokiStream `json:"streams"`
+		}
+	}
+	pushes := make(chan push, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			http.NotFound(w, r)
+			return
+		}
+		var p push
+		p.tenant = r.Header.Get("X-Scope-OrgID")
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &p.body); err != nil {
+			t.Errorf("push body: %v", err)
+		}
+		pushes <- p
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	h := newLokiHandler(srv.URL+"/", "homelab", map[string]string{"job": "ntp-landing", "host": "ntp"}, slog.LevelInfo, time.Hour)
+	logger := slog.New(h)
+	logger.Info("request", "component", "http", "path", "/api/stats", "status", 200)
+	logger.Warn("reach lost", "source", "a b")
+	logger.Debug("ignored")
+	h.Close()
+
+	var p push
+	select {
+	case p = <-pushes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing pushed on close")
+	}
+	if p.tenant != "homelab" || len(p.body.Streams) != 2 {
+		t.Fatalf("push = %+v", p)
+	}
+	info, warn := p.body.Streams[0], p.body.Streams[1]
+	if info.Stream["level"] != "info" || info.Stream["job"] != "ntp-landing" || info.Stream["host"] != "ntp" || len(info.Values) != 1 {
+		t.Errorf("info stream = %+v", info)
+	}
+	if line := info.Values[0][1]; line != "level=info msg=request component=http path=/api/stats status=200" {
+		t.Errorf("info line = %q", line)
+	}
+	if line := warn.Values[0][1]; warn.Stream["level"] != "warn" || line != `level=warn msg="reach lost" source="a b"` {
+		t.Errorf("warn stream = %+v", warn)
+	}
+}
+
+func TestMultiHandlerLevels(t *testing.T) {
+	var quiet, loud strings.Builder
+	h := multiHandler{
+		slog.NewTextHandler(&quiet, &slog.HandlerOptions{Level: slog.LevelWarn}),
+		slog.NewTextHandler(&loud, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	}
+	logger := slog.New(h).With("component", "test")
+	logger.Debug("debug line")
+	logger.Warn("warn line")
+	if strings.Contains(quiet.String(), "debug line") || !strings.Contains(quiet.String(), "warn line") {
+		t.Errorf("warn handler got %q", quiet.String())
+	}
+	if !strings.Contains(loud.String(), "debug line") || !strings.Contains(loud.String(), "component=test") {
+		t.Errorf("debug handler got %q", loud.String())
+	}
+}
+
+func TestRequests(t *testing.T) {
+	var out strings.Builder
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&out, nil)))
+	defer slog.SetDefault(prev)
+
+	boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	})
+	Requests(nil, boom).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/timex", nil))
+	for _, want := range []string{"level=ERROR", "msg=request", "component=http", "path=/api/timex", "status=502", "remote=192.0.2.1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log %q missing %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	probes := map[string]bool{"/healthz": true}
+	ok := Requests(probes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ok.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if out.Len() != 0 {
+		t.Errorf("passing probe logged at info: %q", out.String())
+	}
+	Requests(probes, boom).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if !strings.Contains(out.String(), "level=WARN") || strings.Contains(out.String(), "level=ERROR") {
+		t.Errorf("failing probe: %q", out.String())
+	}
+}
@@ -0,0 +1,240 @@
+// Package loki reads recent log lines from Loki's query_range API for the
+// logs panels, with a severity for every line.
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogLine is one log entry returned by a Loki range query
+type LogLine struct {
+	Time   time.Time         `json:"time"`
+	Level  string            `json:"level"` // error, warning, info or debug
+	Line   string            `json:"line"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LogsResponse is served by /api/v1/logs
+type LogsResponse struct {
+	Query string    `json:"query"`
+	Level string    `json:"level"`
+	Lines []LogLine `json:"lines"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Querier runs query_range requests against a Loki instance
+type Querier struct {
+	base   string
+	tenant string
+	client *http.Client
+}
+
+// NewQuerier queries the Loki at base; tenant, when set, is sent as
+// X-Scope-OrgID
+func NewQuerier(base, tenant string, timeout time.Duration) *Querier {
+	return &Querier{
+		base:   strings.TrimRight(base, "/"),
+		tenant: tenant,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// QueryRange returns the newest limit lines matching a LogQL query between
+// start and end, newest first
+func (q *Querier) QueryRange(ctx context.Context, query string, start, end time.Time, limit int) ([]LogLine, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("direction", "backward")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, q.base+"/loki/api/v1/query_range?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if q.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", q.tenant)
+	}
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("loki unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][2]string       `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Loki answers query errors with a plain text body
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("loki query failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding loki response: %w", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("loki query failed: %s", result.Error)
+	}
+	if result.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("loki returned %s, want a log query", result.Data.ResultType)
+	}
+
+	var lines []LogLine
+	for _, s := range result.Data.Result {
+		for _, v := range s.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			lines = append(lines, LogLine{
+				Time:   time.Unix(0, ns),
+				Level:  LineLevel(s.Stream, v[1]),
+				Line:   v[1],
+				Labels: s.Stream,
+			})
+		}
+	}
+	// each stream is ordered on its own; merge them newest first
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.After(lines[j].Time) })
+	if limit > 0 && len(lines) > limit {
+		lines = lines[:limit]
+	}
+	return lines, nil
+}
+
+// logLevels orders severities from most to least severe
+var logLevels = map[string]int{"error": 0, "warning": 1, "info": 2, "debug": 3}
+
+// LineLevel takes the severity from the stream labels (level as set by
+// our own pusher or promtail, priority as exported from the journal) and
+// otherwise reads it from the line itself: a logfmt level=, the level
+// column logback and Spring Boot put after the timestamp
+// ("2026-10-19T12:00:00.000Z  WARN 1 --- [main] ..."), or failing that
+// a guess from its words. Lines on a container's stderr without any of
+// these are warnings.
+func LineLevel(labels map[string]string, line string) string {
+	for _, key := range []string{"level", "detected_level", "severity"} {
+		if l := NormalizeLevel(labels[key]); l != "" {
+			return l
+		}
+	}
+	if p, err := strconv.Atoi(labels["priority"]); err == nil {
+		switch {
+		case p <= 3:
+			return "error"
+		case p == 4:
+			return "warning"
+		case p == 7:
+			return "debug"
+		default:
+			return "info"
+		}
+	}
+	lower := strings.ToLower(line)
+	if i := strings.Index(lower, "level="); i >= 0 {
+		if l := NormalizeLevel(strings.Fields(lower[i+len("level="):] + " ")[0]); l != "" {
+			return l
+		}
+	}
+	for i, f := range strings.Fields(line) {
+		if i == 3 {
+			break
+		}
+		if f == strings.ToUpper(f) {
+			if l := NormalizeLevel(f); l != "" {
+				return l
+			}
+		}
+	}
+	switch {
+	case containsAny(lower, "error", "fatal", "panic", "exception", "failed"):
+		return "error"
+	case containsAny(lower, "warn", "can't synchronise", "unreachable", "no selectable sources"):
+		return "warning"
+	case labels["stream"] == "stderr":
+		return "warning"
+	}
+	return "info"
+}
+
+// NormalizeLevel maps syslog, logback and slog level names to error,
+// warning, info or debug, and anything else to ""
+func NormalizeLevel(s string) string {
+	switch strings.ToLower(strings.Trim(s, `"`)) {
+	case "emerg", "alert", "crit", "critical", "err", "error", "fatal", "panic":
+		return "error"
+	case "warn", "warning":
+		return "warning"
+	case "info", "notice", "information":
+		return "info"
+	case "debug", "trace":
+		return "debug"
+	}
+	return ""
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLevel keeps the lines at min severity or above. An unknown or
+// empty min keeps everything.
+func filterLevel(lines []LogLine, min string) []LogLine {
+	rank, ok := logLevels[NormalizeLevel(min)]
+	if !ok {
+		return lines
+	}
+	out := lines[:0:0]
+	for _, l := range lines {
+		if logLevels[l.Level] <= rank {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Recent answers /api/v1/logs: the newest limit lines of query within
+// since, at level or above. Severity filtering happens here rather than in
+// LogQL because the level is often only known after guessing from the
+// line, so more lines are fetched when a filter is set.
+func (q *Querier) Recent(ctx context.Context, query string, since time.Duration, level string, limit int, now time.Time) (LogsResponse, error) {
+	resp := LogsResponse{Query: query, Level: NormalizeLevel(level), Lines: []LogLine{}}
+	fetch := limit
+	if resp.Level != "" {
+		fetch = limit * 5
+	}
+	lines, err := q.QueryRange(ctx, query, now.Add(-since), now, fetch)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp, err
+	}
+	lines = filterLevel(lines, resp.Level)
+	if len(lines) > limit {
+		lines = lines[:limit]
+	}
+	resp.Lines = lines
+	return resp, nil
+}
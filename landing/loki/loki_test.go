@@ -0,0 +1,124 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const lokiRangeResponse = `{"status":"success","data":{"resultType":"streams","result":[
+{"stream":{"unit":"chronyd.service","priority":"6"},"values":[
+ ["1760875200000000000","Selected source 192.0.2.1 (time.cloudflare.com)"],
+ ["1760875000000000000","chronyd version 4.6 starting"]]},
+{"stream":{"unit":"chronyd.service","priority":"4"},"values":[
+ ["1760875100000000000","Can't synchronise: no selectable sources"]]},
+{"stream":{"unit":"chronyd.service"},"values":[
+ ["1760875150000000000","NTS-KE session with 162.159.200.1 failed"]]}
+]}}`
+
+func TestLokiQueryRange(t *testing.T) {
+	var got http.Header
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/query_range" {
+			http.NotFound(w, r)
+			return
+		}
+		got = r.Header
+		query = r.URL.RawQuery
+		w.Write([]byte(lokiRangeResponse))
+	}))
+	defer srv.Close()
+
+	q := NewQuerier(srv.URL+"/", "homelab", time.Second)
+	end := time.Unix(1760875300, 0)
+	lines, err := q.QueryRange(context.Background(), `{unit="chronyd.service"}`, end.Add(-time.Hour), end, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Scope-OrgID") != "homelab" {
+		t.Errorf("tenant header = %q", got.Get("X-Scope-OrgID"))
+	}
+	for _, want := range []string{"direction=backward", "limit=10", "end=1760875300000000000", "query=%7Bunit%3D%22chronyd.service%22%7D"} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query %q missing %q", query, want)
+		}
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	wantLevels := []string{"info", "error", "warning", "info"}
+	for i, l := range lines {
+		if i > 0 && l.Time.After(lines[i-1].Time) {
+			t.Errorf("line %d out of order", i)
+		}
+		if l.Level != wantLevels[i] {
+			t.Errorf("line %d %q level = %s, want %s", i, l.Line, l.Level, wantLevels[i])
+		}
+	}
+}
+
+func TestRecentFilterAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("query"), "bad") {
+			http.Error(w, "parse error at line 1, col 2: syntax error", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(lokiRangeResponse))
+	}))
+	q := NewQuerier(srv.URL, "", time.Second)
+	now := time.Unix(1760875300, 0)
+
+	resp, err := q.Recent(context.Background(), `{unit="chronyd.service"}`, time.Hour, "warn", 10, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Level != "warning" || len(resp.Lines) != 2 {
+		t.Errorf("warning filter = %+v", resp)
+	}
+	resp, err = q.Recent(context.Background(), `{unit="chronyd.service"}`, time.Hour, "", 1, now)
+	if err != nil || len(resp.Lines) != 1 {
+		t.Errorf("limit 1 = %+v, %v", resp, err)
+	}
+
+	resp, err = q.Recent(context.Background(), `{bad`, time.Hour, "", 10, now)
+	if err == nil || !strings.Contains(resp.Error, "syntax error") || resp.Lines == nil {
+		t.Errorf("query error = %+v, %v", resp, err)
+	}
+
+	srv.Close()
+	resp, err = q.Recent(context.Background(), `{unit="chronyd.service"}`, time.Hour, "", 10, now)
+	if err == nil || !strings.Contains(resp.Error, "loki unreachable") {
+		t.Errorf("unreachable = %+v, %v", resp, err)
+	}
+}
+
+func TestLineLevel(t *testing.T) {
+	cases := []struct {
+		labels map[string]string
+		line   string
+		want   string
+	}{
+		{map[string]string{"level": "warn"}, "anything", "warning"},
+		{map[string]string{"detected_level": "ERROR"}, "anything", "error"},
+		{map[string]string{"priority": "3"}, "anything", "error"},
+		{map[string]string{"priority": "7"}, "anything", "debug"},
+		{nil, `time=2026-10-19 level=debug msg="snapshot collected"`, "debug"},
+		{nil, "Source 192.0.2.7 replaced with 192.0.2.8", "info"},
+		{nil, "System clock wrong by 1.2 seconds; Can't synchronise", "warning"},
+		{nil, "Could not open NTS-KE socket: failed", "error"},
+		// Komga (Spring Boot) in docker
+		{map[string]string{"stream": "stdout"}, "2026-10-19T12:00:00.000Z  WARN 1 --- [main] o.g.k.KomgaApplication : slow scan", "warning"},
+		{map[string]string{"stream": "stdout"}, "2026-10-19T12:00:00.000Z DEBUG 1 --- [task-1] Scanner : found 3 books", "debug"},
+		{map[string]string{"stream": "stdout"}, "2026-10-19T12:00:00.000Z  INFO 1 --- [main] Library : Error handling is fine", "info"},
+		{map[string]string{"stream": "stderr"}, "Picked up JAVA_TOOL_OPTIONS: -Xmx2g", "warning"},
+	}
+	for _, c := range cases {
+		if got := LineLevel(c.labels, c.line); got != c.want {
+			t.Errorf("LineLevel(%v, %q) = %s, want %s", c.labels, c.line, got, c.want)
+		}
+	}
+}
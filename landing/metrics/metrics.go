@@ -0,0 +1,131 @@
+// Package metrics writes the Prometheus text exposition format for the
+// landing pages' /metrics, and keeps the request and runtime metrics both
+// pages export about themselves.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LatencyBuckets are the histogram bounds, in seconds, for requests and
+// the upstream calls behind them
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram is a cumulative Prometheus histogram. It is not safe for
+// concurrent use; its owner guards it.
+type Histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.sum += v
+}
+
+// Writer emits the Prometheus text exposition format. HELP and TYPE
+// lines are written once per metric name, before its first sample.
+type Writer struct {
+	w    io.Writer
+	seen map[string]bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, seen: make(map[string]bool)}
+}
+
+func (m *Writer) Gauge(name, help string, value float64, labels ...string) {
+	m.sample(name, "gauge", help, value, labels)
+}
+
+func (m *Writer) Counter(name, help string, value float64, labels ...string) {
+	m.sample(name, "counter", help, value, labels)
+}
+
+// sample writes one line; labels are given as alternating name, value pairs
+func (m *Writer) sample(name, typ, help string, value float64, labels []string) {
+	m.header(name, typ, help)
+	m.line(name, value, labels)
+}
+
+// Histogram writes the _bucket, _sum and _count lines of one labelled
+// histogram
+func (m *Writer) Histogram(name, help string, h *Histogram, labels ...string) {
+	m.header(name, "histogram", help)
+	var cum uint64
+	for i, n := range h.counts {
+		cum += n
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatValue(h.bounds[i])
+		}
+		m.line(name+"_bucket", float64(cum), append(labels[:len(labels):len(labels)], "le", le))
+	}
+	m.line(name+"_sum", h.sum, labels)
+	m.line(name+"_count", float64(cum), labels)
+}
+
+func (m *Writer) header(name, typ, help string) {
+	if !m.seen[name] {
+		m.seen[name] = true
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+}
+
+func (m *Writer) line(name string, value float64, labels []string) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) >= 2 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i])
+			sb.WriteString(`="`)
+			sb.WriteString(escapeLabel(labels[i+1]))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	fmt.Fprintf(m.w, "%s %s\n", sb.String(), formatValue(value))
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// SortedKeys lists the keys of m in order, for writing labelled series in
+// a stable order
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWriter(&buf)
+	m.Gauge("up", "Whether it is up.", 1)
+	m.Gauge("temp", "Temperature.", 21.5, "room", `a "quoted"\ name`+"\n")
+	m.Gauge("temp", "Temperature.", math.Inf(1), "room", "b")
+	m.Counter("naks_total", "NAKs.", math.NaN())
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+	m.Histogram("wait_seconds", "Wait.", h, "queue", "q")
+
+	want := `# HELP up Whether it is up.
+# TYPE up gauge
+up 1
+# HELP temp Temperature.
+# TYPE temp gauge
+temp{room="a \"quoted\"\\ name\n"} 21.5
+temp{room="b"} +Inf
+# HELP naks_total NAKs.
+# TYPE naks_total counter
+naks_total NaN
+# HELP wait_seconds Wait.
+# TYPE wait_seconds histogram
+wait_seconds_bucket{queue="q",le="0.1"} 1
+wait_seconds_bucket{queue="q",le="1"} 2
+wait_seconds_bucket{queue="q",le="+Inf"} 3
+wait_seconds_sum{queue="q"} 3.55
+wait_seconds_count{queue="q"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	q := NewRequests()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/stats", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	h := q.Middleware(mux, mux)
+	for _, path := range []string{"/api/v1/stats?x=1", "/api/v1/stats?x=2", "/admin", "/no/such/page"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	for _, method := range []string{"FROB", "X-1234"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/api/v1/stats", nil))
+	}
+
+	var buf bytes.Buffer
+	m := NewWriter(&buf)
+	q.Write(m, "test_landing")
+	WriteRuntime(m, time.Unix(1700000000, 0))
+	out := buf.String()
+	for _, want := range []string{
+		`test_landing_http_requests_total{route="/admin",method="GET",code="403"} 1` + "\n" +
+			`test_landing_http_requests_total{route="/api/v1/stats",method="GET",code="200"} 2` + "\n" +
+			`test_landing_http_requests_total{route="/api/v1/stats",method="other",code="200"} 2` + "\n" +
+			`test_landing_http_requests_total{route="unmatched",method="GET",code="404"} 1`,
+		`test_landing_http_request_duration_seconds_count{route="/api/v1/stats"} 4`,
+		"# TYPE test_landing_http_request_duration_seconds histogram\n",
+		"# TYPE go_goroutines gauge\n",
+		"# TYPE go_gc_cycles_total counter\n",
+		"process_start_time_seconds 1.7e+09\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+	if n := strings.Count(out, "# HELP test_landing_http_request_duration_seconds "); n != 1 {
+		t.Errorf("%d HELP lines for the duration histogram", n)
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"landing/logging"
+)
+
+type requestKey struct {
+	route, method string
+	code          int
+}
+
+// Requests counts and times the HTTP requests a landing page serves, by
+// the ServeMux pattern that serves them so the route label stays bounded
+type Requests struct {
+	mu      sync.Mutex
+	count   map[requestKey]uint64
+	seconds map[string]*Histogram // by route
+}
+
+func NewRequests() *Requests {
+	return &Requests{count: map[requestKey]uint64{}, seconds: map[string]*Histogram{}}
+}
+
+func (q *Requests) Observe(route, method string, code int, d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.count[requestKey{route, method, code}]++
+	h, ok := q.seconds[route]
+	if !ok {
+		h = NewHistogram(LatencyBuckets)
+		q.seconds[route] = h
+	}
+	h.Observe(d.Seconds())
+}
+
+// standardMethods are the request methods kept as their own label value;
+// anything else a client sends is counted as "other"
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Middleware records every request next serves under its route in mux.
+// Methods outside the standard set are recorded as "other" so clients
+// cannot grow the method label without bound.
+func (q *Requests) Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &logging.StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		method := r.Method
+		if !standardMethods[method] {
+			method = "other"
+		}
+		q.Observe(route, method, rec.Status, time.Since(start))
+	})
+}
+
+// Write emits <prefix>_http_requests_total and
+// <prefix>_http_request_duration_seconds in a stable order
+func (q *Requests) Write(m *Writer, prefix string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	keys := make([]requestKey, 0, len(q.count))
+	for k := range q.count {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, k := range keys {
+		m.Counter(prefix+"_http_requests_total", "HTTP requests by ServeMux route, method and status code.", float64(q.count[k]),
+			"route", k.route, "method", k.method, "code", strconv.Itoa(k.code))
+	}
+	for _, route := range SortedKeys(q.seconds) {
+		m.Histogram(prefix+"_http_request_duration_seconds", "Time to serve an HTTP request.", q.seconds[route], "route", route)
+	}
+}
+
+// WriteRuntime emits the Go runtime and process metrics for a process
+// that started at start
+func WriteRuntime(m *Writer, start time.Time) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	m.Gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	m.Gauge("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(ms.HeapAlloc))
+	m.Gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(ms.HeapInuse))
+	m.Gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", float64(ms.Sys))
+	m.Counter("go_gc_cycles_total", "Completed GC cycles.", float64(ms.NumGC))
+	m.Gauge("process_start_time_seconds", "Start time of the process since the Unix epoch.", float64(start.Unix()))
+}
@@ -0,0 +1,394 @@
+// Package mqtt is the minimal MQTT 3.1.1 publisher the landing pages use
+// to register with Home Assistant through MQTT discovery. It speaks just
+// enough of the protocol for that: QoS 0 publishes, a retained last will
+// for availability and keep alive pings.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Control packet types, shifted into the fixed header
+const (
+	Connect    = 1 << 4
+	Connack    = 2 << 4
+	Publish    = 3 << 4
+	Pingreq    = 12 << 4
+	Pingresp   = 13 << 4
+	Disconnect = 14 << 4
+)
+
+// Client is a QoS 0 publisher with a retained last will. It connects
+// lazily and reconnects on the next Connect after the connection breaks,
+// which is all a periodic state publisher needs.
+type Client struct {
+	Addr        string
+	ClientID    string
+	Username    string
+	Password    string
+	KeepAlive   time.Duration
+	Timeout     time.Duration
+	WillTopic   string
+	WillMessage string
+
+	mu        sync.Mutex
+	conn      net.Conn
+	lastWrite time.Time
+	done      chan struct{}
+}
+
+// Connect makes sure a connection is up. The bool is true when a new
+// connection was made, so callers can re-send retained discovery messages.
+func (c *Client) Connect() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return false, nil
+	}
+	conn, err := net.DialTimeout("tcp", c.Addr, c.Timeout)
+	if err != nil {
+		return false, err
+	}
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	if _, err := conn.Write(c.connectPacket()); err != nil {
+		conn.Close()
+		return false, err
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := ReadPacket(r)
+	if err != nil {
+		conn.Close()
+		return false, fmt.Errorf("connack: %w", err)
+	}
+	if typ != Connack || len(body) != 2 {
+		conn.Close()
+		return false, fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", typ)
+	}
+	if rc := body[1]; rc != 0 {
+		conn.Close()
+		return false, fmt.Errorf("broker refused connection: %s", connackReason(rc))
+	}
+	conn.SetDeadline(time.Time{})
+	c.conn = conn
+	c.lastWrite = time.Now()
+	c.done = make(chan struct{})
+	go c.readLoop(conn, r, c.done)
+	go c.pingLoop(c.done)
+	return true, nil
+}
+
+func (c *Client) connectPacket() []byte {
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = AppendString(payload, c.ClientID)
+	if c.WillTopic != "" {
+		flags |= 0x04 | 0x20 // will, will retain
+		payload = AppendString(payload, c.WillTopic)
+		payload = AppendString(payload, c.WillMessage)
+	}
+	if c.Username != "" {
+		flags |= 0x80
+		payload = AppendString(payload, c.Username)
+		if c.Password != "" {
+			flags |= 0x40
+			payload = AppendString(payload, c.Password)
+		}
+	}
+	keepAlive := uint16(c.KeepAlive / time.Second)
+	var body []byte
+	body = AppendString(body, "MQTT")
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = append(body, payload...)
+	return Packet(Connect, body)
+}
+
+// readLoop drains what the broker sends (only PINGRESP for a publisher)
+// and drops the connection when the broker closes it.
+func (c *Client) readLoop(conn net.Conn, r *bufio.Reader, done chan struct{}) {
+	for {
+		if _, _, err := ReadPacket(r); err != nil {
+			c.drop(conn, done)
+			return
+		}
+	}
+}
+
+// pingLoop keeps an idle connection alive within the keep alive interval
+func (c *Client) pingLoop(done chan struct{}) {
+	if c.KeepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			idle := time.Since(c.lastWrite) >= c.KeepAlive/2
+			c.mu.Unlock()
+			if idle {
+				c.write([]byte{Pingreq, 0})
+			}
+		}
+	}
+}
+
+// drop closes conn if it is still the current connection
+func (c *Client) drop(conn net.Conn, done chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		close(done)
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) write(pkt []byte) error {
+	c.mu.Lock()
+	conn, done := c.conn, c.done
+	c.mu.Unlock()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+	c.mu.Lock()
+	conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	_, err := conn.Write(pkt)
+	c.lastWrite = time.Now()
+	c.mu.Unlock()
+	if err != nil {
+		c.drop(conn, done)
+	}
+	return err
+}
+
+// Publish sends a QoS 0 message
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	typ := byte(Publish)
+	if retain {
+		typ |= 0x01
+	}
+	body := AppendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(Packet(typ, body))
+}
+
+// Close sends DISCONNECT, which tells the broker not to publish the will
+func (c *Client) Close() {
+	c.write([]byte{Disconnect, 0})
+	c.mu.Lock()
+	conn, done := c.conn, c.done
+	c.mu.Unlock()
+	if conn != nil {
+		c.drop(conn, done)
+	}
+}
+
+// Packet frames body as a control packet with the remaining length
+// varint after the fixed header byte
+func Packet(typ byte, body []byte) []byte {
+	pkt := []byte{typ}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(pkt, body...)
+}
+
+// AppendString appends s with its two byte length prefix
+func AppendString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+
+// ReadPacket reads one control packet and returns its fixed header byte
+// and body
+func ReadPacket(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		mult *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+func connackReason(rc byte) string {
+	switch rc {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorised"
+	}
+	return fmt.Sprintf("return code %d", rc)
+}
+
+// Entity is one Home Assistant MQTT discovery entity. Its Config is merged
+// into the discovery message; value templates read the device's JSON state.
+type Entity struct {
+	Component string // sensor or binary_sensor
+	Object    string
+	Config    map[string]interface{}
+}
+
+// Options describe a Home Assistant device published by one landing page
+type Options struct {
+	Broker   string // host:port
+	Username string
+	Password string
+	// Model is the program name, e.g. ntp-landing; node ids are derived
+	// from it and Host
+	Model string
+	// Name is the device name shown in Home Assistant
+	Name string
+	Host string
+	// State goes to TopicPrefix/<host>/state and availability next to it;
+	// the discovery configs go below DiscoveryPrefix
+	TopicPrefix     string
+	DiscoveryPrefix string
+	Entities        []Entity
+}
+
+// Device announces its entities through discovery and publishes one
+// retained JSON state message for all of them
+type Device struct {
+	Client            *Client
+	NodeID            string
+	StateTopic        string
+	AvailabilityTopic string
+
+	opts Options
+}
+
+// NewDevice sets up the device; nothing connects until the first Publish
+func NewDevice(o Options) *Device {
+	nodeID := ObjectID(o.Model) + "_" + ObjectID(o.Host)
+	base := strings.TrimRight(o.TopicPrefix, "/") + "/" + o.Host
+	o.DiscoveryPrefix = strings.TrimRight(o.DiscoveryPrefix, "/")
+	d := &Device{
+		NodeID:            nodeID,
+		StateTopic:        base + "/state",
+		AvailabilityTopic: base + "/availability",
+		opts:              o,
+	}
+	d.Client = &Client{
+		Addr:        o.Broker,
+		ClientID:    nodeID,
+		Username:    o.Username,
+		Password:    o.Password,
+		KeepAlive:   60 * time.Second,
+		Timeout:     5 * time.Second,
+		WillTopic:   d.AvailabilityTopic,
+		WillMessage: "offline",
+	}
+	return d
+}
+
+// ObjectID turns a host or program name into a discovery object id
+func ObjectID(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, s)
+}
+
+func (d *Device) announce() error {
+	device := map[string]interface{}{
+		"identifiers":  []string{d.NodeID},
+		"name":         d.opts.Name,
+		"manufacturer": "alpina",
+		"model":        d.opts.Model,
+	}
+	for _, e := range d.opts.Entities {
+		cfg := map[string]interface{}{
+			"unique_id":          d.NodeID + "_" + e.Object,
+			"object_id":          d.NodeID + "_" + e.Object,
+			"state_topic":        d.StateTopic,
+			"availability_topic": d.AvailabilityTopic,
+			"device":             device,
+		}
+		for k, v := range e.Config {
+			cfg[k] = v
+		}
+		b, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", d.opts.DiscoveryPrefix, e.Component, d.NodeID, e.Object)
+		if err := d.Client.Publish(topic, b, true); err != nil {
+			return err
+		}
+	}
+	return d.Client.Publish(d.AvailabilityTopic, []byte("online"), true)
+}
+
+// Publish connects if needed, announces the entities on every new
+// connection and publishes state as the retained JSON state message
+func (d *Device) Publish(state interface{}) error {
+	fresh, err := d.Client.Connect()
+	if err != nil {
+		return fmt.Errorf("connect %s: %w", d.Client.Addr, err)
+	}
+	if fresh {
+		if err := d.announce(); err != nil {
+			return fmt.Errorf("discovery: %w", err)
+		}
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return d.Client.Publish(d.StateTopic, b, true)
+}
+
+// Close marks the entities unavailable and disconnects. The broker does
+// not publish the will after a clean DISCONNECT, so offline is sent here.
+func (d *Device) Close() {
+	d.Client.Publish(d.AvailabilityTopic, []byte("offline"), true)
+	d.Client.Close()
+}
@@ -0,0 +1,115 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/mqtt"
+	"landing/mqtt/mqtttest"
+)
+
+func TestRemainingLength(t *testing.T) {
+	for _, tc := range []struct {
+		size   int
+		header []byte
+	}{
+		{0, []byte{0x30, 0x00}},
+		{127, []byte{0x30, 0x7f}},
+		{128, []byte{0x30, 0x80, 0x01}},
+		{321, []byte{0x30, 0xc1, 0x02}},
+		{16384, []byte{0x30, 0x80, 0x80, 0x01}},
+	} {
+		pkt := mqtt.Packet(mqtt.Publish, make([]byte, tc.size))
+		if got := pkt[:len(tc.header)]; string(got) != string(tc.header) || len(pkt) != len(tc.header)+tc.size {
+			t.Errorf("%d byte body: header % x, len %d", tc.size, got, len(pkt))
+		}
+		typ, body, err := mqtt.ReadPacket(bufio.NewReader(strings.NewReader(string(pkt))))
+		if err != nil || typ != mqtt.Publish || len(body) != tc.size {
+			t.Errorf("%d byte body round trip: %x %d %v", tc.size, typ, len(body), err)
+		}
+	}
+	if _, _, err := mqtt.ReadPacket(bufio.NewReader(strings.NewReader("\x30\xff\xff\xff\xff\x01"))); err == nil {
+		t.Error("five byte remaining length accepted")
+	}
+}
+
+func TestAppendString(t *testing.T) {
+	if got := mqtt.AppendString([]byte{9}, "MQTT"); string(got) != "\x09\x00\x04MQTT" {
+		t.Errorf("got % x", got)
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	b := mqtttest.NewBroker(t, 0)
+	c := &mqtt.Client{Addr: b.Addr, ClientID: "id", Username: "u", Password: "p",
+		KeepAlive: 90 * time.Second, Timeout: time.Second, WillTopic: "w", WillMessage: "offline"}
+	defer c.Close()
+	if fresh, err := c.Connect(); !fresh || err != nil {
+		t.Fatalf("Connect = %v, %v", fresh, err)
+	}
+	want := "\x00\x04MQTT\x04\xe6\x00\x5a" + "\x00\x02id" + "\x00\x01w\x00\x07offline" + "\x00\x01u\x00\x01p"
+	if got := string(<-b.Connects); got != want {
+		t.Errorf("CONNECT body\n got % x\nwant % x", got, want)
+	}
+	if fresh, err := c.Connect(); fresh || err != nil {
+		t.Errorf("second Connect = %v, %v, want the open connection", fresh, err)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	b := mqtttest.NewBroker(t, 4)
+	c := &mqtt.Client{Addr: b.Addr, ClientID: "x", Timeout: time.Second}
+	if _, err := c.Connect(); err == nil || !strings.Contains(err.Error(), "bad user name or password") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestDevicePublish(t *testing.T) {
+	b := mqtttest.NewBroker(t, 0)
+	d := mqtt.NewDevice(mqtt.Options{
+		Broker: b.Addr, Model: "test-landing", Name: "Test box", Host: "box.lan",
+		TopicPrefix: "test/", DiscoveryPrefix: "homeassistant",
+		Entities: []mqtt.Entity{{Component: "sensor", Object: "load", Config: map[string]interface{}{"value_template": "{{ value_json.load }}"}}},
+	})
+	if err := d.Publish(map[string]int{"load": 3}); err != nil {
+		t.Fatal(err)
+	}
+	var got []mqtttest.Message
+	for range 3 {
+		select {
+		case m := <-b.Messages:
+			got = append(got, m)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d messages: %+v", len(got), got)
+		}
+	}
+	if got[0].Topic != "homeassistant/sensor/test_landing_box_lan/load/config" || !got[0].Retain {
+		t.Errorf("discovery = %+v", got[0])
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(got[0].Payload), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg["state_topic"] != "test/box.lan/state" || cfg["unique_id"] != "test_landing_box_lan_load" || cfg["value_template"] != "{{ value_json.load }}" {
+		t.Errorf("discovery config = %v", cfg)
+	}
+	if got[1].Topic != "test/box.lan/availability" || got[1].Payload != "online" {
+		t.Errorf("availability = %+v", got[1])
+	}
+	if got[2].Topic != "test/box.lan/state" || got[2].Payload != `{"load":3}` {
+		t.Errorf("state = %+v", got[2])
+	}
+
+	d.Close()
+	select {
+	case m := <-b.Messages:
+		if m.Topic != "test/box.lan/availability" || m.Payload != "offline" || !m.Retain {
+			t.Errorf("on close = %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no offline message on Close")
+	}
+}
@@ -0,0 +1,74 @@
+// Package mqtttest provides a fake MQTT broker for tests of code that
+// publishes through package mqtt.
+package mqtttest
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"landing/mqtt"
+)
+
+// Message is a PUBLISH the broker received
+type Message struct {
+	Topic   string
+	Payload string
+	Retain  bool
+}
+
+// Broker accepts connections, answers CONNECT with its return code and
+// forwards CONNECT bodies and PUBLISH messages to its channels
+type Broker struct {
+	Addr     string
+	Connects <-chan []byte
+	Messages <-chan Message
+}
+
+// NewBroker starts a broker on a loopback port for the duration of the test
+func NewBroker(t *testing.T, returnCode byte) *Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	connects := make(chan []byte, 4)
+	msgs := make(chan Message, 64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, returnCode, connects, msgs)
+		}
+	}()
+	return &Broker{Addr: ln.Addr().String(), Connects: connects, Messages: msgs}
+}
+
+func serve(conn net.Conn, returnCode byte, connects chan<- []byte, msgs chan<- Message) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		typ, body, err := mqtt.ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch typ & 0xf0 {
+		case mqtt.Connect:
+			connects <- body
+			conn.Write([]byte{mqtt.Connack, 2, 0, returnCode})
+			if returnCode != 0 {
+				return
+			}
+		case mqtt.Publish:
+			n := int(body[0])<<8 | int(body[1])
+			msgs <- Message{Topic: string(body[2 : 2+n]), Payload: string(body[2+n:]), Retain: typ&0x01 != 0}
+		case mqtt.Pingreq:
+			conn.Write([]byte{mqtt.Pingresp, 0})
+		case mqtt.Disconnect:
+			return
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Package netinfo reads a host's interfaces, IPv6 addresses and default
+// routes from procfs and sysfs and checks them against DNS.
+package netinfo
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IPv6Addr is one IPv6 address from /proc/net/if_inet6
+type IPv6Addr struct {
+	Address string `json:"address"`
+	Prefix  int    `json:"prefix"`
+	Scope   string `json:"scope"` // global, link, host or site
+	// Kind is temporary (RFC 8981 privacy address), eui64 (SLAAC from the
+	// MAC), stable (SLAAC stable-privacy or DHCPv6) or static (configured)
+	Kind       string `json:"kind"`
+	ULA        bool   `json:"ula"`
+	Deprecated bool   `json:"deprecated"`
+	Tentative  bool   `json:"tentative"`
+}
+
+// NetInterface is one network interface and its addresses
+type NetInterface struct {
+	Name string     `json:"name"`
+	MAC  string     `json:"mac,omitempty"`
+	IPv4 []string   `json:"ipv4"`
+	IPv6 []IPv6Addr `json:"ipv6"`
+}
+
+// DefaultRoute is a default route from the kernel routing tables
+type DefaultRoute struct {
+	Family    string `json:"family"` // ipv4 or ipv6
+	Gateway   string `json:"gateway"`
+	Interface string `json:"interface"`
+	Metric    int    `json:"metric"`
+}
+
+// DNSCheck compares the A/AAAA records for the host name with the live
+// addresses. Temporary addresses are never expected in DNS, so only the
+// stable global ones count.
+type DNSCheck struct {
+	Name    string   `json:"name"`
+	A       []string `json:"a"`
+	AAAA    []string `json:"aaaa"`
+	Match   bool     `json:"match"`
+	Missing []string `json:"missing"` // live stable addresses not in DNS
+	Stale   []string `json:"stale"`   // DNS addresses not on any interface
+	Error   string   `json:"error,omitempty"`
+}
+
+// NetworkInfo is the network panel
+type NetworkInfo struct {
+	Listeners  []string       `json:"listeners"`
+	Interfaces []NetInterface `json:"interfaces"`
+	Routes     []DefaultRoute `json:"routes"`
+	DNS        *DNSCheck      `json:"dns,omitempty"`
+}
+
+// if_inet6 flag bits, from include/uapi/linux/if_addr.h
+const (
+	ifaTemporary  = 0x01
+	ifaDeprecated = 0x20
+	ifaTentative  = 0x40
+	ifaPermanent  = 0x80
+)
+
+var ipv6Scopes = map[int]string{0x00: "global", 0x10: "host", 0x20: "link", 0x40: "site"}
+
+// Get reads the live interfaces and routes and checks DNS for dnsName
+func Get(ctx context.Context, listeners []string, dnsName string) NetworkInfo {
+	info := Read("/", InterfaceIPv4)
+	info.Listeners = listeners
+	if dnsName != "" {
+		check := CheckDNS(ctx, net.DefaultResolver, dnsName, info.Interfaces)
+		info.DNS = &check
+	}
+	return info
+}
+
+// InterfaceIPv4 returns the IPv4 addresses (with prefix) of an interface
+func InterfaceIPv4(name string) []string {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+			out = append(out, n.String())
+		}
+	}
+	return out
+}
+
+// Read reads procfs and sysfs below root, which tests point at a fixture
+// tree. procfs has no per-interface IPv4 list, so ipv4 supplies it.
+// Loopback and interfaces without addresses are left out.
+func Read(root string, ipv4 func(name string) []string) NetworkInfo {
+	var info NetworkInfo
+	byName := map[string]*NetInterface{}
+	var names []string
+	iface := func(name string) *NetInterface {
+		if i, ok := byName[name]; ok {
+			return i
+		}
+		i := &NetInterface{Name: name, IPv4: []string{}, IPv6: []IPv6Addr{}}
+		if b, err := os.ReadFile(filepath.Join(root, "sys/class/net", name, "address")); err == nil {
+			i.MAC = strings.TrimSpace(string(b))
+		}
+		byName[name] = i
+		names = append(names, name)
+		return i
+	}
+
+	dirs, _ := filepath.Glob(filepath.Join(root, "sys/class/net/*"))
+	for _, d := range dirs {
+		if name := filepath.Base(d); name != "lo" {
+			iface(name)
+		}
+	}
+
+	if f, err := os.Open(filepath.Join(root, "proc/net/if_inet6")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// address ifindex prefixlen scope flags name
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 6 || fields[5] == "lo" {
+				continue
+			}
+			ip := parseHexIPv6(fields[0])
+			prefix, err1 := strconv.ParseInt(fields[2], 16, 32)
+			scope, err2 := strconv.ParseInt(fields[3], 16, 32)
+			flags, err3 := strconv.ParseInt(fields[4], 16, 32)
+			if ip == nil || err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			i := iface(fields[5])
+			i.IPv6 = append(i.IPv6, classifyIPv6(ip, int(prefix), int(scope), int(flags), i.MAC))
+		}
+		f.Close()
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		i := byName[name]
+		if ipv4 != nil {
+			if v4 := ipv4(name); v4 != nil {
+				i.IPv4 = v4
+			}
+		}
+		if len(i.IPv4) == 0 && len(i.IPv6) == 0 {
+			continue
+		}
+		sort.SliceStable(i.IPv6, func(a, b int) bool { return ipv6Order(i.IPv6[a]) < ipv6Order(i.IPv6[b]) })
+		info.Interfaces = append(info.Interfaces, *i)
+	}
+	info.Routes = append(readIPv4DefaultRoutes(filepath.Join(root, "proc/net/route")),
+		readIPv6DefaultRoutes(filepath.Join(root, "proc/net/ipv6_route"))...)
+	return info
+}
+
+// ipv6Order lists global addresses before link-local, stable before
+// temporary
+func ipv6Order(a IPv6Addr) int {
+	n := 0
+	if a.Scope != "global" {
+		n += 10
+	}
+	if a.Kind == "temporary" {
+		n++
+	}
+	return n
+}
+
+func parseHexIPv6(s string) net.IP {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != net.IPv6len {
+		return nil
+	}
+	return net.IP(b)
+}
+
+func classifyIPv6(ip net.IP, prefix, scope, flags int, mac string) IPv6Addr {
+	a := IPv6Addr{
+		Address:    ip.String(),
+		Prefix:     prefix,
+		Scope:      ipv6Scopes[scope],
+		ULA:        ip[0]&0xfe == 0xfc,
+		Deprecated: flags&ifaDeprecated != 0,
+		Tentative:  flags&ifaTentative != 0,
+	}
+	if a.Scope == "" {
+		a.Scope = "0x" + strconv.FormatInt(int64(scope), 16)
+	}
+	switch {
+	case flags&ifaTemporary != 0:
+		a.Kind = "temporary"
+	case isEUI64(ip, mac):
+		a.Kind = "eui64"
+	case flags&ifaPermanent != 0:
+		a.Kind = "static"
+	default:
+		a.Kind = "stable"
+	}
+	return a
+}
+
+// isEUI64 reports whether the interface identifier was derived from mac:
+// the MAC split by ff:fe with the universal/local bit flipped
+func isEUI64(ip net.IP, mac string) bool {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return false
+	}
+	iid := ip[8:]
+	return iid[0] == hw[0]^0x02 && iid[1] == hw[1] && iid[2] == hw[2] &&
+		iid[3] == 0xff && iid[4] == 0xfe &&
+		iid[5] == hw[3] && iid[6] == hw[4] && iid[7] == hw[5]
+}
+
+// readIPv4DefaultRoutes parses /proc/net/route, where addresses are
+// little-endian hex
+func readIPv4DefaultRoutes(path string) []DefaultRoute {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var routes []DefaultRoute
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != 4 {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		routes = append(routes, DefaultRoute{
+			Family:    "ipv4",
+			Gateway:   net.IPv4(gw[3], gw[2], gw[1], gw[0]).String(),
+			Interface: fields[0],
+			Metric:    metric,
+		})
+	}
+	return routes
+}
+
+// readIPv6DefaultRoutes parses /proc/net/ipv6_route for ::/0 routes with a
+// next hop
+func readIPv6DefaultRoutes(path string) []DefaultRoute {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var routes []DefaultRoute
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// dest destlen src srclen nexthop metric refcnt use flags iface
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 10 || fields[1] != "00" || fields[9] == "lo" || strings.Trim(fields[0], "0") != "" {
+			continue
+		}
+		hop := parseHexIPv6(fields[4])
+		if hop == nil || hop.IsUnspecified() {
+			continue
+		}
+		metric, _ := strconv.ParseInt(fields[5], 16, 64)
+		routes = append(routes, DefaultRoute{
+			Family:    "ipv6",
+			Gateway:   hop.String(),
+			Interface: fields[9],
+			Metric:    int(metric),
+		})
+	}
+	return routes
+}
+
+// Resolver is the part of net.Resolver CheckDNS uses
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// CheckDNS looks up name and compares it with the stable global addresses
+// of the interfaces. Temporary, deprecated and ULA IPv6 addresses are not
+// expected in DNS and are ignored.
+func CheckDNS(ctx context.Context, r Resolver, name string, ifaces []NetInterface) DNSCheck {
+	check := DNSCheck{Name: name, A: []string{}, AAAA: []string{}, Missing: []string{}, Stale: []string{}}
+	addrs, err := r.LookupIPAddr(ctx, name)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	live := map[string]bool{}
+	var expected []string
+	for _, i := range ifaces {
+		for _, v4 := range i.IPv4 {
+			ip, _, err := net.ParseCIDR(v4)
+			if err != nil {
+				continue
+			}
+			live[ip.String()] = true
+		}
+		for _, a := range i.IPv6 {
+			live[a.Address] = true
+			if a.Scope == "global" && !a.ULA && a.Kind != "temporary" && !a.Deprecated {
+				expected = append(expected, a.Address)
+			}
+		}
+	}
+	inDNS := map[string]bool{}
+	for _, a := range addrs {
+		s := a.IP.String()
+		inDNS[s] = true
+		if a.IP.To4() != nil {
+			check.A = append(check.A, s)
+		} else {
+			check.AAAA = append(check.AAAA, s)
+		}
+		if !live[s] {
+			check.Stale = append(check.Stale, s)
+		}
+	}
+	for _, e := range expected {
+		if !inDNS[e] {
+			check.Missing = append(check.Missing, e)
+		}
+	}
+	sort.Strings(check.A)
+	sort.Strings(check.AAAA)
+	check.Match = len(check.AAAA) > 0 && len(check.Missing) == 0 && len(check.Stale) == 0
+	return check
+}
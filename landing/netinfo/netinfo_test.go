@@ -0,0 +1,94 @@
+package netinfo
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestReadNetwork(t *testing.T) {
+	info := Read("testdata/net", func(name string) []string {
+		if name == "eth0" {
+			return []string{"172.16.16.108/16"}
+		}
+		return nil
+	})
+	if len(info.Interfaces) != 1 || info.Interfaces[0].Name != "eth0" {
+		t.Fatalf("interfaces = %+v", info.Interfaces)
+	}
+	eth0 := info.Interfaces[0]
+	if eth0.MAC != "bc:24:11:60:2d:fe" || !reflect.DeepEqual(eth0.IPv4, []string{"172.16.16.108/16"}) {
+		t.Errorf("eth0 = %+v", eth0)
+	}
+
+	want := []struct {
+		addr   string
+		prefix int
+		scope  string
+		kind   string
+	}{
+		{"2603:8001:7400:fa9a:be24:11ff:fe60:2dfe", 64, "global", "eui64"},
+		{"fde6:19bd:3ffd:0:be24:11ff:fe60:2dfe", 64, "global", "eui64"},
+		{"2603:8001:7400:fa9a::108", 128, "global", "static"},
+		{"2603:8001:7400:fa9a:3c1d:2e4f:5a6b:7c8d", 64, "global", "temporary"},
+		{"fe80::be24:11ff:fe60:2dfe", 64, "link", "eui64"},
+	}
+	if len(eth0.IPv6) != len(want) {
+		t.Fatalf("ipv6 = %+v", eth0.IPv6)
+	}
+	for i, w := range want {
+		got := eth0.IPv6[i]
+		if got.Address != w.addr || got.Scope != w.scope || got.Kind != w.kind || got.Prefix != w.prefix {
+			t.Errorf("ipv6[%d] = %+v, want %v", i, got, w)
+		}
+	}
+	if !eth0.IPv6[1].ULA || eth0.IPv6[0].ULA {
+		t.Errorf("ULA flags wrong: %+v", eth0.IPv6[:2])
+	}
+
+	wantRoutes := []DefaultRoute{
+		{Family: "ipv4", Gateway: "172.16.16.16", Interface: "eth0", Metric: 100},
+		{Family: "ipv6", Gateway: "fe80::a236:9fff:fe66:27ac", Interface: "eth0", Metric: 1024},
+	}
+	if !reflect.DeepEqual(info.Routes, wantRoutes) {
+		t.Errorf("routes = %+v, want %+v", info.Routes, wantRoutes)
+	}
+}
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var out []net.IPAddr
+	for _, a := range addrs {
+		out = append(out, net.IPAddr{IP: net.ParseIP(a)})
+	}
+	return out, nil
+}
+
+func TestCheckDNS(t *testing.T) {
+	ifaces := Read("testdata/net", func(string) []string { return []string{"172.16.16.108/16"} }).Interfaces
+	r := fakeResolver{
+		"ntp.alpina":   {"172.16.16.108", "2603:8001:7400:fa9a:be24:11ff:fe60:2dfe", "2603:8001:7400:fa9a::108"},
+		"stale.alpina": {"172.16.16.108", "2603:8001:7400:fa9a:be24:11ff:fe60:aaaa"},
+		"v4.alpina":    {"172.16.16.108"},
+	}
+
+	if c := CheckDNS(context.Background(), r, "ntp.alpina", ifaces); !c.Match || len(c.AAAA) != 2 || len(c.A) != 1 {
+		t.Errorf("matching = %+v", c)
+	}
+	c := CheckDNS(context.Background(), r, "stale.alpina", ifaces)
+	if c.Match || !reflect.DeepEqual(c.Stale, []string{"2603:8001:7400:fa9a:be24:11ff:fe60:aaaa"}) || len(c.Missing) != 2 {
+		t.Errorf("stale = %+v", c)
+	}
+	if c := CheckDNS(context.Background(), r, "v4.alpina", ifaces); c.Match || len(c.AAAA) != 0 {
+		t.Errorf("no AAAA = %+v", c)
+	}
+	if c := CheckDNS(context.Background(), r, "gone.alpina", ifaces); c.Match || c.Error == "" {
+		t.Errorf("lookup error = %+v", c)
+	}
+}
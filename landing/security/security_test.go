@@ -0,0 +1,43 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	Headers(nil, ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	h := rec.Header()
+	csp := h.Get("Content-Security-Policy")
+	for _, want := range []string{"default-src 'none'", "script-src 'self';", "frame-ancestors 'none'"} {
+		if !strings.Contains(csp, want) {
+			t.Errorf("CSP %q missing %q", csp, want)
+		}
+	}
+	if strings.Contains(csp, "script-src 'self' 'unsafe-inline'") || strings.Contains(csp, "cdn.") {
+		t.Errorf("CSP too loose: %q", csp)
+	}
+	for k, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "same-origin",
+	} {
+		if got := h.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	Headers([]string{"https://home.alpina"}, ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.HasSuffix(csp, "frame-ancestors https://home.alpina") {
+		t.Errorf("CSP with frame ancestors = %q", csp)
+	}
+	if xfo := rec.Header().Get("X-Frame-Options"); xfo != "" {
+		t.Errorf("X-Frame-Options = %q alongside frame-ancestors", xfo)
+	}
+}
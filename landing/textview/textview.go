@@ -0,0 +1,79 @@
+// Package textview holds what the landing pages' terminal views share:
+// picking the format of "/" and the ANSI styling, column padding and
+// usage bars they are drawn with.
+package textview
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats are the values of the ?format= override of "/"
+var Formats = map[string]bool{"html": true, "ansi": true, "text": true}
+
+// Format says how "/" is rendered: "html", "ansi" (text with colours) or
+// "text". ?format= wins; otherwise command-line clients and clients asking
+// for text/plain without text/html get ANSI.
+func Format(r *http.Request) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/plain") && !strings.Contains(accept, "text/html") {
+		return "ansi"
+	}
+	ua := strings.ToLower(r.UserAgent())
+	for _, cli := range []string{"curl/", "wget/", "httpie/", "xh/"} {
+		if strings.HasPrefix(ua, cli) {
+			return "ansi"
+		}
+	}
+	return "html"
+}
+
+// ANSI styles; they combine by concatenation, e.g. Bold+Blue
+const (
+	Reset  = "\x1b[0m"
+	Bold   = "\x1b[1m"
+	Dim    = "\x1b[2m"
+	Red    = "\x1b[31m"
+	Green  = "\x1b[32m"
+	Yellow = "\x1b[33m"
+	Blue   = "\x1b[34m"
+	Cyan   = "\x1b[36m"
+)
+
+// Painter colours text when the view is rendered as ANSI and leaves it
+// alone for plain text
+type Painter bool
+
+func (p Painter) Paint(style, s string) string {
+	if !p || style == "" {
+		return s
+	}
+	return style + s + Reset
+}
+
+// Pad left-aligns s in a column of width runes; padding before painting
+// keeps escape codes out of the width calculation
+func Pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// UsageBar draws a 20 cell bar, yellow above 70% and red above 90%
+func UsageBar(p Painter, pct float64) string {
+	filled := int(math.Round(math.Max(0, math.Min(pct, 100)) / 5))
+	style := Green
+	switch {
+	case pct > 90:
+		style = Red
+	case pct > 70:
+		style = Yellow
+	}
+	return "[" + p.Paint(style, strings.Repeat("#", filled)) + strings.Repeat(" ", 20-filled) + "]"
+}
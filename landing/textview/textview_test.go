@@ -0,0 +1,64 @@
+package textview
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		url, ua, accept, want string
+	}{
+		{"/", "Mozilla/5.0", "text/html,application/xhtml+xml,*/*;q=0.8", "html"},
+		{"/", "curl/8.5.0", "*/*", "ansi"},
+		{"/", "Wget/1.21", "*/*", "ansi"},
+		{"/", "Go-http-client/1.1", "text/plain", "ansi"},
+		{"/", "Mozilla/5.0", "text/html, text/plain;q=0.5", "html"},
+		{"/?format=html", "curl/8.5.0", "", "html"},
+		{"/?format=text", "Mozilla/5.0", "text/html", "text"},
+		{"/?format=pdf", "", "", "pdf"},
+	} {
+		r := httptest.NewRequest("GET", tc.url, nil)
+		r.Header.Set("User-Agent", tc.ua)
+		r.Header.Set("Accept", tc.accept)
+		if got := Format(r); got != tc.want {
+			t.Errorf("%s UA %q Accept %q: got %s, want %s", tc.url, tc.ua, tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"CPU", 6, "CPU   "},
+		{"Größe", 6, "Größe "},
+		{"too long", 3, "too long"},
+	} {
+		if got := Pad(tc.s, tc.width); got != tc.want {
+			t.Errorf("Pad(%q, %d) = %q, want %q", tc.s, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestUsageBar(t *testing.T) {
+	for _, tc := range []struct {
+		pct  float64
+		ansi bool
+		want string
+	}{
+		{0, false, "[                    ]"},
+		{42.4, false, "[########            ]"},
+		{150, false, "[####################]"},
+		{-5, false, "[                    ]"},
+		{50, true, "[" + Green + "##########" + Reset + "          ]"},
+		{75, true, "[" + Yellow + "###############" + Reset + "     ]"},
+		{95, true, "[" + Red + "###################" + Reset + " ]"},
+	} {
+		if got := UsageBar(Painter(tc.ansi), tc.pct); got != tc.want {
+			t.Errorf("UsageBar(%v, %v) = %q, want %q", tc.ansi, tc.pct, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminOperation is one entry of the allow-list of chrony operations the
+// admin page may run. Nothing outside this list ever reaches chronyc.
+type adminOperation struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	// Target is "none", "optional" or "required": whether the operation
+	// takes a source address
+	Target string   `json:"target"`
+	args   []string // chronyc arguments before the optional target
+}
+
+var adminOperations = []adminOperation{
+	{Name: "burst", Label: "Burst", Target: "optional", args: []string{"burst", "4/4"},
+		Description: "Send a burst of 4 requests to all sources, or one source, to get fresh measurements quickly"},
+	{Name: "makestep", Label: "Step Clock", Target: "none", args: []string{"makestep"},
+		Description: "Step the system clock immediately instead of slewing away the current offset"},
+	{Name: "online", Label: "Online", Target: "optional", args: []string{"online"},
+		Description: "Mark sources as reachable so chronyd resumes polling them"},
+	{Name: "offline", Label: "Offline", Target: "optional", args: []string{"offline"},
+		Description: "Mark sources as unreachable so chronyd stops polling them"},
+	{Name: "reload-sources", Label: "Reload Sources", Target: "none", args: []string{"reload", "sources"},
+		Description: "Re-read the sourcedir files and apply added or removed sources"},
+	{Name: "refresh", Label: "Refresh", Target: "none", args: []string{"refresh"},
+		Description: "Re-resolve source hostnames and repeat NTS key establishment"},
+	{Name: "rekey", Label: "Rotate Keys", Target: "none", args: []string{"rekey"},
+		Description: "Re-read the keyfile, and the NTS server keys from ntsdumpdir when automatic rotation is disabled"},
+}
+
+func findAdminOperation(name string) (adminOperation, bool) {
+	for _, op := range adminOperations {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return adminOperation{}, false
+}
+
+// commandArgs validates target against the operation and the live source
+// names and returns the full chronyc argument list.
+func (op adminOperation) commandArgs(target string, sources []NTPSource) ([]string, error) {
+	args := append([]string(nil), op.args...)
+	switch {
+	case target == "" && op.Target == "required":
+		return nil, fmt.Errorf("%s needs a source", op.Name)
+	case target == "":
+		return args, nil
+	case op.Target == "none":
+		return nil, fmt.Errorf("%s does not take a source", op.Name)
+	}
+	for _, src := range sources {
+		if src.Name == target {
+			return append(args, target), nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not a current source", target)
+}
+
+// chronycRunner runs chronyc with the given arguments. Tests replace it.
+type chronycRunner func(ctx context.Context, args ...string) (string, error)
+
+// runChronyc runs a privileged chronyc command. Privileged commands go over
+// chronyd's Unix socket, so the service must run as root or chrony.
+func runChronyc(ctx context.Context, args ...string) (string, error) {
+	start := time.Now()
+	out, err := exec.CommandContext(ctx, "chronyc", append([]string{"-n"}, args...)...).CombinedOutput()
+	selfMetrics.ObserveChronyc(args[0], time.Since(start), err)
+	return strings.TrimSpace(string(out)), err
+}
+
+// AuditEntry is one line of the admin audit log
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Remote    string    `json:"remote"`
+	Operation string    `json:"operation"`
+	Target    string    `json:"target,omitempty"`
+	Result    string    `json:"result"` // ok, failed or denied
+	Output    string    `json:"output,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog appends entries as JSON lines to a file and keeps the most
+// recent ones in memory for the admin page. Every entry is also written to
+// the service log, so actions are recorded even when the file cannot be
+// opened.
+type auditLog struct {
+	path   string
+	keep   int
+	mu     sync.Mutex
+	recent []AuditEntry
+}
+
+func newAuditLog(path string, keep int) *auditLog {
+	return &auditLog{path: path, keep: keep}
+}
+
+func (a *auditLog) Record(e AuditEntry) {
+	line, _ := json.Marshal(e)
+	slog.Info("admin action", "component", "audit", "user", e.User, "remote", e.Remote,
+		"operation", e.Operation, "target", e.Target, "result", e.Result, "error", e.Error)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recent = append(a.recent, e)
+	if len(a.recent) > a.keep {
+		a.recent = a.recent[len(a.recent)-a.keep:]
+	}
+	if a.path == "" {
+		return
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Error("audit log unwritable", "component", "audit", "path", a.path, "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("audit log unwritable", "component", "audit", "path", a.path, "error", err)
+	}
+}
+
+// Recent returns the in-memory entries, newest first
+func (a *auditLog) Recent() []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]AuditEntry, len(a.recent))
+	for i, e := range a.recent {
+		out[len(out)-1-i] = e
+	}
+	return out
+}
+
+// csrfTokens issues and checks stateless CSRF tokens: a timestamp and an
+// HMAC over user and timestamp with a per-process key. Tokens die with the
+// process and after ttl.
+type csrfTokens struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+func newCSRFTokens(ttl time.Duration) *csrfTokens {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("csrf key: %v", err)
+	}
+	return &csrfTokens{key: key, ttl: ttl, now: time.Now}
+}
+
+func (c *csrfTokens) mac(user, ts string) []byte {
+	m := hmac.New(sha256.New, c.key)
+	m.Write([]byte(user + "\x00" + ts))
+	return m.Sum(nil)
+}
+
+func (c *csrfTokens) Issue(user string) string {
+	ts := strconv.FormatInt(c.now().Unix(), 10)
+	return ts + "." + base64.RawURLEncoding.EncodeToString(c.mac(user, ts))
+}
+
+func (c *csrfTokens) Valid(user, token string) bool {
+	ts, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	issued, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := c.now().Sub(time.Unix(issued, 0))
+	if age < 0 || age > c.ttl {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, c.mac(user, ts))
+}
+
+// sameOrigin rejects cross-site form posts when the browser says where the
+// request came from. Requests without Origin or Referer (curl) pass and
+// rely on the CSRF token alone.
+func sameOrigin(r *http.Request) bool {
+	src := r.Header.Get("Origin")
+	if src == "" {
+		src = r.Header.Get("Referer")
+	}
+	if src == "" {
+		return true
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// AdminResult is the response of POST /api/admin/run
+type AdminResult struct {
+	Operation string `json:"operation"`
+	Target    string `json:"target,omitempty"`
+	OK        bool   `json:"ok"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AdminPageData is passed to admin.html
+type AdminPageData struct {
+	Hostname   string
+	User       string
+	CSRFToken  string
+	Operations []adminOperation
+	Sources    []NTPSource
+	Audit      []AuditEntry
+	UpdatedAt  string
+}
+
+// adminServer serves the admin page and runs allow-listed operations
+type adminServer struct {
+	auth    *authPolicy
+	csrf    *csrfTokens
+	audit   *auditLog
+	run     chronycRunner
+	timeout time.Duration
+	sources func() []NTPSource
+	page    func(w http.ResponseWriter, data AdminPageData) error
+}
+
+// authenticate answers 401 or 403 unless the caller is an admin
+func (s *adminServer) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id, ok := s.auth.Require(w, r, RoleAdmin)
+	return id.User, ok
+}
+
+// recordDenied is the auth policy's denied hook, so rejected logins end up
+// in the audit log
+func (s *adminServer) recordDenied(r *http.Request, user string, err error) {
+	s.audit.Record(AuditEntry{Time: time.Now(), User: user, Remote: remoteHost(r), Operation: "login", Result: "denied", Error: err.Error()})
+}
+
+func (s *adminServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	hostname, _ := os.Hostname()
+	data := AdminPageData{
+		Hostname:   hostname,
+		User:       user,
+		CSRFToken:  s.csrf.Issue(user),
+		Operations: adminOperations,
+		Sources:    s.sources(),
+		Audit:      s.audit.Recent(),
+		UpdatedAt:  time.Now().Format("2006-01-02 15:04:05 MST"),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := s.page(w, data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Internal Server Error", 500)
+	}
+}
+
+func (s *adminServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	entry := AuditEntry{
+		Time:      time.Now(),
+		User:      user,
+		Remote:    remoteHost(r),
+		Operation: r.PostForm.Get("op"),
+		Target:    r.PostForm.Get("target"),
+	}
+	deny := func(status int, reason string) {
+		entry.Result, entry.Error = "denied", reason
+		s.audit.Record(entry)
+		writeAdminResult(w, status, AdminResult{Operation: entry.Operation, Target: entry.Target, Error: reason})
+	}
+
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = r.PostForm.Get("csrf")
+	}
+	if !sameOrigin(r) || !s.csrf.Valid(user, token) {
+		deny(http.StatusForbidden, "missing or invalid CSRF token")
+		return
+	}
+	op, ok := findAdminOperation(entry.Operation)
+	if !ok {
+		deny(http.StatusBadRequest, "operation is not allowed")
+		return
+	}
+	args, err := op.commandArgs(entry.Target, s.sources())
+	if err != nil {
+		deny(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	out, err := s.run(ctx, args...)
+	res := AdminResult{Operation: op.Name, Target: entry.Target, OK: err == nil, Output: out}
+	entry.Output = out
+	entry.Result = "ok"
+	status := http.StatusOK
+	if err != nil {
+		entry.Result, entry.Error, res.Error = "failed", err.Error(), err.Error()
+		status = http.StatusBadGateway
+	}
+	s.audit.Record(entry)
+	writeAdminResult(w, status, res)
+}
+
+func (s *adminServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticate(w, r); !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.audit.Recent())
+}
+
+func writeAdminResult(w http.ResponseWriter, status int, res AdminResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
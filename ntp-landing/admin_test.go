@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeChronyc struct {
+	calls [][]string
+	out   string
+	err   error
+}
+
+func (f *fakeChronyc) run(_ context.Context, args ...string) (string, error) {
+	f.calls = append(f.calls, args)
+	return f.out, f.err
+}
+
+func newTestAdmin(t *testing.T, runner *fakeChronyc) *adminServer {
+	t.Helper()
+	sum := sha256.Sum256([]byte("s3cret"))
+	creds, err := newAdminCredentials("admin", hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := parseAdminTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &adminServer{
+		auth:    &authPolicy{mode: "none", id: creds, admins: map[string]bool{"admin": true}, anonymous: RoleViewer},
+		csrf:    newCSRFTokens(time.Hour),
+		audit:   newAuditLog(filepath.Join(t.TempDir(), "audit.log"), 10),
+		run:     runner.run,
+		timeout: time.Second,
+		sources: func() []NTPSource {
+			return []NTPSource{{Name: "time.cloudflare.com"}, {Name: "nts.netnod.se"}}
+		},
+		page: func(w http.ResponseWriter, data AdminPageData) error {
+			return tmpl.Execute(w, data)
+		},
+	}
+	s.auth.denied = s.recordDenied
+	return s
+}
+
+func adminPost(s *adminServer, form url.Values, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/run", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("admin", "s3cret")
+	if token != "" {
+		req.Header.Set("X-CSRF-Token", token)
+	}
+	rec := httptest.NewRecorder()
+	s.handleRun(rec, req)
+	return rec
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	s := newTestAdmin(t, &fakeChronyc{})
+
+	rec := httptest.NewRecorder()
+	s.handlePage(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("anonymous: code %d, headers %v", rec.Code, rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.SetBasicAuth("admin", "wrong")
+	rec = httptest.NewRecorder()
+	s.handlePage(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: code %d", rec.Code)
+	}
+	if a := s.audit.Recent(); len(a) != 1 || a[0].Operation != "login" || a[0].Result != "denied" {
+		t.Errorf("audit = %+v", a)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	rec = httptest.NewRecorder()
+	s.handlePage(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("authenticated: code %d", rec.Code)
+	}
+	for _, want := range []string{`name="csrf-token"`, "Reload Sources", "nts.netnod.se", "bad credentials"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("admin page missing %q", want)
+		}
+	}
+}
+
+func TestAdminRunChecksCSRF(t *testing.T) {
+	runner := &fakeChronyc{}
+	s := newTestAdmin(t, runner)
+
+	rec := adminPost(s, url.Values{"op": {"makestep"}}, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("no token: code %d", rec.Code)
+	}
+	rec = adminPost(s, url.Values{"op": {"makestep"}}, s.csrf.Issue("someone-else"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("token for another user: code %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/run", strings.NewReader("op=makestep"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("X-CSRF-Token", s.csrf.Issue("admin"))
+	req.SetBasicAuth("admin", "s3cret")
+	rec = httptest.NewRecorder()
+	s.handleRun(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("cross origin: code %d", rec.Code)
+	}
+
+	if len(runner.calls) != 0 {
+		t.Errorf("chronyc ran without a valid token: %v", runner.calls)
+	}
+	for _, e := range s.audit.Recent() {
+		if e.Result != "denied" {
+			t.Errorf("audit entry %+v should be denied", e)
+		}
+	}
+}
+
+func TestAdminRunAllowList(t *testing.T) {
+	runner := &fakeChronyc{out: "200 OK"}
+	s := newTestAdmin(t, runner)
+	token := s.csrf.Issue("admin")
+
+	for _, tc := range []struct {
+		form url.Values
+		code int
+	}{
+		{url.Values{"op": {"shutdown"}}, http.StatusBadRequest},
+		{url.Values{"op": {"makestep"}, "target": {"time.cloudflare.com"}}, http.StatusBadRequest},
+		{url.Values{"op": {"burst"}, "target": {"10.0.0.1; reboot"}}, http.StatusBadRequest},
+		{url.Values{"op": {"burst"}, "target": {"nts.netnod.se"}}, http.StatusOK},
+		{url.Values{"op": {"reload-sources"}}, http.StatusOK},
+	} {
+		if rec := adminPost(s, tc.form, token); rec.Code != tc.code {
+			t.Errorf("%v: code %d, want %d: %s", tc.form, rec.Code, tc.code, rec.Body)
+		}
+	}
+
+	want := [][]string{{"burst", "4/4", "nts.netnod.se"}, {"reload", "sources"}}
+	if len(runner.calls) != len(want) {
+		t.Fatalf("calls = %v", runner.calls)
+	}
+	for i := range want {
+		if strings.Join(runner.calls[i], " ") != strings.Join(want[i], " ") {
+			t.Errorf("call %d = %v, want %v", i, runner.calls[i], want[i])
+		}
+	}
+}
+
+func TestAdminRunAudit(t *testing.T) {
+	runner := &fakeChronyc{out: "501 Not authorised", err: errors.New("exit status 1")}
+	s := newTestAdmin(t, runner)
+
+	rec := adminPost(s, url.Values{"op": {"offline"}}, s.csrf.Issue("admin"))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("code %d", rec.Code)
+	}
+	var res AdminResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.OK || res.Output != "501 Not authorised" {
+		t.Errorf("result = %+v (%v)", res, err)
+	}
+
+	b, err := os.ReadFile(s.audit.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("audit file:\n%s", b)
+	}
+	var e AuditEntry
+	if err := json.Unmarshal(lines[0], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.User != "admin" || e.Operation != "offline" || e.Result != "failed" || e.Error != "exit status 1" || e.Remote != "192.0.2.1" {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
+
+func TestCSRFTokenExpiry(t *testing.T) {
+	c := newCSRFTokens(time.Hour)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	tok := c.Issue("admin")
+	if !c.Valid("admin", tok) {
+		t.Fatal("fresh token rejected")
+	}
+	if c.Valid("admin", tok+"x") || c.Valid("admin", "garbage") {
+		t.Error("tampered token accepted")
+	}
+	now = now.Add(2 * time.Hour)
+	if c.Valid("admin", tok) {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestAdminCredentialsDisabled(t *testing.T) {
+	if c, err := newAdminCredentials("admin", ""); c != nil || err != nil {
+		t.Errorf("empty hash: %v, %v", c, err)
+	}
+	if _, err := newAdminCredentials("admin", "abc"); err == nil {
+		t.Error("short hash accepted")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"landing/api"
+)
+
+// openAPISpec documents /api/v1. api_test.go checks it against the
+// response types, so a change to a JSON field has to be made here too.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+const apiV1 = "/api/v1/"
+
+// StatsResponse is GET /api/v1/stats
+type StatsResponse struct {
+	NTP      NTPStats      `json:"ntp"`
+	System   SystemStats   `json:"system"`
+	Hardware ClockHardware `json:"hardware"`
+}
+
+// APIError is the body of every JSON error response
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// handleAPI registers h at /api/v1/<name> and keeps the unversioned
+// /api/<name> it replaces as a deprecated alias
+func handleAPI(name string, h http.HandlerFunc) {
+	http.HandleFunc(apiV1+name, h)
+	http.HandleFunc("/api/"+name, api.DeprecatedAlias(apiV1+name, h))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeCachedJSON answers like writeJSON with an ETag of the body, and lets
+// browsers reuse the response for maxAge; If-None-Match gets a 304
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, maxAge time.Duration, v any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, APIError{Error: msg})
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(openAPISpec)
+}
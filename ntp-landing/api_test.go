@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/loki"
+	"landing/netinfo"
+)
+
+// apiV1Responses is the 200 response type of every /api/v1 endpoint. The
+// contract tests derive JSON schemas from these types and compare them
+// with openapi.json, so renaming, retyping or dropping a field fails here
+// until the spec (and the API version, if it breaks clients) is updated.
+var apiV1Responses = map[string]any{
+	"/api/v1/stats":     StatsResponse{},
+	"/api/v1/charts":    ChartDataSet{},
+	"/api/v1/stability": StabilityReport{},
+	"/api/v1/timex":     TimexReading{},
+	"/api/v1/events":    []Event{},
+	"/api/v1/logs":      loki.LogsResponse{},
+	"/api/v1/network":   netinfo.NetworkInfo{},
+	"/api/v1/alerts":    []AlertState{},
+	"/api/v1/problems":  []ProblemSource{},
+	"/api/v1/nts":       []NTSHealth{},
+	"/api/v1/config":    ConfigPageData{},
+	"/api/v1/whoami":    Identity{},
+}
+
+// apiV1Streams is the line type of the NDJSON endpoints, checked the same way
+var apiV1Streams = map[string]any{
+	"/api/v1/export": SeriesRow{},
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaOf derives the schema encoding/json produces for t, using the
+// subset of JSON Schema openapi.json is written in. Named structs become
+// $refs and are collected into named.
+func schemaOf(t reflect.Type, named map[string]reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), named)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), named)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, named)
+		}
+		if _, seen := named[t.Name()]; !seen {
+			named[t.Name()] = t
+			structSchema(t, named) // collect nested types
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// structSchema lists the JSON properties of a struct; fields without
+// omitempty are required
+func structSchema(t reflect.Type, named map[string]reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []any
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = schemaOf(f.Type, named)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Slice(required, func(i, j int) bool { return required[i].(string) < required[j].(string) })
+		s["required"] = required
+	}
+	return s
+}
+
+// contractOnly strips the documentation keywords from a spec schema so
+// it can be compared with schemaOf
+func contractOnly(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for k, x := range v {
+			switch k {
+			case "description", "example", "enum", "title":
+				continue
+			case "properties":
+				// property names are data, not keywords
+				props := map[string]any{}
+				for name, p := range x.(map[string]any) {
+					props[name] = contractOnly(p)
+				}
+				out[k] = props
+				continue
+			case "required":
+				req := append([]any(nil), x.([]any)...)
+				sort.Slice(req, func(i, j int) bool { return req[i].(string) < req[j].(string) })
+				out[k] = req
+				continue
+			}
+			out[k] = contractOnly(x)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, x := range v {
+			out[i] = contractOnly(x)
+		}
+		return out
+	}
+	return v
+}
+
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Paths   map[string]map[string]struct {
+		Responses map[string]struct {
+			Content map[string]struct {
+				Schema map[string]any `json:"schema"`
+			} `json:"content"`
+		} `json:"responses"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi = %q", doc.OpenAPI)
+	}
+	return doc
+}
+
+func jsonRoundTrip(t *testing.T, v any) any {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	json.Unmarshal(b, &out)
+	return out
+}
+
+func TestOpenAPIResponsesMatchTypes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	named := map[string]reflect.Type{}
+	check := func(responses map[string]any, mediaType string) {
+		for path, v := range responses {
+			op, ok := doc.Paths[path]["get"]
+			if !ok {
+				t.Errorf("%s: no GET in openapi.json", path)
+				continue
+			}
+			want := jsonRoundTrip(t, schemaOf(reflect.TypeOf(v), named))
+			got := contractOnly(op.Responses["200"].Content[mediaType].Schema)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: 200 %s schema %v, type gives %v", path, mediaType, got, want)
+			}
+		}
+	}
+	check(apiV1Responses, "application/json")
+	check(apiV1Streams, "application/x-ndjson")
+
+	for name, typ := range named {
+		spec, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("components/schemas/%s missing", name)
+			continue
+		}
+		want := jsonRoundTrip(t, structSchema(typ, map[string]reflect.Type{}))
+		if got := contractOnly(spec); !reflect.DeepEqual(got, want) {
+			gb, _ := json.Marshal(got)
+			wb, _ := json.Marshal(want)
+			t.Errorf("schema %s does not match %s:\n spec: %s\n type: %s", name, typ, gb, wb)
+		}
+	}
+	for name := range doc.Components.Schemas {
+		if _, ok := named[name]; !ok && name != "APIError" {
+			t.Errorf("components/schemas/%s is not used by any response", name)
+		}
+	}
+}
+
+// TestOpenAPICoversRoutes parses main.go for handleAPI registrations, so
+// an endpoint cannot be added to /api/v1 without documenting it
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := map[string]bool{"/api/v1/openapi.json": true, "/api/v1/whoami": true}
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "handleAPI" {
+			if lit, ok := call.Args[0].(*ast.BasicLit); ok {
+				name, _ := strconv.Unquote(lit.Value)
+				routes[apiV1+name] = true
+			}
+		}
+		return true
+	})
+	if len(routes) < 10 {
+		t.Fatalf("found only %d routes in main.go", len(routes))
+	}
+	for r := range routes {
+		if _, ok := doc.Paths[r]; !ok {
+			t.Errorf("%s is served but not in openapi.json", r)
+		}
+		_, isStream := apiV1Streams[r]
+		if _, ok := apiV1Responses[r]; !ok && !isStream && r != "/api/v1/openapi.json" {
+			t.Errorf("%s has no entry in apiV1Responses", r)
+		}
+	}
+	for p := range doc.Paths {
+		if !routes[p] {
+			t.Errorf("openapi.json documents %s, which is not served", p)
+		}
+	}
+}
+
+func TestWriteCachedJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeCachedJSON(rec, httptest.NewRequest("GET", "/api/v1/charts", nil), 5*time.Minute, APIError{Error: "x"})
+	etag := rec.Header().Get("ETag")
+	if rec.Code != 200 || etag == "" || rec.Body.String() != "{\"error\":\"x\"}\n" {
+		t.Fatalf("code %d, etag %q, body %q", rec.Code, etag, rec.Body.String())
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "private, max-age=300" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/charts", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	writeCachedJSON(rec, req, 5*time.Minute, APIError{Error: "x"})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("revalidation: code %d, body %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	writeCachedJSON(rec, req, 5*time.Minute, APIError{Error: "y"})
+	if rec.Code != 200 || rec.Header().Get("ETag") == etag {
+		t.Errorf("changed body: code %d, etag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
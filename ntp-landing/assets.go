@@ -0,0 +1,25 @@
+package main
+
+import (
+	"embed"
+
+	"landing/assets"
+)
+
+// Chart.js is vendored rather than loaded from a CDN so the charts work
+// without internet access. static/SHA256SUMS holds the upstream SHA-256
+// of the pinned release (the "hash" jsDelivr lists for the file at
+// data.jsdelivr.com/v1/package/npm/chart.js@<version>, base64 decoded);
+// go generate refuses a download that does not match it. To bump the
+// version, update the URL and the recorded hash together.
+//go:generate sh -c "cd static && curl -fsSL -o chart.umd.min.js.new https://cdn.jsdelivr.net/npm/chart.js@4.4.1/dist/chart.umd.min.js && sed 's/ chart.umd.min.js/ chart.umd.min.js.new/' SHA256SUMS | sha256sum -c - && mv chart.umd.min.js.new chart.umd.min.js || { rm -f chart.umd.min.js.new; exit 1; }"
+
+//go:embed static
+var staticFS embed.FS
+
+// vendoredAssets must be present in static/ with the checksum recorded in
+// static/SHA256SUMS; serve refuses to start otherwise
+var vendoredAssets = []string{"chart.umd.min.js"}
+
+// siteAssets serves static/ under /static/
+var siteAssets = assets.Must(staticFS, "static")
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPagesUseLocalAssets guards against CDN links creeping back in: every
+// script and stylesheet must come from the embedded static/ directory.
+func TestPagesUseLocalAssets(t *testing.T) {
+	for name, page := range map[string]string{"template.html": htmlTemplate, "config.html": configHTMLTemplate, "admin.html": adminHTMLTemplate} {
+		for _, bad := range []string{`src="http`, `href="http`, `src="//`, `href="//`, "<style>", "<script>"} {
+			if strings.Contains(page, bad) {
+				t.Errorf("%s contains %q", name, bad)
+			}
+		}
+	}
+	for _, name := range []string{"landing.js", "landing.css", "config.css", "admin.js", "admin.css"} {
+		if !siteAssets.Has(name) {
+			t.Errorf("static/%s not embedded", name)
+		}
+	}
+}
+
+// TestVendoredAssets fails a checkout that would refuse to start: the
+// vendored files must be committed with their recorded checksums
+func TestVendoredAssets(t *testing.T) {
+	if err := siteAssets.Verify(vendoredAssets); err != nil {
+		t.Error(err)
+	}
+}
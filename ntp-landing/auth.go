@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"landing/auth"
+)
+
+// Role is what a caller may do, in increasing order of privilege
+type Role int
+
+const (
+	RoleNone   Role = iota // only the probe endpoints and static files
+	RoleViewer             // the read-only pages and APIs
+	RoleAdmin              // the admin page and chronyc actions
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+func (r Role) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+func parseRole(s string) (Role, error) {
+	switch s {
+	case "none":
+		return RoleNone, nil
+	case "viewer":
+		return RoleViewer, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q (none, viewer or admin)", s)
+}
+
+// Identity is who made a request and what they may do
+type Identity struct {
+	User string `json:"user,omitempty"` // empty when anonymous
+	Role Role   `json:"role"`
+	Via  string `json:"via,omitempty"` // basic, header or tailscale
+}
+
+// authPolicy identifies callers and maps them to roles. Users listed in
+// admins are admins. Other authenticated users are viewers when viewers is
+// empty or lists them; everyone else gets the anonymous role.
+type authPolicy struct {
+	mode      string
+	id        auth.Identifier // nil: everyone is anonymous
+	admins    map[string]bool
+	viewers   map[string]bool
+	anonymous Role
+
+	// denied is called when presented credentials are rejected
+	denied func(r *http.Request, user string, err error)
+}
+
+type identityKey struct{}
+
+// identityFrom returns the identity the auth middleware attached to ctx
+func identityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// newAuthPolicy builds the policy for cfg. The legacy admin password hash
+// still works in every mode: its user is added to the basic credentials
+// and made an admin.
+func newAuthPolicy(cfg Config) (*authPolicy, error) {
+	anon, err := parseRole(cfg.AuthAnonymousRole)
+	if err != nil {
+		return nil, err
+	}
+	p := &authPolicy{mode: cfg.AuthMode, admins: map[string]bool{}, viewers: map[string]bool{}, anonymous: anon}
+	for _, u := range cfg.AuthAdmins {
+		p.admins[u] = true
+	}
+	for _, u := range cfg.AuthViewers {
+		p.viewers[u] = true
+	}
+	legacy, err := newAdminCredentials(cfg.AdminUser, cfg.AdminPasswordSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if legacy != nil {
+		p.admins[cfg.AdminUser] = true
+		slog.Warn("NTP_LANDING_ADMIN_PASSWORD_SHA256 is deprecated: it is an unsalted hash; "+
+			"use NTP_LANDING_AUTH_MODE=basic with a pbkdf2-sha256 entry in NTP_LANDING_AUTH_USERS_FILE and the user in NTP_LANDING_AUTH_ADMINS",
+			"component", "auth", "user", cfg.AdminUser)
+	}
+
+	switch cfg.AuthMode {
+	case "none":
+		if legacy != nil {
+			p.id = legacy
+		}
+	case "basic":
+		creds, err := auth.LoadCredentialsFile(cfg.AuthUsersFile)
+		if err != nil {
+			return nil, err
+		}
+		if legacy != nil {
+			creds.Users[cfg.AdminUser] = legacy.Users[cfg.AdminUser]
+		}
+		p.id = creds
+	case "header":
+		trusted, err := auth.ParsePrefixes(cfg.AuthTrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		p.id = &auth.HeaderIdentity{Header: cfg.AuthUserHeader, Trusted: trusted}
+	case "tailscale":
+		p.id = auth.NewTailscaleWhois(cfg.TailscaleSocket, time.Minute)
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q (none, basic, header or tailscale)", cfg.AuthMode)
+	}
+	return p, nil
+}
+
+// AdminEnabled reports whether anyone can reach the admin role
+func (p *authPolicy) AdminEnabled() bool {
+	return p.id != nil && len(p.admins) > 0
+}
+
+func (p *authPolicy) roleOf(user string) Role {
+	switch {
+	case user == "":
+		return p.anonymous
+	case p.admins[user]:
+		return RoleAdmin
+	case len(p.viewers) == 0 || p.viewers[user]:
+		return RoleViewer
+	}
+	return p.anonymous
+}
+
+// identify returns the identity already attached to the request or works
+// it out
+func (p *authPolicy) identify(r *http.Request) (Identity, error) {
+	if id, ok := identityFrom(r.Context()); ok {
+		return id, nil
+	}
+	if p.id == nil {
+		return Identity{Role: p.anonymous}, nil
+	}
+	user, err := p.id.Identify(r)
+	if err != nil {
+		return Identity{User: user}, err
+	}
+	via := p.mode
+	if via == "none" {
+		via = "basic"
+	}
+	if user == "" {
+		via = ""
+	}
+	return Identity{User: user, Role: p.roleOf(user), Via: via}, nil
+}
+
+// Require answers 401 or 403 unless the caller has at least role need
+func (p *authPolicy) Require(w http.ResponseWriter, r *http.Request, need Role) (Identity, bool) {
+	id, err := p.identify(r)
+	if err != nil {
+		if p.denied != nil {
+			p.denied(r, id.User, err)
+		} else {
+			slog.Warn("authentication failed", "component", "auth", "user", id.User, "remote", remoteHost(r), "error", err)
+		}
+	}
+	if err == nil && id.Role >= need {
+		return id, true
+	}
+	if _, basic := p.id.(*auth.BasicCredentials); basic && (err != nil || id.User == "") {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ntp-landing", charset="UTF-8"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return id, false
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return id, false
+}
+
+// requiredRole is the role needed for a path. Probes and static files are
+// always open so monitoring and the login prompt keep working.
+func requiredRole(path string) Role {
+	switch {
+	case probePaths[path], strings.HasPrefix(path, "/static/"):
+		return RoleNone
+	case path == "/admin", strings.HasPrefix(path, "/api/admin/"):
+		return RoleAdmin
+	}
+	return RoleViewer
+}
+
+// Middleware enforces requiredRole and attaches the identity to the
+// request context
+func (p *authPolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		need := requiredRole(r.URL.Path)
+		if need == RoleNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, ok := p.Require(w, r, need)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// newAdminCredentials is the single admin user from the deprecated
+// NTP_LANDING_ADMIN_PASSWORD_SHA256. An empty hash returns nil.
+func newAdminCredentials(user, hexHash string) (*auth.BasicCredentials, error) {
+	if hexHash == "" {
+		return nil, nil
+	}
+	h, err := auth.ParsePasswordHash(hexHash)
+	if err != nil || h.Iterations != 0 {
+		return nil, errors.New("admin password hash must be a hex SHA-256 digest")
+	}
+	return &auth.BasicCredentials{Users: map[string]auth.PasswordHash{user: h}}, nil
+}
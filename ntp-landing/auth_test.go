@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"landing/auth/authtest"
+)
+
+func TestAuthPolicyBasic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	os.WriteFile(path, []byte("alice:"+authtest.PBKDF2Entry(t, "a")+"\nbob:"+authtest.PBKDF2Entry(t, "b")+"\neve:"+authtest.PBKDF2Entry(t, "e")+"\n"), 0o600)
+	cfg := Config{AuthMode: "basic", AuthUsersFile: path, AuthAdmins: []string{"alice"}, AuthViewers: []string{"alice", "bob"}, AuthAnonymousRole: "none"}
+	p, err := newAuthPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var denied []string
+	p.denied = func(r *http.Request, user string, err error) { denied = append(denied, user) }
+	var seen Identity
+	h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = identityFrom(r.Context())
+	}))
+
+	for _, c := range []struct {
+		path, user, pass string
+		want             int
+		role             Role
+	}{
+		{"/", "", "", 401, 0},
+		{"/healthz", "", "", 200, 0},
+		{"/static/landing.css", "mallory", "x", 200, 0},
+		{"/", "bob", "b", 200, RoleViewer},
+		{"/", "bob", "wrong", 401, 0},
+		{"/", "eve", "e", 403, 0}, // authenticated but not a listed viewer
+		{"/admin", "bob", "b", 403, 0},
+		{"/api/admin/run", "alice", "a", 200, RoleAdmin},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.user != "" {
+			req.SetBasicAuth(c.user, c.pass)
+		}
+		rec := httptest.NewRecorder()
+		seen = Identity{}
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s as %q: code %d, want %d", c.path, c.user, rec.Code, c.want)
+		}
+		if rec.Code == 401 && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s as %q: 401 without a challenge", c.path, c.user)
+		}
+		if c.role != 0 && (seen.Role != c.role || seen.User != c.user || seen.Via != "basic") {
+			t.Errorf("%s as %q: identity %+v", c.path, c.user, seen)
+		}
+	}
+	if len(denied) != 1 || denied[0] != "bob" {
+		t.Errorf("denied = %v", denied)
+	}
+}
+
+func TestAuthPolicyDefaults(t *testing.T) {
+	cfg := Config{AuthMode: "none", AuthAnonymousRole: "viewer", AdminUser: "admin"}
+	p, err := newAuthPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.AdminEnabled() {
+		t.Error("admin enabled without any admin")
+	}
+	rec := httptest.NewRecorder()
+	p.Middleware(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/api/stats", nil))
+	if rec.Code != 404 {
+		t.Errorf("anonymous viewer blocked: %d", rec.Code)
+	}
+
+	sum := sha256.Sum256([]byte("s3cret"))
+	cfg.AdminPasswordSHA256 = hex.EncodeToString(sum[:])
+	if p, err = newAuthPolicy(cfg); err != nil || !p.AdminEnabled() || p.roleOf("admin") != RoleAdmin {
+		t.Errorf("legacy admin hash: %v", err)
+	}
+
+	for _, bad := range []Config{
+		{AuthMode: "kerberos", AuthAnonymousRole: "viewer"},
+		{AuthMode: "none", AuthAnonymousRole: "root"},
+		{AuthMode: "header", AuthAnonymousRole: "viewer", AuthTrustedProxies: []string{"not-an-ip"}},
+		{AuthMode: "basic", AuthAnonymousRole: "viewer", AuthUsersFile: filepath.Join(t.TempDir(), "missing")},
+	} {
+		if _, err := newAuthPolicy(bad); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChronyConfSource is a server, pool or peer line
+type ChronyConfSource struct {
+	Type    string            `json:"type"`
+	Host    string            `json:"host"`
+	NTS     bool              `json:"nts"`
+	IBurst  bool              `json:"iburst"`
+	MinPoll string            `json:"minPoll,omitempty"`
+	MaxPoll string            `json:"maxPoll,omitempty"`
+	Flags   []string          `json:"flags"`
+	Params  map[string]string `json:"params"`
+	File    string            `json:"file"`
+	Line    int               `json:"line"`
+}
+
+// ChronyAccessRule is an allow/deny or cmdallow/cmddeny line
+type ChronyAccessRule struct {
+	Allow  bool   `json:"allow"`
+	Cmd    bool   `json:"cmd"`
+	All    bool   `json:"all"`
+	Subnet string `json:"subnet"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+}
+
+// ChronyDirective is any other directive, kept verbatim
+type ChronyDirective struct {
+	Name string `json:"name"`
+	Args string `json:"args"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// ChronyConfig is the parsed chrony configuration including everything
+// pulled in through include, confdir and sourcedir
+type ChronyConfig struct {
+	Path           string             `json:"path"`
+	Files          []string           `json:"files"`
+	Sources        []ChronyConfSource `json:"sources"`
+	Access         []ChronyAccessRule `json:"access"`
+	MakeStep       string             `json:"makeStep"`
+	RTCSync        bool               `json:"rtcSync"`
+	RTCFile        string             `json:"rtcFile"`
+	NTSServerKeys  []string           `json:"ntsServerKeys"`
+	NTSServerCerts []string           `json:"ntsServerCerts"`
+	NTSDumpDir     string             `json:"ntsDumpDir"`
+	LeapSecTZ      string             `json:"leapSecTZ"`
+	Log            []string           `json:"log"`
+	LogDir         string             `json:"logDir"`
+	DriftFile      string             `json:"driftFile"`
+	Other          []ChronyDirective  `json:"other"`
+	Errors         []string           `json:"errors"`
+}
+
+// chronyConfCandidates are tried in order when no path is configured:
+// Debian-style first, then the RHEL/AlmaLinux location.
+var chronyConfCandidates = []string{"/etc/chrony/chrony.conf", "/etc/chrony.conf"}
+
+// findChronyConf returns the configured path, or the first candidate that
+// exists.
+func findChronyConf(path string) string {
+	if path != "" {
+		return path
+	}
+	for _, p := range chronyConfCandidates {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return chronyConfCandidates[0]
+}
+
+// parseChronyConfig reads path and every file it includes
+func parseChronyConfig(path string) ChronyConfig {
+	cfg := ChronyConfig{Path: path}
+	seen := make(map[string]bool)
+	cfg.parseFile(path, seen, 0)
+	return cfg
+}
+
+func (c *ChronyConfig) parseFile(path string, seen map[string]bool, depth int) {
+	if seen[path] {
+		return
+	}
+	if depth > 10 {
+		c.Errors = append(c.Errors, fmt.Sprintf("%s: include nesting too deep", path))
+		return
+	}
+	seen[path] = true
+
+	f, err := os.Open(path)
+	if err != nil {
+		c.Errors = append(c.Errors, err.Error())
+		return
+	}
+	defer f.Close()
+	c.Files = append(c.Files, path)
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		// chrony treats lines starting with any of these as comments
+		if line == "" || strings.ContainsAny(line[:1], "#;%!") {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := strings.ToLower(fields[0])
+		args := fields[1:]
+
+		switch name {
+		case "server", "pool", "peer":
+			if len(args) == 0 {
+				c.Errors = append(c.Errors, fmt.Sprintf("%s:%d: %s without address", path, lineNo, name))
+				continue
+			}
+			c.Sources = append(c.Sources, parseChronySourceLine(name, args, path, lineNo))
+		case "allow", "deny", "cmdallow", "cmddeny":
+			rule := ChronyAccessRule{
+				Allow: strings.HasSuffix(name, "allow"),
+				Cmd:   strings.HasPrefix(name, "cmd"),
+				File:  path,
+				Line:  lineNo,
+			}
+			for _, a := range args {
+				if a == "all" {
+					rule.All = true
+				} else {
+					rule.Subnet = a
+				}
+			}
+			c.Access = append(c.Access, rule)
+		case "makestep":
+			c.MakeStep = strings.Join(args, " ")
+		case "rtcsync":
+			c.RTCSync = true
+		case "rtcfile":
+			c.RTCFile = strings.Join(args, " ")
+		case "ntsserverkey":
+			c.NTSServerKeys = append(c.NTSServerKeys, args...)
+		case "ntsservercert":
+			c.NTSServerCerts = append(c.NTSServerCerts, args...)
+		case "ntsdumpdir":
+			c.NTSDumpDir = strings.Join(args, " ")
+		case "leapsectz":
+			c.LeapSecTZ = strings.Join(args, " ")
+		case "log":
+			c.Log = append(c.Log, args...)
+		case "logdir":
+			c.LogDir = strings.Join(args, " ")
+		case "driftfile":
+			c.DriftFile = strings.Join(args, " ")
+		case "include":
+			for _, pattern := range args {
+				matches, _ := filepath.Glob(pattern)
+				sort.Strings(matches)
+				for _, m := range matches {
+					c.parseFile(m, seen, depth+1)
+				}
+			}
+		case "confdir", "sourcedir":
+			ext := ".conf"
+			if name == "sourcedir" {
+				ext = ".sources"
+			}
+			c.parseDirs(args, ext, seen, depth)
+		default:
+			c.Other = append(c.Other, ChronyDirective{Name: name, Args: strings.Join(args, " "), File: path, Line: lineNo})
+		}
+	}
+}
+
+// parseDirs handles confdir/sourcedir: files with the extension from all
+// listed directories, where a file name in an earlier directory shadows the
+// same name in later ones, read in name order.
+func (c *ChronyConfig) parseDirs(dirs []string, ext string, seen map[string]bool, depth int) {
+	byName := make(map[string]string)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+				continue
+			}
+			if _, ok := byName[e.Name()]; !ok {
+				byName[e.Name()] = filepath.Join(dir, e.Name())
+			}
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for n := range byName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		c.parseFile(byName[n], seen, depth+1)
+	}
+}
+
+// chronySourceValueOptions take a value; everything else is a flag
+var chronySourceValueOptions = map[string]bool{
+	"minpoll": true, "maxpoll": true, "key": true, "maxsources": true,
+	"port": true, "ntsport": true, "certset": true, "minstratum": true,
+	"polltarget": true, "version": true, "maxdelay": true, "maxdelayratio": true,
+	"maxdelaydevratio": true, "maxdelayquant": true, "mindelay": true,
+	"asymmetry": true, "offset": true, "minsamples": true, "maxsamples": true,
+	"filter": true, "presend": true, "extfield": true,
+}
+
+func parseChronySourceLine(typ string, args []string, file string, line int) ChronyConfSource {
+	src := ChronyConfSource{Type: typ, Host: args[0], Params: make(map[string]string), File: file, Line: line}
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToLower(args[i])
+		if chronySourceValueOptions[opt] && i+1 < len(args) {
+			src.Params[opt] = args[i+1]
+			i++
+			continue
+		}
+		src.Flags = append(src.Flags, opt)
+		switch opt {
+		case "nts":
+			src.NTS = true
+		case "iburst":
+			src.IBurst = true
+		}
+	}
+	src.MinPoll = src.Params["minpoll"]
+	src.MaxPoll = src.Params["maxpoll"]
+	return src
+}
+
+// sourceSightings remembers every configured name chronyc has reported
+// since start, so the drift check can tell "never appeared" from "missing
+// now".
+type sourceSightings struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newSourceSightings() *sourceSightings {
+	return &sourceSightings{seen: make(map[string]bool)}
+}
+
+// Observe records the names in a snapshot. It is a collector observer.
+func (s *sourceSightings) Observe(stats NTPStats, _ time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, src := range stats.Sources {
+		if src.ConfiguredName != "" {
+			s.seen[src.ConfiguredName] = true
+		}
+	}
+}
+
+func (s *sourceSightings) Seen() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]bool, len(s.seen))
+	for k := range s.seen {
+		out[k] = true
+	}
+	return out
+}
+
+// ConfigDrift lists disagreements between chrony.conf and what chronyd is
+// actually using
+type ConfigDrift struct {
+	Warnings []string `json:"warnings"`
+}
+
+// sourceNameMatches compares the configured name chronyc -N reports for a
+// source with a host in chrony.conf. chronyc cuts long names to fit its
+// column, so a long live name that is a prefix of the host also counts.
+func sourceNameMatches(live, host string) bool {
+	live, host = strings.ToLower(live), strings.ToLower(host)
+	return live == host || (len(live) >= 20 && strings.HasPrefix(host, live))
+}
+
+// checkConfigDrift compares the configured sources and pools with the live
+// ones, by the configured names chronyc -N reports, and with every name
+// seen since start. Without configured names the live sources cannot be
+// told apart from reverse DNS, so the check says so instead of guessing.
+func checkConfigDrift(conf ChronyConfig, live []NTPSource, seen map[string]bool) ConfigDrift {
+	var drift ConfigDrift
+	for _, l := range live {
+		if l.ConfiguredName == "" {
+			drift.Warnings = append(drift.Warnings, "chronyc -N sources gave no configured names; live sources cannot be matched to the configuration")
+			return drift
+		}
+	}
+
+	matchedLive := make(map[string]bool)
+	for _, src := range conf.Sources {
+		found := false
+		for _, l := range live {
+			if !sourceNameMatches(l.ConfiguredName, src.Host) {
+				continue
+			}
+			matchedLive[l.Name] = true
+			found = true
+			if src.NTS && !l.NTS {
+				drift.Warnings = append(drift.Warnings, fmt.Sprintf("%s is configured with nts but is not NTS-authenticated (%s:%d)", src.Host, src.File, src.Line))
+			}
+		}
+		if found {
+			continue
+		}
+		everSeen := false
+		for name := range seen {
+			if sourceNameMatches(name, src.Host) {
+				everSeen = true
+				break
+			}
+		}
+		switch {
+		case src.Type == "pool":
+			drift.Warnings = append(drift.Warnings, fmt.Sprintf("pool %s has no live members (%s:%d)", src.Host, src.File, src.Line))
+		case everSeen:
+			drift.Warnings = append(drift.Warnings, fmt.Sprintf("configured %s %s is no longer in chronyc sources (%s:%d)", src.Type, src.Host, src.File, src.Line))
+		default:
+			drift.Warnings = append(drift.Warnings, fmt.Sprintf("configured %s %s has never appeared in chronyc sources (%s:%d)", src.Type, src.Host, src.File, src.Line))
+		}
+	}
+
+	for _, l := range live {
+		if !matchedLive[l.Name] {
+			drift.Warnings = append(drift.Warnings, fmt.Sprintf("live source %s (%s) is not in the configuration", l.Name, l.ConfiguredName))
+		}
+	}
+	return drift
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChronyConfig(t *testing.T) {
+	conf := parseChronyConfig("testdata/chronyconf/chrony.conf")
+	if len(conf.Errors) > 0 {
+		t.Fatalf("errors: %v", conf.Errors)
+	}
+	if len(conf.Files) != 4 {
+		t.Errorf("files = %v, want main, include, confdir and sourcedir file", conf.Files)
+	}
+
+	if len(conf.Sources) != 4 {
+		t.Fatalf("sources = %d, want 4", len(conf.Sources))
+	}
+	cf := conf.Sources[0]
+	if cf.Host != "time.cloudflare.com" || !cf.NTS || !cf.IBurst || cf.MinPoll != "4" || cf.MaxPoll != "8" || cf.Line != 2 {
+		t.Errorf("first source = %+v", cf)
+	}
+	pool := conf.Sources[2]
+	if pool.Type != "pool" || pool.Params["maxsources"] != "2" {
+		t.Errorf("pool = %+v", pool)
+	}
+	if last := conf.Sources[3]; last.Host != "192.168.1.1" || !strings.HasSuffix(last.File, "dhcp.sources") {
+		t.Errorf("sourcedir source = %+v", last)
+	}
+
+	if len(conf.Access) != 3 {
+		t.Fatalf("access = %+v", conf.Access)
+	}
+	if a := conf.Access[1]; a.Allow || a.Cmd || a.Subnet != "192.168.1.13" {
+		t.Errorf("deny rule = %+v", a)
+	}
+	if a := conf.Access[2]; !a.Allow || !a.Cmd {
+		t.Errorf("cmdallow rule = %+v", a)
+	}
+
+	if conf.MakeStep != "1.0 3" || !conf.RTCSync || conf.LeapSecTZ != "right/UTC" || conf.DriftFile != "/var/lib/chrony/drift" {
+		t.Errorf("general directives = %+v", conf)
+	}
+	if len(conf.Log) != 3 || conf.LogDir != "/var/log/chrony" {
+		t.Errorf("log = %v in %q", conf.Log, conf.LogDir)
+	}
+	if len(conf.NTSServerKeys) != 1 || len(conf.NTSServerCerts) != 1 || conf.NTSDumpDir != "/var/lib/chrony" {
+		t.Errorf("nts server = %v %v %q", conf.NTSServerKeys, conf.NTSServerCerts, conf.NTSDumpDir)
+	}
+	if len(conf.Other) != 1 || conf.Other[0].Name != "hwtimestamp" {
+		t.Errorf("other = %+v", conf.Other)
+	}
+}
+
+func TestParseChronyConfigMissing(t *testing.T) {
+	conf := parseChronyConfig("testdata/chronyconf/does-not-exist.conf")
+	if len(conf.Errors) != 1 || len(conf.Files) != 0 {
+		t.Errorf("errors = %v, files = %v", conf.Errors, conf.Files)
+	}
+}
+
+func TestCheckConfigDrift(t *testing.T) {
+	conf := parseChronyConfig("testdata/chronyconf/chrony.conf")
+	// chronyc shows reverse DNS names; -N gives the configured ones
+	live := []NTPSource{
+		{Name: "time.cloudflare.com", ConfiguredName: "time.cloudflare.com", NTS: true},
+		{Name: "gbg1.nts.netnod.se", ConfiguredName: "nts.netnod.se", NTS: false},
+		{Name: "ec2-1-2-3-4.compute.amazonaws.com", ConfiguredName: "2.pool.ntp.org"},
+		{Name: "static.5.6.7.8.clients.example", ConfiguredName: "2.pool.ntp.org"},
+	}
+	seen := map[string]bool{"192.168.1.1": true}
+	for _, l := range live {
+		seen[l.ConfiguredName] = true
+	}
+
+	drift := checkConfigDrift(conf, live, seen)
+	want := []string{
+		"nts.netnod.se is configured with nts but is not NTS-authenticated",
+		"configured server 192.168.1.1 is no longer in chronyc sources",
+	}
+	if len(drift.Warnings) != len(want) {
+		t.Fatalf("warnings = %q", drift.Warnings)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(drift.Warnings[i], w) {
+			t.Errorf("warning %d = %q, want prefix %q", i, drift.Warnings[i], w)
+		}
+	}
+
+	// a source added at runtime is not in the configuration, and a source
+	// that was never seen is reported as such
+	live = append(live, NTPSource{Name: "rogue.example", ConfiguredName: "10.9.9.9"})
+	drift = checkConfigDrift(conf, live, map[string]bool{})
+	joined := strings.Join(drift.Warnings, "\n")
+	for _, w := range []string{"192.168.1.1 has never appeared", "live source rogue.example (10.9.9.9) is not in the configuration"} {
+		if !strings.Contains(joined, w) {
+			t.Errorf("missing warning %q in:\n%s", w, joined)
+		}
+	}
+}
+
+func TestCheckConfigDriftWithoutConfiguredNames(t *testing.T) {
+	conf := parseChronyConfig("testdata/chronyconf/chrony.conf")
+	drift := checkConfigDrift(conf, []NTPSource{{Name: "gbg1.nts.netnod.se"}}, nil)
+	if len(drift.Warnings) != 1 || !strings.Contains(drift.Warnings[0], "cannot be matched") {
+		t.Errorf("warnings = %q", drift.Warnings)
+	}
+}
+
+func TestCheckConfigDriftEmptyPool(t *testing.T) {
+	conf := ChronyConfig{Sources: []ChronyConfSource{{Type: "pool", Host: "pool.ntp.org", File: "chrony.conf", Line: 1}}}
+	drift := checkConfigDrift(conf, nil, nil)
+	if len(drift.Warnings) != 1 || !strings.HasPrefix(drift.Warnings[0], "pool pool.ntp.org has no live members") {
+		t.Errorf("warnings = %q", drift.Warnings)
+	}
+}
+
+func TestConfiguredSourceNamesLineUp(t *testing.T) {
+	state, fields, ok := parseSourceLine("^* ntp1.example.net             2   6   377    34   +12us[  +15us] +/-   10ms")
+	if !ok || state != "*" || fields[0] != "ntp1.example.net" || fields[1] != "2" || fields[2] != "6" {
+		t.Errorf("parseSourceLine = %q %q %v", state, fields, ok)
+	}
+	for _, line := range []string{"MS Name/IP address", "===========", "210 Number of sources = 3", ""} {
+		if _, _, ok := parseSourceLine(line); ok {
+			t.Errorf("header %q parsed as a source", line)
+		}
+	}
+}
+
+func TestSourceNameMatches(t *testing.T) {
+	if !sourceNameMatches("Time.Cloudflare.com", "time.cloudflare.com") {
+		t.Error("case-insensitive match failed")
+	}
+	if !sourceNameMatches("ntp1.very-long-domain-n", "ntp1.very-long-domain-name.example") {
+		t.Error("truncated long name should match")
+	}
+	if sourceNameMatches("ntp1", "ntp1.example") {
+		t.Error("short prefix must not match")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceSeries is the history of one source taken from chrony's logs
+type SourceSeries struct {
+	Offset   []ChartPoint `json:"offset"`
+	StdDev   []ChartPoint `json:"stdDev"`
+	Measured []ChartPoint `json:"measured"`
+}
+
+// trackingRecord is one line of tracking.log
+type trackingRecord struct {
+	Time      time.Time
+	Stratum   int
+	FreqPPM   float64
+	SkewPPM   float64
+	Offset    float64
+	Leap      string
+	Combined  int
+	OffsetSD  float64
+	RootDelay float64
+	RootDisp  float64
+	MaxError  float64
+}
+
+// statisticsRecord is one line of statistics.log
+type statisticsRecord struct {
+	Time      time.Time
+	Source    string
+	StdDev    float64
+	EstOffset float64
+	OffsetSD  float64
+	DiffFreq  float64
+	EstSkew   float64
+}
+
+// measurementRecord is one line of measurements.log
+type measurementRecord struct {
+	Time   time.Time
+	Source string
+	Leap   string
+	Offset float64
+	Delay  float64
+}
+
+// chronyLogReader reads the logs chronyd writes with
+// "log tracking measurements statistics".
+type chronyLogReader struct {
+	dir string
+}
+
+const chronyLogTimeFmt = "2006-01-02 15:04:05"
+
+// lines calls fn with the fields of every data line of the named log that
+// is at or after since, oldest first. The previous rotation (name.1) is
+// read before the live file so ranges spanning a rotation stay complete.
+func (r chronyLogReader) lines(name string, since time.Time, fn func(t time.Time, fields []string)) {
+	// Log lines start with a UTC timestamp, so plain string comparison
+	// against the formatted cutoff skips old lines without parsing them.
+	cutoff := since.UTC().Format(chronyLogTimeFmt)
+	for _, path := range []string{filepath.Join(r.dir, name+".1"), filepath.Join(r.dir, name)} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			// Skip the banner and separator lines chronyd repeats
+			if len(line) < len(chronyLogTimeFmt) || line[0] < '0' || line[0] > '9' {
+				continue
+			}
+			if line[:len(chronyLogTimeFmt)] < cutoff {
+				continue
+			}
+			t, err := time.Parse(chronyLogTimeFmt, line[:len(chronyLogTimeFmt)])
+			if err != nil {
+				continue
+			}
+			fn(t, strings.Fields(line[len(chronyLogTimeFmt):]))
+		}
+		f.Close()
+	}
+}
+
+// tracking reads tracking.log:
+// IP St Freq Skew Offset L Co OffsetSD RemCorr RootDelay RootDisp MaxError
+func (r chronyLogReader) tracking(since time.Time) []trackingRecord {
+	var recs []trackingRecord
+	r.lines("tracking.log", since, func(t time.Time, f []string) {
+		if len(f) < 12 {
+			return
+		}
+		rec := trackingRecord{Time: t, Leap: f[5]}
+		rec.Stratum, _ = strconv.Atoi(f[1])
+		rec.Combined, _ = strconv.Atoi(f[6])
+		var err error
+		if rec.FreqPPM, err = strconv.ParseFloat(f[2], 64); err != nil {
+			return
+		}
+		if rec.Offset, err = strconv.ParseFloat(f[4], 64); err != nil {
+			return
+		}
+		rec.SkewPPM, _ = strconv.ParseFloat(f[3], 64)
+		rec.OffsetSD, _ = strconv.ParseFloat(f[7], 64)
+		rec.RootDelay, _ = strconv.ParseFloat(f[9], 64)
+		rec.RootDisp, _ = strconv.ParseFloat(f[10], 64)
+		rec.MaxError, _ = strconv.ParseFloat(f[11], 64)
+		recs = append(recs, rec)
+	})
+	return recs
+}
+
+// statistics reads statistics.log:
+// IP StdDev EstOffset OffsetSD DiffFreq EstSkew Stress Ns Bs Nr [Asym]
+func (r chronyLogReader) statistics(since time.Time) []statisticsRecord {
+	var recs []statisticsRecord
+	r.lines("statistics.log", since, func(t time.Time, f []string) {
+		if len(f) < 6 {
+			return
+		}
+		rec := statisticsRecord{Time: t, Source: f[0]}
+		var err error
+		if rec.StdDev, err = strconv.ParseFloat(f[1], 64); err != nil {
+			return
+		}
+		if rec.EstOffset, err = strconv.ParseFloat(f[2], 64); err != nil {
+			return
+		}
+		rec.OffsetSD, _ = strconv.ParseFloat(f[3], 64)
+		rec.DiffFreq, _ = strconv.ParseFloat(f[4], 64)
+		rec.EstSkew, _ = strconv.ParseFloat(f[5], 64)
+		recs = append(recs, rec)
+	})
+	return recs
+}
+
+// measurements reads measurements.log:
+// IP L St 123 567 ABCD LP RP Score Offset PeerDel PeerDisp RootDel RootDisp Refid ...
+func (r chronyLogReader) measurements(since time.Time) []measurementRecord {
+	var recs []measurementRecord
+	r.lines("measurements.log", since, func(t time.Time, f []string) {
+		if len(f) < 11 {
+			return
+		}
+		rec := measurementRecord{Time: t, Source: f[0], Leap: f[1]}
+		var err error
+		if rec.Offset, err = strconv.ParseFloat(f[9], 64); err != nil {
+			return
+		}
+		rec.Delay, _ = strconv.ParseFloat(f[10], 64)
+		recs = append(recs, rec)
+	})
+	return recs
+}
+
+// timedValue is a raw sample before it is bucketed onto the chart step
+type timedValue struct {
+	t time.Time
+	v float64
+}
+
+// chartSeries are the raw samples behind the ChartDataSet series, keyed
+// by their JSON field names
+type chartSeries map[string][]timedValue
+
+func (s chartSeries) add(name string, t time.Time, v float64) {
+	s[name] = append(s[name], timedValue{t, v})
+}
+
+// bucket turns the samples into chart points for a range
+func (s chartSeries) bucket(cr chartRange) ChartDataSet {
+	return ChartDataSet{
+		Offset: bucketSeries(s["offset"], cr.Step, cr.TimeFmt),
+		Freq:   bucketSeries(s["freq"], cr.Step, cr.TimeFmt),
+		MaxErr: bucketSeries(s["maxErr"], cr.Step, cr.TimeFmt),
+		EstErr: bucketSeries(s["estErr"], cr.Step, cr.TimeFmt),
+		PLL:    bucketSeries(s["pll"], cr.Step, cr.TimeFmt),
+		Skew:   bucketSeries(s["skew"], cr.Step, cr.TimeFmt),
+	}
+}
+
+// bucketSeries averages samples into step-sized buckets so log-backed
+// charts have the same density as the Prometheus query_range ones.
+func bucketSeries(samples []timedValue, step time.Duration, timeFmt string) []ChartPoint {
+	if len(samples) == 0 {
+		return nil
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].t.Before(samples[j].t) })
+	var points []ChartPoint
+	var bucket time.Time
+	var sum float64
+	var n int
+	flush := func() {
+		if n > 0 {
+			points = append(points, ChartPoint{Time: bucket.Local().Format(timeFmt), Value: sum / float64(n)})
+		}
+	}
+	for _, s := range samples {
+		b := s.t.Truncate(step)
+		if !b.Equal(bucket) {
+			flush()
+			bucket, sum, n = b, 0, 0
+		}
+		sum += s.v
+		n++
+	}
+	flush()
+	return points
+}
+
+// trackingSamples returns tracking.log since a time as chart series.
+// Offsets and errors are in microseconds to match the Prometheus queries.
+// The kernel PLL time constant is not logged by chrony, so there is no pll
+// series.
+func (r chronyLogReader) trackingSamples(since time.Time) chartSeries {
+	series := chartSeries{}
+	for _, rec := range r.tracking(since) {
+		series.add("offset", rec.Time, rec.Offset*1e6)
+		series.add("freq", rec.Time, rec.FreqPPM)
+		series.add("skew", rec.Time, rec.SkewPPM)
+		series.add("maxErr", rec.Time, rec.MaxError*1e6)
+		series.add("estErr", rec.Time, rec.OffsetSD*1e6)
+	}
+	return series
+}
+
+// chartSet builds the chart data for a range from the logs
+func (r chronyLogReader) chartSet(cr chartRange, now time.Time) ChartDataSet {
+	since := now.Add(-cr.Duration)
+	ds := r.trackingSamples(since).bucket(cr)
+
+	srcOffset := make(map[string][]timedValue)
+	srcStdDev := make(map[string][]timedValue)
+	srcMeasured := make(map[string][]timedValue)
+	for _, rec := range r.statistics(since) {
+		srcOffset[rec.Source] = append(srcOffset[rec.Source], timedValue{rec.Time, rec.EstOffset * 1e6})
+		srcStdDev[rec.Source] = append(srcStdDev[rec.Source], timedValue{rec.Time, rec.StdDev * 1e6})
+	}
+	for _, rec := range r.measurements(since) {
+		srcMeasured[rec.Source] = append(srcMeasured[rec.Source], timedValue{rec.Time, rec.Offset * 1e6})
+	}
+	if len(srcOffset) > 0 || len(srcMeasured) > 0 {
+		ds.Sources = make(map[string]SourceSeries)
+		for name := range srcOffset {
+			ds.Sources[name] = SourceSeries{}
+		}
+		for name := range srcMeasured {
+			ds.Sources[name] = SourceSeries{}
+		}
+		for name := range ds.Sources {
+			ds.Sources[name] = SourceSeries{
+				Offset:   bucketSeries(srcOffset[name], cr.Step, cr.TimeFmt),
+				StdDev:   bucketSeries(srcStdDev[name], cr.Step, cr.TimeFmt),
+				Measured: bucketSeries(srcMeasured[name], cr.Step, cr.TimeFmt),
+			}
+		}
+	}
+	return ds
+}
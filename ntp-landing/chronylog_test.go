@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChronyLogTracking(t *testing.T) {
+	r := chronyLogReader{dir: "testdata/chrony"}
+	recs := r.tracking(time.Date(2026, 1, 1, 0, 0, 20, 0, time.UTC))
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records after cutoff, got %d", len(recs))
+	}
+	if recs[0].Offset != 3e-6 || recs[0].FreqPPM != -3.214 || recs[0].MaxError != 1.2e-2 || recs[0].Leap != "N" {
+		t.Errorf("unexpected tracking record: %+v", recs[0])
+	}
+}
+
+func TestChronyLogChartSet(t *testing.T) {
+	r := chronyLogReader{dir: "testdata/chrony"}
+	now := time.Date(2026, 1, 1, 0, 30, 0, 0, time.UTC)
+	ds := r.chartSet(chartRange{Duration: time.Hour, Step: time.Minute, TimeFmt: "15:04"}, now)
+
+	// 00:00:16 and 00:00:32 share the first minute bucket
+	if len(ds.Offset) != 2 {
+		t.Fatalf("expected 2 offset buckets, got %d", len(ds.Offset))
+	}
+	if got := ds.Offset[0].Value; got < 0.999 || got > 1.001 {
+		t.Errorf("expected averaged offset of 1us, got %v", got)
+	}
+	if len(ds.Freq) != 2 || len(ds.Skew) != 2 || len(ds.MaxErr) != 2 || len(ds.EstErr) != 2 {
+		t.Errorf("expected all tracking series populated: %+v", ds)
+	}
+	if len(ds.PLL) != 0 {
+		t.Errorf("PLL is not in chrony logs and should be empty")
+	}
+
+	cf, ok := ds.Sources["162.159.200.1"]
+	if !ok {
+		t.Fatalf("missing per-source series, have %v", ds.Sources)
+	}
+	if len(cf.Offset) != 1 || cf.Offset[0].Value != -2 || len(cf.StdDev) != 1 || len(cf.Measured) != 1 {
+		t.Errorf("unexpected source series: %+v", cf)
+	}
+	if _, ok := ds.Sources["194.58.202.20"]; !ok {
+		t.Errorf("missing second source")
+	}
+}
+
+func TestChronyLogMissingDir(t *testing.T) {
+	r := chronyLogReader{dir: "testdata/does-not-exist"}
+	ds := r.chartSet(chartRangeFor("24h"), time.Now())
+	if len(ds.Offset) != 0 || ds.Sources != nil {
+		t.Errorf("expected empty chart set, got %+v", ds)
+	}
+}
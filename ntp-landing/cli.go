@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const cliUsage = `usage: ntp-landing [command] [flags]
+
+commands:
+  serve     run the landing page (the default)
+  status    print the dashboard for this host; -json for the /api/v1/stats body
+  check     evaluate NTP_LANDING_STATUS_CHECKS once; exits 0 when they pass,
+            2 when they fail and 3 when chronyc cannot be read, like a
+            Nagios plugin
+  collect   save raw chronyc, /proc and /sys output under -fixture-dir for tests
+
+Run "ntp-landing <command> -h" for the flags of a command.
+`
+
+// Nagios plugin exit codes used by check
+const (
+	exitOK       = 0
+	exitCritical = 2
+	exitUnknown  = 3
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		serve()
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := runCommand(ctx, os.Args[1], os.Args[2:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// runCommand runs one of the one-shot subcommands and returns the exit
+// code. They call chronyc and read /proc through the same collectors as
+// the server, once, without starting any of its background loops.
+func runCommand(ctx context.Context, name string, args []string, stdout, stderr io.Writer) int {
+	switch name {
+	case "status":
+		return runStatus(ctx, args, stdout, stderr)
+	case "check":
+		return runCheck(ctx, args, stdout, stderr)
+	case "collect":
+		return runCollect(ctx, args, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return 0
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n%s", name, cliUsage)
+	return 2
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("ntp-landing "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags maps -h to exit 0 and other flag errors to 2, after the
+// flag package has printed the usage
+func parseFlags(fs *flag.FlagSet, args []string) (exit int, ok bool) {
+	err := fs.Parse(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0, false
+	case err != nil:
+		return 2, false
+	case fs.NArg() > 0:
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2, false
+	}
+	return 0, true
+}
+
+func runStatus(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("status", stderr)
+	asJSON := fs.Bool("json", false, "print the /api/v1/stats JSON instead of the dashboard")
+	color := fs.String("color", "auto", "colour the dashboard: auto, always or never")
+	timeout := fs.Duration("timeout", 10*time.Second, "limit for the chronyc calls")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	var ansi bool
+	switch *color {
+	case "auto":
+		ansi = isTerminal(stdout)
+	case "always":
+		ansi = true
+	case "never":
+	default:
+		fmt.Fprintf(stderr, "-color must be auto, always or never\n")
+		return 2
+	}
+
+	cfg := loadConfig()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	stats := StatsResponse{
+		NTP:      getNTPStats(ctx),
+		System:   getSystemStats(ctx),
+		Hardware: getClockHardware(ctx),
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	writeTextDashboard(stdout, PageData{
+		NTP:       stats.NTP,
+		System:    stats.System,
+		Hardware:  stats.Hardware,
+		UpdatedAt: time.Now().Format("2006-01-02 15:04:05 MST"),
+	}, cfg.StatusMaxOffset, ansi)
+	return 0
+}
+
+func runCheck(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check", stderr)
+	asJSON := fs.Bool("json", false, "print the /status/ntp JSON report instead of a plugin line")
+	timeout := fs.Duration("timeout", 10*time.Second, "limit for the chronyc calls")
+	if code, ok := parseFlags(fs, args); !ok {
+		if code != 0 {
+			code = exitUnknown
+		}
+		return code
+	}
+
+	cfg := loadConfig()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	stats := getNTPStats(ctx)
+	now := time.Now()
+	if stats.Err != nil {
+		// chronyd did not answer, so nothing is known about the clock
+		report := newHealthReport([]HealthCheck{{Name: "collector", Detail: stats.Err.Error()}}, now)
+		if *asJSON {
+			json.NewEncoder(stdout).Encode(report)
+		} else {
+			fmt.Fprintln(stdout, "NTP UNKNOWN - "+stats.Err.Error())
+		}
+		return exitUnknown
+	}
+	report := ntpStatus(cfg, stats, now, now)
+
+	if *asJSON {
+		json.NewEncoder(stdout).Encode(report)
+	} else {
+		fmt.Fprintln(stdout, checkLine(report))
+	}
+	if report.Status != "ok" {
+		return exitCritical
+	}
+	return exitOK
+}
+
+// checkLine is the one-line summary a Nagios-style check prints, failed
+// checks first. The collector check is left out: the snapshot was taken
+// just now.
+func checkLine(report HealthReport) string {
+	var failed, passed []string
+	for _, c := range report.Checks {
+		switch {
+		case c.Name == "collector":
+		case c.OK:
+			passed = append(passed, c.Detail)
+		default:
+			failed = append(failed, c.Name+": "+c.Detail)
+		}
+	}
+	if len(failed) > 0 {
+		return "NTP CRITICAL - " + strings.Join(append(failed, passed...), ", ")
+	}
+	return "NTP OK - " + strings.Join(passed, ", ")
+}
+
+// fixtureChronycCommands and fixtureFiles are what collect captures: every
+// chronyc command the page's collectors run, saved as chronyc/<file>, and
+// every /proc and /sys file they read, as globs relative to /
+var (
+	fixtureChronycCommands = []struct {
+		file string
+		args []string
+	}{
+		{"tracking", []string{"tracking"}},
+		{"sources", []string{"sources"}},
+		{"sources-N", []string{"-N", "sources"}},
+		{"sourcestats", []string{"sourcestats"}},
+		{"activity", []string{"activity"}},
+		{"authdata", []string{"authdata"}},
+		{"rtcdata", []string{"rtcdata"}},
+	}
+	fixtureFiles = []string{
+		"proc/uptime", "proc/stat", "proc/meminfo", "proc/loadavg", "proc/cpuinfo", "proc/cmdline",
+		"sys/devices/system/clocksource/clocksource0/current_clocksource",
+		"sys/devices/system/clocksource/clocksource0/available_clocksource",
+		"sys/class/rtc/rtc*/name", "sys/class/rtc/rtc*/hctosys", "sys/class/rtc/rtc*/since_epoch",
+	}
+)
+
+// runCollect writes chronyc/<file>, proc/<file> and sys/<path> below the
+// fixture directory, the proc and sys halves in the layout
+// readClockHardware reads from testdata/hw. Commands chronyd refuses or
+// files the kernel lacks are reported and skipped; only failing to write is
+// an error.
+func runCollect(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("collect", stderr)
+	dir := fs.String("fixture-dir", "", "directory to write the captured output to")
+	timeout := fs.Duration("timeout", 10*time.Second, "limit for each chronyc call")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *dir == "" {
+		fmt.Fprintln(stderr, "collect needs -fixture-dir")
+		return 2
+	}
+
+	save := func(rel string, data []byte) error {
+		path := filepath.Join(*dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, path)
+		return nil
+	}
+	for _, cmd := range fixtureChronycCommands {
+		cctx, cancel := context.WithTimeout(ctx, *timeout)
+		out, err := chronycOutput(cctx, cmd.args...)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(stderr, "skipped chronyc %s: %v\n", strings.Join(cmd.args, " "), err)
+			continue
+		}
+		if err := save(filepath.Join("chronyc", cmd.file), out); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	for _, pattern := range fixtureFiles {
+		paths, _ := filepath.Glob("/" + pattern)
+		if len(paths) == 0 {
+			fmt.Fprintf(stderr, "skipped /%s: not present\n", pattern)
+			continue
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Fprintf(stderr, "skipped %s: %v\n", path, err)
+				continue
+			}
+			if err := save(strings.TrimPrefix(path, "/"), data); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// isTerminal reports whether w is a character device such as a tty
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckLine(t *testing.T) {
+	report := newHealthReport([]HealthCheck{
+		{Name: "collector", OK: true, Detail: "last snapshot 0s ago (max 1m30s)"},
+		{Name: "leap", OK: true, Detail: "leap status Normal"},
+		{Name: "offset", OK: false, Detail: "offset +250.00 ms (max +100.00 ms)"},
+		{Name: "sources", OK: true, Detail: "4 reachable sources (min 2)"},
+	}, time.Unix(1700000000, 0))
+	want := "NTP CRITICAL - offset: offset +250.00 ms (max +100.00 ms), leap status Normal, 4 reachable sources (min 2)"
+	if got := checkLine(report); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	report.Checks[2].OK = true
+	if got := checkLine(report); !strings.HasPrefix(got, "NTP OK - leap status Normal, offset") {
+		t.Errorf("passing report: %q", got)
+	}
+}
+
+func TestRunCommandUsage(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"help"}, 0},
+		{[]string{"frobnicate"}, 2},
+		{[]string{"status", "-h"}, 0},
+		{[]string{"status", "-color", "sometimes"}, 2},
+		{[]string{"status", "extra"}, 2},
+		{[]string{"check", "-bogus"}, exitUnknown},
+		{[]string{"collect"}, 2},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runCommand(context.Background(), tc.args[0], tc.args[1:], &stdout, &stderr); code != tc.code {
+			t.Errorf("%v: exit %d, want %d (stderr %q)", tc.args, code, tc.code, stderr.String())
+		}
+	}
+}
+
+func TestRunCheckUnknownWithoutChronyd(t *testing.T) {
+	t.Setenv("PATH", t.TempDir()) // no chronyc
+	var stdout, stderr bytes.Buffer
+	if code := runCommand(context.Background(), "check", nil, &stdout, &stderr); code != exitUnknown {
+		t.Errorf("exit %d, want %d", code, exitUnknown)
+	}
+	if got := stdout.String(); !strings.HasPrefix(got, "NTP UNKNOWN - chronyc ") {
+		t.Errorf("output %q", got)
+	}
+}
+
+func TestRunCollect(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	if code := runCommand(context.Background(), "collect", []string{"-fixture-dir", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	// chronyc may not be installed here, but /proc is
+	for _, name := range []string{"meminfo", "loadavg"} {
+		if _, err := os.Stat(filepath.Join(dir, "proc", name)); err != nil {
+			t.Errorf("proc/%s not captured: %v", name, err)
+		}
+	}
+	if !strings.Contains(stdout.String(), filepath.Join(dir, "proc", "meminfo")) {
+		t.Errorf("written files not listed: %q", stdout.String())
+	}
+	// the proc and sys halves read back like the live system
+	now := time.Now()
+	fixture, live := readClockHardware(dir, now), readClockHardware("/", now)
+	if !slices.Equal(fixture.TSCFlags, live.TSCFlags) {
+		t.Errorf("TSC flags from the fixture %v, live %v", fixture.TSCFlags, live.TSCFlags)
+	}
+	if fixture.CurrentClocksource != live.CurrentClocksource || !slices.Equal(fixture.AvailableClocksources, live.AvailableClocksources) {
+		t.Errorf("clocksource from the fixture %q %v, live %q %v", fixture.CurrentClocksource, fixture.AvailableClocksources,
+			live.CurrentClocksource, live.AvailableClocksources)
+	}
+	if len(fixture.RTCs) != len(live.RTCs) {
+		t.Errorf("%d RTCs in the fixture, %d live", len(fixture.RTCs), len(live.RTCs))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RTCInfo describes one hardware real-time clock from /sys/class/rtc
+type RTCInfo struct {
+	Device       string  `json:"device"`
+	Name         string  `json:"name"`
+	Time         string  `json:"time"`
+	DriftSecs    float64 `json:"driftSecs"`
+	DriftDisplay string  `json:"driftDisplay"`
+	HCToSys      bool    `json:"hcToSys"`
+}
+
+// ChronyRTC holds chronyc rtcdata, present when chrony tracks the RTC
+type ChronyRTC struct {
+	RefTime    string `json:"refTime"`
+	Samples    string `json:"samples"`
+	Runs       string `json:"runs"`
+	SpanPeriod string `json:"spanPeriod"`
+	Offset     string `json:"offset"`
+	Rate       string `json:"rate"`
+}
+
+// ClockHardware is the hardware side of timekeeping: kernel clocksource,
+// TSC capabilities and the RTCs
+type ClockHardware struct {
+	CurrentClocksource    string     `json:"currentClocksource"`
+	AvailableClocksources []string   `json:"availableClocksources"`
+	TSCFlags              []string   `json:"tscFlags"`
+	KernelClockParams     []string   `json:"kernelClockParams"`
+	RTCs                  []RTCInfo  `json:"rtcs"`
+	ChronyRTC             *ChronyRTC `json:"chronyRTC,omitempty"`
+}
+
+// tscCPUFlags are the /proc/cpuinfo flags that matter for TSC stability
+var tscCPUFlags = map[string]bool{
+	"tsc":                true,
+	"constant_tsc":       true,
+	"nonstop_tsc":        true,
+	"tsc_known_freq":     true,
+	"tsc_reliable":       true,
+	"tsc_adjust":         true,
+	"tsc_deadline_timer": true,
+	"rdtscp":             true,
+}
+
+// kernelClockParams are command line parameters that change clocksource
+// selection or TSC handling
+var kernelClockParams = []string{"clocksource=", "tsc=", "notsc", "nohz", "hpet=", "idle=", "processor.max_cstate=", "intel_idle.max_cstate="}
+
+func getClockHardware(ctx context.Context) ClockHardware {
+	hw := readClockHardware("/", time.Now())
+	hw.ChronyRTC = getChronyRTC(ctx)
+	return hw
+}
+
+// readClockHardware reads sysfs and procfs below root, which tests point at
+// a fixture tree.
+func readClockHardware(root string, now time.Time) ClockHardware {
+	var hw ClockHardware
+
+	csDir := filepath.Join(root, "sys/devices/system/clocksource/clocksource0")
+	if b, err := os.ReadFile(filepath.Join(csDir, "current_clocksource")); err == nil {
+		hw.CurrentClocksource = strings.TrimSpace(string(b))
+	}
+	if b, err := os.ReadFile(filepath.Join(csDir, "available_clocksource")); err == nil {
+		hw.AvailableClocksources = strings.Fields(string(b))
+	}
+
+	if f, err := os.Open(filepath.Join(root, "proc/cpuinfo")); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "flags") {
+				continue
+			}
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			for _, flag := range strings.Fields(parts[1]) {
+				if tscCPUFlags[flag] {
+					hw.TSCFlags = append(hw.TSCFlags, flag)
+				}
+			}
+			// All CPUs report the same flags
+			break
+		}
+		f.Close()
+		sort.Strings(hw.TSCFlags)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(root, "proc/cmdline")); err == nil {
+		for _, arg := range strings.Fields(string(b)) {
+			for _, p := range kernelClockParams {
+				if arg == p || strings.HasPrefix(arg, p) {
+					hw.KernelClockParams = append(hw.KernelClockParams, arg)
+					break
+				}
+			}
+		}
+	}
+
+	rtcDirs, _ := filepath.Glob(filepath.Join(root, "sys/class/rtc/rtc*"))
+	sort.Strings(rtcDirs)
+	for _, dir := range rtcDirs {
+		rtc := RTCInfo{Device: filepath.Base(dir)}
+		if b, err := os.ReadFile(filepath.Join(dir, "name")); err == nil {
+			rtc.Name = strings.TrimSpace(string(b))
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, "hctosys")); err == nil {
+			rtc.HCToSys = strings.TrimSpace(string(b)) == "1"
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "since_epoch"))
+		if err != nil {
+			hw.RTCs = append(hw.RTCs, rtc)
+			continue
+		}
+		epoch, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			hw.RTCs = append(hw.RTCs, rtc)
+			continue
+		}
+		// sysfs exposes whole seconds only, so the drift is +/- 1 s
+		rtcTime := time.Unix(epoch, 0)
+		rtc.Time = rtcTime.UTC().Format("2006-01-02 15:04:05 UTC")
+		rtc.DriftSecs = rtcTime.Sub(now.Truncate(time.Second)).Seconds()
+		rtc.DriftDisplay = strconv.FormatFloat(rtc.DriftSecs, 'f', 0, 64) + " s"
+		hw.RTCs = append(hw.RTCs, rtc)
+	}
+	return hw
+}
+
+func getChronyRTC(ctx context.Context) *ChronyRTC {
+	out, err := chronycOutput(ctx, "rtcdata")
+	if err != nil {
+		return nil
+	}
+	return parseChronyRTC(string(out))
+}
+
+// parseChronyRTC reads chronyc rtcdata. It returns nil when chronyd is not
+// tracking the RTC (no rtcfile configured), which chronyc reports as an
+// error message rather than key/value lines.
+func parseChronyRTC(out string) *ChronyRTC {
+	var rtc ChronyRTC
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		val := strings.TrimSpace(parts[1])
+		switch key {
+		case "RTC ref time (GMT)", "RTC ref time (UTC)":
+			rtc.RefTime = val
+		case "Number of samples":
+			rtc.Samples = val
+		case "Number of runs":
+			rtc.Runs = val
+		case "Sample span period":
+			rtc.SpanPeriod = val
+		case "RTC is fast by":
+			rtc.Offset = formatSecondsStr(val)
+		case "RTC gains time at":
+			rtc.Rate = formatFreqStr(val)
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return &rtc
+}
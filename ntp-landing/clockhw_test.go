@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadClockHardware(t *testing.T) {
+	// The fixture RTC reads 2026-01-01 00:00:02 UTC
+	now := time.Date(2026, 1, 1, 0, 0, 0, 500e6, time.UTC)
+	hw := readClockHardware("testdata/hw", now)
+
+	if hw.CurrentClocksource != "tsc" {
+		t.Errorf("current clocksource = %q", hw.CurrentClocksource)
+	}
+	if !reflect.DeepEqual(hw.AvailableClocksources, []string{"tsc", "hpet", "acpi_pm"}) {
+		t.Errorf("available clocksources = %v", hw.AvailableClocksources)
+	}
+	wantFlags := []string{"constant_tsc", "nonstop_tsc", "rdtscp", "tsc", "tsc_adjust", "tsc_known_freq"}
+	if !reflect.DeepEqual(hw.TSCFlags, wantFlags) {
+		t.Errorf("TSC flags = %v, want %v", hw.TSCFlags, wantFlags)
+	}
+	wantParams := []string{"clocksource=tsc", "tsc=reliable", "nohz_full=1"}
+	if !reflect.DeepEqual(hw.KernelClockParams, wantParams) {
+		t.Errorf("kernel params = %v, want %v", hw.KernelClockParams, wantParams)
+	}
+	if len(hw.RTCs) != 1 {
+		t.Fatalf("expected one RTC, got %d", len(hw.RTCs))
+	}
+	rtc := hw.RTCs[0]
+	if rtc.Device != "rtc0" || rtc.Name != "rtc_cmos" || !rtc.HCToSys || rtc.DriftSecs != 2 {
+		t.Errorf("unexpected RTC: %+v", rtc)
+	}
+}
+
+func TestParseChronyRTC(t *testing.T) {
+	out := `RTC ref time (GMT) : Sat May 30 07:25:56 2015
+Number of samples  : 10
+Number of runs     : 5
+Sample span period :  549
+RTC is fast by     :    -1.632736 seconds
+RTC gains time at  :  -107.623 ppm
+`
+	rtc := parseChronyRTC(out)
+	if rtc == nil {
+		t.Fatal("expected rtcdata to parse")
+	}
+	if rtc.Samples != "10" || rtc.Runs != "5" || rtc.Offset != "-1.6 s" || rtc.Rate != "-107.62 ppm" {
+		t.Errorf("unexpected rtcdata: %+v", rtc)
+	}
+	if parseChronyRTC("513 RTC driver not running\n") != nil {
+		t.Error("expected nil when RTC tracking is not configured")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// snapshotCollector samples chrony on a fixed interval, independent of page
+// loads, and hands every snapshot to the registered observers.
+type snapshotCollector struct {
+	interval  time.Duration
+	observers []func(NTPStats, time.Time)
+
+	mu      sync.RWMutex
+	latest  NTPStats
+	updated time.Time
+}
+
+func newSnapshotCollector(interval time.Duration) *snapshotCollector {
+	return &snapshotCollector{interval: interval}
+}
+
+// OnSnapshot registers fn to be called after every collection. Observers
+// must be registered before Run is started.
+func (c *snapshotCollector) OnSnapshot(fn func(NTPStats, time.Time)) {
+	c.observers = append(c.observers, fn)
+}
+
+// Collect takes one snapshot and notifies observers. The chronyc calls are
+// bounded by the collect interval so a hung chronyd cannot stall the loop.
+// A failed collection is passed to observers but does not replace the
+// latest snapshot.
+func (c *snapshotCollector) Collect(ctx context.Context) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+	start := time.Now()
+	stats := getNTPStats(ctx)
+	now := time.Now()
+	if parent.Err() != nil {
+		// shutting down; keep the previous snapshot rather than reporting
+		// chronyd as gone
+		slog.Warn("snapshot abandoned", "component", "collector", "error", parent.Err())
+		return
+	}
+	if stats.Err != nil {
+		slog.Warn("chronyc collection failed", "component", "collector", "error", stats.Err)
+	} else {
+		if len(stats.Sources) == 0 {
+			slog.Warn("chronyc sources returned no sources", "component", "collector")
+		}
+		slog.Debug("snapshot collected", "component", "collector",
+			"duration_ms", now.Sub(start).Milliseconds(), "sources", len(stats.Sources),
+			"synced", stats.Synced, "offset", stats.Offset)
+
+		c.mu.Lock()
+		c.latest = stats
+		c.updated = now
+		c.mu.Unlock()
+	}
+
+	for _, fn := range c.observers {
+		fn(stats, now)
+	}
+}
+
+// Run collects at the configured interval until ctx is cancelled
+func (c *snapshotCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Collect(ctx)
+		}
+	}
+}
+
+// Latest returns the most recent snapshot and when it was taken
+func (c *snapshotCollector) Latest() (NTPStats, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latest, c.updated
+}
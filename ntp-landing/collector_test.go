@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCollectorStopsOnCancel(t *testing.T) {
+	c := newSnapshotCollector(time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestCollectKeepsSnapshotWhenCancelled(t *testing.T) {
+	c := newSnapshotCollector(time.Second)
+	prev := NTPStats{LeapStatus: "Normal", Sources: []NTPSource{{Name: "a.example"}}}
+	at := time.Now().Add(-time.Minute)
+	c.latest, c.updated = prev, at
+	called := false
+	c.OnSnapshot(func(NTPStats, time.Time) { called = true })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Collect(ctx)
+
+	stats, updated := c.Latest()
+	if called || !updated.Equal(at) || stats.LeapStatus != "Normal" {
+		t.Errorf("cancelled collect replaced snapshot: %+v at %v (observers called %v)", stats, updated, called)
+	}
+}
+
+func TestCollectPassesFailureToObservers(t *testing.T) {
+	t.Setenv("PATH", t.TempDir()) // no chronyc
+	c := newSnapshotCollector(time.Second)
+	prev := NTPStats{LeapStatus: "Normal", Sources: []NTPSource{{Name: "a.example"}}}
+	at := time.Now().Add(-time.Minute)
+	c.latest, c.updated = prev, at
+	var got NTPStats
+	c.OnSnapshot(func(stats NTPStats, _ time.Time) { got = stats })
+
+	c.Collect(context.Background())
+
+	if got.Err == nil {
+		t.Error("observers were not told the collection failed")
+	}
+	if stats, updated := c.Latest(); !updated.Equal(at) || stats.LeapStatus != "Normal" {
+		t.Errorf("failed collect replaced snapshot: %+v at %v", stats, updated)
+	}
+}
+
+func TestTimexSamplerStopsOnCancel(t *testing.T) {
+	s := newTimexSampler(time.Millisecond, time.Second)
+	s.read = func() (timexRaw, error) { return timexRaw{}, nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if _, ok := s.Latest(); !ok {
+		t.Error("no samples taken before cancel")
+	}
+}
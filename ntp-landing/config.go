@@ -0,0 +1,372 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds runtime settings. Every field can be overridden from the
+// environment (NTP_LANDING_*) so the systemd unit can carry them in an
+// EnvironmentFile.
+type Config struct {
+	// ListenAddrs are the HTTP listen addresses. ":80" is one dual-stack
+	// socket; literal addresses ("172.16.16.108:80", "[2603:...::108]:80")
+	// bind that family only, so each stack can be controlled on its own.
+	ListenAddrs []string
+
+	// ReadTimeout bounds reading a whole request (ReadHeaderTimeout its
+	// headers), WriteTimeout the response including the chronyc and
+	// Prometheus calls behind it, and IdleTimeout keep-alive connections.
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGTERM.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+
+	// TLSCert and TLSKey (PEM files from the internal CA) enable HTTPS on
+	// TLSListenAddrs. The pair is reloaded when either file changes
+	// (checked every TLSReloadInterval) or on SIGHUP. HTTPMode says what
+	// ListenAddrs do while TLS is on: redirect to HTTPS (probe endpoints
+	// excepted) or serve the pages as well. HSTSMaxAge is announced over
+	// HTTPS; zero leaves the header off.
+	TLSCert           string
+	TLSKey            string
+	TLSListenAddrs    []string
+	TLSReloadInterval time.Duration
+	HTTPMode          string
+	HSTSMaxAge        time.Duration
+
+	// MetricsListenAddrs move /metrics off the page listeners onto its own
+	// plain HTTP listeners, so scrapes can use a port that is not exposed
+	// beyond the monitoring network. Empty serves it with the pages.
+	MetricsListenAddrs []string
+
+	// FrameAncestors lists the origins allowed to embed the pages in a
+	// frame (e.g. a Homepage or Grafana dashboard). Empty denies framing.
+	FrameAncestors []string
+
+	// CollectInterval is how often the background collector samples chrony.
+	CollectInterval time.Duration
+
+	// NTSStaleAfter flags an NTS source whose last authenticated sample is
+	// older than this.
+	NTSStaleAfter time.Duration
+	// NTSMinCookies flags an NTS source holding this many cookies or fewer.
+	NTSMinCookies int
+	// NTSMaxAttempts flags an NTS source with more NTS-KE attempts than this
+	// since its last successful key establishment.
+	NTSMaxAttempts int
+	// NTSHistory is how far back the NTS tracker keeps cookie samples for
+	// trend estimation.
+	NTSHistory time.Duration
+
+	// ChronyLogDir holds chrony's tracking, statistics and measurements
+	// logs, used for chart history when Prometheus is unavailable.
+	ChronyLogDir string
+
+	// TimexInterval is how often the kernel clock is read via adjtimex;
+	// TimexWindow is how much of that history is kept in memory.
+	TimexInterval time.Duration
+	TimexWindow   time.Duration
+
+	// OutlierThreshold is the robust deviation (in consensus sigmas) above
+	// which a source sample counts as disagreeing with the consensus.
+	OutlierThreshold float64
+	// OutlierPersist is the fraction of samples in OutlierWindow that must
+	// disagree before a source is reported as a persistent outlier.
+	OutlierPersist    float64
+	OutlierWindow     time.Duration
+	OutlierMinSamples int
+	// FlapThreshold is how many selected/unselected transitions within
+	// OutlierWindow make a source count as flapping.
+	FlapThreshold int
+
+	// ChronyConf is the main chrony configuration file. Empty means the
+	// first of /etc/chrony/chrony.conf and /etc/chrony.conf that exists.
+	ChronyConf string
+
+	// AdminUser and AdminPasswordSHA256 (hex) guard the admin page with
+	// HTTP Basic auth. The admin page is disabled while the hash is empty.
+	// Deprecated: the hash is unsalted; use AuthMode basic with a
+	// pbkdf2-sha256 entry in AuthUsersFile and the user in AuthAdmins.
+	AdminUser           string
+	AdminPasswordSHA256 string
+	// AuthMode identifies callers: none, basic (AuthUsersFile of user:hash
+	// lines), header (AuthUserHeader, trusted only from AuthTrustedProxies)
+	// or tailscale (LocalAPI whois on TailscaleSocket). AuthAdmins may use
+	// the admin page; AuthViewers, when set, limits who counts as a viewer.
+	// Everyone else gets AuthAnonymousRole (none or viewer), so the
+	// read-only pages stay open by default.
+	AuthMode           string
+	AuthUsersFile      string
+	AuthUserHeader     string
+	AuthTrustedProxies []string
+	TailscaleSocket    string
+	AuthAdmins         []string
+	AuthViewers        []string
+	AuthAnonymousRole  string
+	// AuditLog is the file admin actions are appended to as JSON lines.
+	AuditLog string
+	// AdminTimeout bounds how long one chronyc admin command may run.
+	AdminTimeout time.Duration
+
+	// EventsDB is the bbolt file the event timeline is stored in; empty
+	// disables it. Events older than EventsRetention are pruned.
+	EventsDB        string
+	EventsRetention time.Duration
+
+	// NotifyRules are the enabled alert rules: offset, unsynced, sources,
+	// nts and collection. Offset fires when |offset| stays above
+	// NotifyOffsetThreshold for NotifyOffsetFor; unsynced and sources (fewer
+	// than NotifyMinSources online) after NotifyFor; nts as soon as the NTS
+	// tracker reports a stale or failing source; collection when chronyc
+	// cannot be read for NotifyFor. Firing alerts are repeated every
+	// NotifyRepeat (0 disables repeats).
+	NotifyRules           []string
+	NotifyOffsetThreshold time.Duration
+	NotifyOffsetFor       time.Duration
+	NotifyFor             time.Duration
+	NotifyMinSources      int
+	NotifyRepeat          time.Duration
+
+	// Notification targets; each is enabled by setting its URL or address.
+	NotifyWebhookURL   string
+	NotifyNtfyURL      string
+	NotifyNtfyToken    string
+	NotifyGotifyURL    string
+	NotifyGotifyToken  string
+	NotifyHassURL      string
+	NotifyHassToken    string
+	NotifyHassService  string
+	NotifySMTPAddr     string
+	NotifySMTPFrom     string
+	NotifySMTPTo       []string
+	NotifySMTPUser     string
+	NotifySMTPPassword string
+
+	// MQTTBroker (host:port) enables publishing to Home Assistant through
+	// MQTT discovery. State goes to MQTTTopicPrefix/<host>/state and the
+	// discovery configs below MQTTDiscoveryPrefix.
+	MQTTBroker          string
+	MQTTUser            string
+	MQTTPassword        string
+	MQTTTopicPrefix     string
+	MQTTDiscoveryPrefix string
+
+	// LogLevel is debug, info, warn or error; LogFormat is text or json
+	// for the console (journald) output.
+	LogLevel  string
+	LogFormat string
+	// SyslogAddr (host:port) additionally sends RFC 5424 syslog over UDP,
+	// e.g. to Sentinella on 1514.
+	SyslogAddr     string
+	SyslogFacility string
+	// LokiURL additionally pushes logs to Loki; LokiTenant sets
+	// X-Scope-OrgID for multi-tenant setups.
+	LokiURL    string
+	LokiTenant string
+
+	// LokiQueryURL is the Loki the "Recent chronyd logs" panel reads from,
+	// LokiURL when empty; the panel is hidden when neither is set.
+	// LogsQuery is the LogQL stream selector for chronyd, LogsWindow how far
+	// back the panel looks and LogsLimit how many lines it shows.
+	LokiQueryURL string
+	LogsQuery    string
+	LogsWindow   time.Duration
+	LogsLimit    int
+
+	// StatusChecks are the criteria /status/ntp requires: leap (leap status
+	// Normal), offset (|offset| at most StatusMaxOffset) and sources (at
+	// least StatusMinSources reachable). StatusMaxAge is how old the last
+	// collector snapshot may be for /readyz and /status/ntp to pass; zero
+	// means three collect intervals.
+	StatusChecks     []string
+	StatusMaxOffset  time.Duration
+	StatusMinSources int
+	StatusMaxAge     time.Duration
+
+	// DNSName is looked up for the network panel's A/AAAA check; empty
+	// means the host name, "-" disables the check.
+	DNSName string
+}
+
+func loadConfig() Config {
+	cfg := Config{
+		ListenAddrs:       envList("NTP_LANDING_LISTEN_ADDR", []string{":80"}),
+		ReadHeaderTimeout: envDuration("NTP_LANDING_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("NTP_LANDING_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      envDuration("NTP_LANDING_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       envDuration("NTP_LANDING_IDLE_TIMEOUT", 2*time.Minute),
+		ShutdownTimeout:   envDuration("NTP_LANDING_SHUTDOWN_TIMEOUT", 15*time.Second),
+
+		TLSCert:           envString("NTP_LANDING_TLS_CERT", ""),
+		TLSKey:            envString("NTP_LANDING_TLS_KEY", ""),
+		TLSListenAddrs:    envList("NTP_LANDING_TLS_LISTEN_ADDR", []string{":443"}),
+		TLSReloadInterval: envDuration("NTP_LANDING_TLS_RELOAD_INTERVAL", time.Minute),
+		HTTPMode:          envString("NTP_LANDING_HTTP_MODE", "redirect"),
+		HSTSMaxAge:        envDuration("NTP_LANDING_HSTS_MAX_AGE", 180*24*time.Hour),
+		FrameAncestors:    envList("NTP_LANDING_FRAME_ANCESTORS", nil),
+
+		MetricsListenAddrs: envList("NTP_LANDING_METRICS_LISTEN_ADDR", nil),
+
+		CollectInterval: envPositiveDuration("NTP_LANDING_COLLECT_INTERVAL", 30*time.Second),
+		NTSStaleAfter:   envDuration("NTP_LANDING_NTS_STALE_AFTER", 15*time.Minute),
+		NTSMinCookies:   envInt("NTP_LANDING_NTS_MIN_COOKIES", 2),
+		NTSMaxAttempts:  envInt("NTP_LANDING_NTS_MAX_ATTEMPTS", 1),
+		NTSHistory:      envDuration("NTP_LANDING_NTS_HISTORY", 6*time.Hour),
+		ChronyLogDir:    envString("NTP_LANDING_CHRONY_LOG_DIR", "/var/log/chrony"),
+		TimexInterval:   envPositiveDuration("NTP_LANDING_TIMEX_INTERVAL", 10*time.Second),
+		TimexWindow:     envPositiveDuration("NTP_LANDING_TIMEX_WINDOW", time.Hour),
+
+		OutlierThreshold:  envFloat("NTP_LANDING_OUTLIER_THRESHOLD", 3.5),
+		OutlierPersist:    envFloat("NTP_LANDING_OUTLIER_PERSIST", 0.5),
+		OutlierWindow:     envDuration("NTP_LANDING_OUTLIER_WINDOW", time.Hour),
+		OutlierMinSamples: envInt("NTP_LANDING_OUTLIER_MIN_SAMPLES", 5),
+		FlapThreshold:     envInt("NTP_LANDING_FLAP_THRESHOLD", 4),
+
+		ChronyConf: envString("NTP_LANDING_CHRONY_CONF", ""),
+
+		AdminUser:           envString("NTP_LANDING_ADMIN_USER", "admin"),
+		AdminPasswordSHA256: envString("NTP_LANDING_ADMIN_PASSWORD_SHA256", ""),
+		AuthMode:            envString("NTP_LANDING_AUTH_MODE", "none"),
+		AuthUsersFile:       envString("NTP_LANDING_AUTH_USERS_FILE", "/etc/ntp-landing/users"),
+		AuthUserHeader:      envString("NTP_LANDING_AUTH_USER_HEADER", "Tailscale-User-Login"),
+		AuthTrustedProxies:  envList("NTP_LANDING_AUTH_TRUSTED_PROXIES", []string{"127.0.0.1", "::1"}),
+		TailscaleSocket:     envString("NTP_LANDING_TAILSCALE_SOCKET", "/var/run/tailscale/tailscaled.sock"),
+		AuthAdmins:          envList("NTP_LANDING_AUTH_ADMINS", nil),
+		AuthViewers:         envList("NTP_LANDING_AUTH_VIEWERS", nil),
+		AuthAnonymousRole:   envString("NTP_LANDING_AUTH_ANONYMOUS_ROLE", "viewer"),
+		AuditLog:            envString("NTP_LANDING_AUDIT_LOG", "/var/log/ntp-landing/audit.log"),
+		AdminTimeout:        envDuration("NTP_LANDING_ADMIN_TIMEOUT", 10*time.Second),
+
+		EventsDB:        envString("NTP_LANDING_EVENTS_DB", "/var/lib/ntp-landing/events.db"),
+		EventsRetention: envDuration("NTP_LANDING_EVENTS_RETENTION", 90*24*time.Hour),
+
+		NotifyRules:           envList("NTP_LANDING_NOTIFY_RULES", []string{"offset", "unsynced", "sources", "nts", "collection"}),
+		NotifyOffsetThreshold: envDuration("NTP_LANDING_NOTIFY_OFFSET_THRESHOLD", time.Millisecond),
+		NotifyOffsetFor:       envDuration("NTP_LANDING_NOTIFY_OFFSET_FOR", 5*time.Minute),
+		NotifyFor:             envDuration("NTP_LANDING_NOTIFY_FOR", 2*time.Minute),
+		NotifyMinSources:      envInt("NTP_LANDING_NOTIFY_MIN_SOURCES", 2),
+		NotifyRepeat:          envDuration("NTP_LANDING_NOTIFY_REPEAT", 6*time.Hour),
+
+		NotifyWebhookURL:   envString("NTP_LANDING_NOTIFY_WEBHOOK_URL", ""),
+		NotifyNtfyURL:      envString("NTP_LANDING_NOTIFY_NTFY_URL", ""),
+		NotifyNtfyToken:    envString("NTP_LANDING_NOTIFY_NTFY_TOKEN", ""),
+		NotifyGotifyURL:    envString("NTP_LANDING_NOTIFY_GOTIFY_URL", ""),
+		NotifyGotifyToken:  envString("NTP_LANDING_NOTIFY_GOTIFY_TOKEN", ""),
+		NotifyHassURL:      envString("NTP_LANDING_NOTIFY_HASS_URL", ""),
+		NotifyHassToken:    envString("NTP_LANDING_NOTIFY_HASS_TOKEN", ""),
+		NotifyHassService:  envString("NTP_LANDING_NOTIFY_HASS_SERVICE", "notify"),
+		NotifySMTPAddr:     envString("NTP_LANDING_NOTIFY_SMTP_ADDR", ""),
+		NotifySMTPFrom:     envString("NTP_LANDING_NOTIFY_SMTP_FROM", "ntp-landing@localhost"),
+		NotifySMTPTo:       envList("NTP_LANDING_NOTIFY_SMTP_TO", nil),
+		NotifySMTPUser:     envString("NTP_LANDING_NOTIFY_SMTP_USER", ""),
+		NotifySMTPPassword: envString("NTP_LANDING_NOTIFY_SMTP_PASSWORD", ""),
+
+		MQTTBroker:          envString("NTP_LANDING_MQTT_BROKER", ""),
+		MQTTUser:            envString("NTP_LANDING_MQTT_USER", ""),
+		MQTTPassword:        envString("NTP_LANDING_MQTT_PASSWORD", ""),
+		MQTTTopicPrefix:     envString("NTP_LANDING_MQTT_TOPIC_PREFIX", "ntp-landing"),
+		MQTTDiscoveryPrefix: envString("NTP_LANDING_MQTT_DISCOVERY_PREFIX", "homeassistant"),
+
+		LogLevel:       envString("NTP_LANDING_LOG_LEVEL", "info"),
+		LogFormat:      envString("NTP_LANDING_LOG_FORMAT", "text"),
+		SyslogAddr:     envString("NTP_LANDING_SYSLOG_ADDR", ""),
+		SyslogFacility: envString("NTP_LANDING_SYSLOG_FACILITY", "daemon"),
+		LokiURL:        envString("NTP_LANDING_LOKI_URL", ""),
+		LokiTenant:     envString("NTP_LANDING_LOKI_TENANT", ""),
+
+		LokiQueryURL: envString("NTP_LANDING_LOKI_QUERY_URL", ""),
+		LogsQuery:    envString("NTP_LANDING_LOGS_QUERY", `{unit="chronyd.service"}`),
+		LogsWindow:   envDuration("NTP_LANDING_LOGS_WINDOW", 24*time.Hour),
+		LogsLimit:    envInt("NTP_LANDING_LOGS_LIMIT", 50),
+
+		StatusChecks:     envList("NTP_LANDING_STATUS_CHECKS", []string{"leap", "offset", "sources"}),
+		StatusMaxOffset:  envDuration("NTP_LANDING_STATUS_MAX_OFFSET", 100*time.Millisecond),
+		StatusMinSources: envInt("NTP_LANDING_STATUS_MIN_SOURCES", 2),
+		StatusMaxAge:     envDuration("NTP_LANDING_STATUS_MAX_AGE", 0),
+
+		DNSName: envString("NTP_LANDING_DNS_NAME", ""),
+	}
+	if cfg.StatusMaxAge <= 0 {
+		cfg.StatusMaxAge = 3 * cfg.CollectInterval
+	}
+	return cfg
+}
+
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// envList reads a comma separated list, dropping empty items
+func envList(key string, def []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: %v", key, v, err)
+		return def
+	}
+	return n
+}
+
+func envFloat(key string, def float64) float64 {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: %v", key, v, err)
+		return def
+	}
+	return f
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: %v", key, v, err)
+		return def
+	}
+	return d
+}
+
+// envPositiveDuration is envDuration for intervals that drive a ticker,
+// where zero or a negative value cannot work
+func envPositiveDuration(key string, def time.Duration) time.Duration {
+	d := envDuration(key, def)
+	if d <= 0 {
+		log.Printf("Ignoring %s=%q: must be a positive duration, using %s", key, os.Getenv(key), def)
+		return def
+	}
+	return d
+}
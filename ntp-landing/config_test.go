@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadConfigRejectsNonPositiveIntervals(t *testing.T) {
+	for _, v := range []string{"0", "0s", "-30s"} {
+		t.Setenv("NTP_LANDING_COLLECT_INTERVAL", v)
+		t.Setenv("NTP_LANDING_TIMEX_INTERVAL", v)
+		t.Setenv("NTP_LANDING_TIMEX_WINDOW", v)
+		cfg := loadConfig()
+		if cfg.CollectInterval != 30*time.Second {
+			t.Errorf("collect interval %q: got %s, want the default", v, cfg.CollectInterval)
+		}
+		if cfg.TimexInterval != 10*time.Second || cfg.TimexWindow != time.Hour {
+			t.Errorf("timex %q: got interval %s window %s, want the defaults", v, cfg.TimexInterval, cfg.TimexWindow)
+		}
+	}
+	t.Setenv("NTP_LANDING_COLLECT_INTERVAL", "5s")
+	if cfg := loadConfig(); cfg.CollectInterval != 5*time.Second {
+		t.Errorf("collect interval 5s: got %s", cfg.CollectInterval)
+	}
+}
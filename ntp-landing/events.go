@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Event is one synchronisation state change found by diffing consecutive
+// collector snapshots
+type Event struct {
+	ID       uint64    `json:"id"`
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Severity string    `json:"severity"` // info, warning or critical
+	Source   string    `json:"source,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// diffSnapshots returns the events between two snapshots. prev is the zero
+// value on the very first snapshot, which yields no events, and a failed
+// collection yields none either rather than every source disappearing.
+// NTS sources count as failing above maxAttempts NTS-KE attempts.
+func diffSnapshots(prev, cur NTPStats, at time.Time, maxAttempts int) []Event {
+	if prev.Sources == nil && prev.LeapStatus == "" || cur.Err != nil {
+		return nil
+	}
+	var events []Event
+	add := func(kind, severity, source, format string, args ...interface{}) {
+		events = append(events, Event{Time: at, Kind: kind, Severity: severity, Source: source, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if prev.LeapStatus != cur.LeapStatus && cur.LeapStatus != "" {
+		switch {
+		case cur.LeapStatus == "Normal":
+			add("leap-status", "info", "", "leap status back to Normal (was %s)", prev.LeapStatus)
+		case cur.LeapStatus == "Not synchronised":
+			add("leap-status", "critical", "", "leap status changed from %s to Not synchronised", prev.LeapStatus)
+		default:
+			add("leap-status", "warning", "", "leap status changed from %s to %s", prev.LeapStatus, cur.LeapStatus)
+		}
+	}
+
+	prevSel, curSel := selectedSource(prev), selectedSource(cur)
+	if prevSel != curSel {
+		switch {
+		case curSel == "":
+			add("selected-source", "critical", prevSel, "no source selected, %s was deselected", prevSel)
+		case prevSel == "":
+			add("selected-source", "info", curSel, "%s selected", curSel)
+		default:
+			add("selected-source", "warning", curSel, "selected source changed from %s to %s", prevSel, curSel)
+		}
+	}
+
+	prevSrc := make(map[string]NTPSource, len(prev.Sources))
+	for _, s := range prev.Sources {
+		prevSrc[s.Name] = s
+	}
+	curSrc := make(map[string]bool, len(cur.Sources))
+	for _, s := range cur.Sources {
+		curSrc[s.Name] = true
+		p, ok := prevSrc[s.Name]
+		if !ok {
+			add("source-added", "info", s.Name, "%s appeared in chronyc sources", s.Name)
+			continue
+		}
+		wasReachable, reachable := reachNonZero(p.Reach), reachNonZero(s.Reach)
+		if wasReachable && !reachable {
+			add("reach-lost", "warning", s.Name, "%s became unreachable (reach 0)", s.Name)
+		} else if !wasReachable && reachable {
+			add("reach-restored", "info", s.Name, "%s is reachable again (reach %s)", s.Name, s.Reach)
+		}
+	}
+	for _, s := range prev.Sources {
+		if !curSrc[s.Name] {
+			add("source-removed", "info", s.Name, "%s disappeared from chronyc sources", s.Name)
+		}
+	}
+
+	prevNTS := make(map[string]NTSDetail, len(prev.NTSDetails))
+	for _, d := range prev.NTSDetails {
+		prevNTS[d.Name] = d
+	}
+	for _, d := range cur.NTSDetails {
+		p, ok := prevNTS[d.Name]
+		if !ok {
+			continue
+		}
+		wasFailing, failing := ntsFailing(p, maxAttempts), ntsFailing(d, maxAttempts)
+		if !wasFailing && failing {
+			reason := fmt.Sprintf("%d NTS-KE attempts", d.Attempts)
+			if d.NAK {
+				reason = "server answered with NAK"
+			}
+			add("nts-auth-failed", "warning", d.Name, "NTS authentication failing for %s: %s", d.Name, reason)
+		} else if wasFailing && !failing {
+			add("nts-auth-restored", "info", d.Name, "NTS authentication restored for %s", d.Name)
+		}
+	}
+	return events
+}
+
+func selectedSource(stats NTPStats) string {
+	for _, s := range stats.Sources {
+		if s.StatusIcon == "*" {
+			return s.Name
+		}
+	}
+	return ""
+}
+
+func reachNonZero(reach string) bool {
+	n, err := strconv.ParseUint(strings.TrimSpace(reach), 8, 16)
+	return err == nil && n != 0
+}
+
+// ntsFailing is true while key establishment has been retried more than
+// maxAttempts times or the server refused our cookies, matching the NTS
+// tracker's threshold
+func ntsFailing(d NTSDetail, maxAttempts int) bool {
+	return d.Attempts > maxAttempts || d.NAK
+}
+
+var (
+	eventsBucket = []byte("events")
+	stateBucket  = []byte("state")
+	lastStatsKey = []byte("last-snapshot")
+)
+
+// eventStore persists events in a bbolt file, keyed by a big-endian
+// sequence so iteration order is insertion (and therefore time) order. It
+// also keeps the last snapshot so changes across a restart are not lost.
+type eventStore struct {
+	db *bolt.DB
+}
+
+func openEventStore(path string) (*eventStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{eventsBucket, stateBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &eventStore{db: db}, nil
+}
+
+func (s *eventStore) Close() error {
+	return s.db.Close()
+}
+
+// Append stores events and fills in their IDs
+func (s *eventStore) Append(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		for i := range events {
+			id, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			events[i].ID = id
+			v, err := json.Marshal(events[i])
+			if err != nil {
+				return err
+			}
+			if err := b.Put(eventKey(id), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Since returns events at or after since, newest first, at most limit of
+// them when limit > 0
+func (s *eventStore) Since(since time.Time, limit int) ([]Event, error) {
+	var out []Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Time.Before(since) {
+				break
+			}
+			out = append(out, e)
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Prune deletes events older than before
+func (s *eventStore) Prune(before time.Time) (int, error) {
+	n := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if !e.Time.Before(before) {
+				break
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (s *eventStore) loadLastSnapshot() (NTPStats, bool) {
+	var stats NTPStats
+	found := false
+	s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(stateBucket).Get(lastStatsKey)
+		if v != nil && json.Unmarshal(v, &stats) == nil {
+			found = true
+		}
+		return nil
+	})
+	return stats, found
+}
+
+func (s *eventStore) saveLastSnapshot(stats NTPStats) error {
+	v, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put(lastStatsKey, v)
+	})
+}
+
+func eventKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// eventDetector diffs every collector snapshot against the previous one
+// and stores the resulting events, pruning those past the retention.
+type eventDetector struct {
+	store          *eventStore
+	retention      time.Duration
+	ntsMaxAttempts int
+
+	mu        sync.Mutex
+	prev      NTPStats
+	lastPrune time.Time
+}
+
+func newEventDetector(store *eventStore, retention time.Duration, ntsMaxAttempts int) *eventDetector {
+	d := &eventDetector{store: store, retention: retention, ntsMaxAttempts: ntsMaxAttempts}
+	if prev, ok := store.loadLastSnapshot(); ok {
+		d.prev = prev
+	}
+	return d
+}
+
+// Observe is registered as a collector observer. Failed collections are
+// skipped so the next good snapshot is compared with the last good one.
+func (d *eventDetector) Observe(stats NTPStats, at time.Time) {
+	if stats.Err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := diffSnapshots(d.prev, stats, at, d.ntsMaxAttempts)
+	d.prev = stats
+	for _, e := range events {
+		level := slog.LevelInfo
+		if e.Severity != "info" {
+			level = slog.LevelWarn
+		}
+		slog.Log(context.Background(), level, e.Message, "component", "events",
+			"kind", e.Kind, "severity", e.Severity, "source", e.Source)
+	}
+	if err := d.store.Append(events); err != nil {
+		slog.Error("storing events failed", "component", "events", "error", err)
+	}
+	if err := d.store.saveLastSnapshot(stats); err != nil {
+		slog.Error("storing last snapshot failed", "component", "events", "error", err)
+	}
+	if at.Sub(d.lastPrune) > time.Hour {
+		d.lastPrune = at
+		if _, err := d.store.Prune(at.Add(-d.retention)); err != nil {
+			slog.Error("pruning events failed", "component", "events", "error", err)
+		}
+	}
+}
+
+// ChartEvent places an event on a chart. Position is the fraction of the
+// chart's time range, which the page maps onto the x axis; chart points are
+// spread evenly over the range so this lines up with the plotted data.
+type ChartEvent struct {
+	Position float64 `json:"position"`
+	Time     string  `json:"time"`
+	Kind     string  `json:"kind"`
+	Severity string  `json:"severity"`
+	Message  string  `json:"message"`
+}
+
+// chartEvents returns the stored events within a chart range, oldest first
+func chartEvents(store *eventStore, cr chartRange, now time.Time) []ChartEvent {
+	if store == nil {
+		return nil
+	}
+	start := now.Add(-cr.Duration)
+	events, err := store.Since(start, 500)
+	if err != nil {
+		slog.Error("reading events failed", "component", "events", "error", err)
+		return nil
+	}
+	out := make([]ChartEvent, 0, len(events))
+	for _, e := range events {
+		out = append(out, ChartEvent{
+			Position: float64(e.Time.Sub(start)) / float64(cr.Duration),
+			Time:     e.Time.Format(cr.TimeFmt),
+			Kind:     e.Kind,
+			Severity: e.Severity,
+			Message:  e.Message,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Position < out[j].Position })
+	return out
+}
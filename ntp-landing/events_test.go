@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func eventSnapshot(leap, selected string, reach map[string]string, nts ...NTSDetail) NTPStats {
+	stats := NTPStats{LeapStatus: leap, NTSDetails: nts}
+	for _, name := range []string{"a.example", "b.example", "c.example"} {
+		r, ok := reach[name]
+		if !ok {
+			continue
+		}
+		icon := "+"
+		if name == selected {
+			icon = "*"
+		}
+		stats.Sources = append(stats.Sources, NTPSource{Name: name, StatusIcon: icon, Reach: r})
+	}
+	return stats
+}
+
+func eventKinds(events []Event) []string {
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Kind+":"+e.Severity+":"+e.Source)
+	}
+	return kinds
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	all := map[string]string{"a.example": "377", "b.example": "377"}
+	base := eventSnapshot("Normal", "a.example", all, NTSDetail{Name: "a.example"})
+
+	if ev := diffSnapshots(NTPStats{}, base, at, 1); len(ev) != 0 {
+		t.Errorf("first snapshot produced %v", eventKinds(ev))
+	}
+	if ev := diffSnapshots(base, base, at, 1); len(ev) != 0 {
+		t.Errorf("unchanged snapshot produced %v", eventKinds(ev))
+	}
+	if ev := diffSnapshots(base, NTPStats{Err: errors.New("chronyc sources: timeout")}, at, 1); len(ev) != 0 {
+		t.Errorf("failed collection produced %v", eventKinds(ev))
+	}
+
+	for _, tc := range []struct {
+		name string
+		cur  NTPStats
+		want []string
+	}{
+		{"selection change", eventSnapshot("Normal", "b.example", all, NTSDetail{Name: "a.example"}),
+			[]string{"selected-source:warning:b.example"}},
+		{"lost sync", eventSnapshot("Not synchronised", "", all, NTSDetail{Name: "a.example"}),
+			[]string{"leap-status:critical:", "selected-source:critical:a.example"}},
+		{"leap pending", eventSnapshot("Insert second", "a.example", all, NTSDetail{Name: "a.example"}),
+			[]string{"leap-status:warning:"}},
+		{"reach lost and source added", eventSnapshot("Normal", "a.example",
+			map[string]string{"a.example": "377", "b.example": "0", "c.example": "1"}, NTSDetail{Name: "a.example"}),
+			[]string{"reach-lost:warning:b.example", "source-added:info:c.example"}},
+		{"source removed", eventSnapshot("Normal", "a.example", map[string]string{"a.example": "377"}, NTSDetail{Name: "a.example"}),
+			[]string{"source-removed:info:b.example"}},
+		{"nts failing", eventSnapshot("Normal", "a.example", all, NTSDetail{Name: "a.example", NAK: true}),
+			[]string{"nts-auth-failed:warning:a.example"}},
+		{"nts retry within limit", eventSnapshot("Normal", "a.example", all, NTSDetail{Name: "a.example", Attempts: 1}),
+			nil},
+		{"nts retries above limit", eventSnapshot("Normal", "a.example", all, NTSDetail{Name: "a.example", Attempts: 2}),
+			[]string{"nts-auth-failed:warning:a.example"}},
+	} {
+		got := eventKinds(diffSnapshots(base, tc.cur, at, 1))
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+				break
+			}
+		}
+	}
+
+	failing := eventSnapshot("Normal", "a.example", map[string]string{"a.example": "377", "b.example": "0"}, NTSDetail{Name: "a.example", Attempts: 3})
+	got := eventKinds(diffSnapshots(failing, base, at, 1))
+	if len(got) != 2 || got[0] != "reach-restored:info:b.example" || got[1] != "nts-auth-restored:info:a.example" {
+		t.Errorf("recovery: %v", got)
+	}
+}
+
+func TestEventStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	store, err := openEventStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	d := newEventDetector(store, 24*time.Hour, 1)
+
+	all := map[string]string{"a.example": "377", "b.example": "377"}
+	d.Observe(eventSnapshot("Normal", "a.example", all), now.Add(-48*time.Hour))
+	d.Observe(eventSnapshot("Normal", "b.example", all), now.Add(-47*time.Hour))
+	d.Observe(eventSnapshot("Normal", "a.example", all), now.Add(-time.Hour))
+	d.Observe(NTPStats{Err: errors.New("chronyc tracking: timeout")}, now.Add(-30*time.Minute))
+
+	// The last observation pruned the event from 47 hours ago
+	list, err := store.Since(time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Source != "a.example" || list[0].ID != 2 {
+		t.Fatalf("events = %+v", list)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening keeps the events and the last good snapshot, so a change
+	// while the service was down is still detected.
+	store, err = openEventStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	d = newEventDetector(store, 24*time.Hour, 1)
+	d.Observe(eventSnapshot("Normal", "b.example", all), now)
+
+	list, err = store.Since(now.Add(-2*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != 3 || list[0].Source != "b.example" {
+		t.Fatalf("events after restart = %+v", list)
+	}
+	if list, _ := store.Since(now.Add(-2*time.Hour), 1); len(list) != 1 {
+		t.Errorf("limit ignored: %d events", len(list))
+	}
+
+	ce := chartEvents(store, chartRange{Duration: 2 * time.Hour, TimeFmt: "15:04"}, now)
+	if len(ce) != 2 || ce[0].Position != 0.5 || ce[1].Position != 1 {
+		t.Errorf("chart events = %+v", ce)
+	}
+}
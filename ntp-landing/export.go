@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// exportFormats maps the format parameter of /api/v1/export to its
+// content type and file extension
+var exportFormats = map[string][2]string{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+}
+
+// chartSeriesUnits lists the exported chart series in column order with
+// their units; offsets and errors are in microseconds like on the charts
+var chartSeriesUnits = [][2]string{
+	{"offset", "us"},
+	{"freq", "ppm"},
+	{"maxErr", "us"},
+	{"estErr", "us"},
+	{"pll", ""},
+	{"skew", "ppm"},
+}
+
+// exportFlushRows is how many rows are written between flushes, so large
+// ranges reach the client while they are still being read
+const exportFlushRows = 500
+
+// SeriesRow is one sample of /api/v1/export?data=charts or data=sources.
+// Source is only set for per-source series.
+type SeriesRow struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source,omitempty"`
+	Series string    `json:"series"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit"`
+}
+
+// exportWriter writes rows as CSV or NDJSON and flushes every
+// exportFlushRows of them
+type exportWriter struct {
+	csv   *csv.Writer
+	json  *json.Encoder
+	flush func() error
+	rows  int
+}
+
+func newExportWriter(w io.Writer, format string, header []string, flush func() error) *exportWriter {
+	x := &exportWriter{flush: flush}
+	if format == "csv" {
+		x.csv = csv.NewWriter(w)
+		x.csv.Write(header)
+	} else {
+		x.json = json.NewEncoder(w)
+	}
+	return x
+}
+
+// Write writes v as a JSON line or record as a CSV line
+func (x *exportWriter) Write(v any, record []string) error {
+	var err error
+	if x.csv != nil {
+		err = x.csv.Write(record)
+	} else {
+		err = x.json.Encode(v)
+	}
+	if err != nil {
+		return err
+	}
+	x.rows++
+	if x.rows%exportFlushRows == 0 {
+		return x.Flush()
+	}
+	return nil
+}
+
+func (x *exportWriter) Flush() error {
+	if x.csv != nil {
+		x.csv.Flush()
+		if err := x.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if x.flush != nil {
+		if err := x.flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSeries writes one SeriesRow per sample
+func (x *exportWriter) WriteSeries(source, name, unit string, samples []timedValue) error {
+	for _, s := range samples {
+		if err := x.WriteSample(source, name, unit, s.t, s.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSample writes a SeriesRow, skipping NaN and infinite values which
+// have no JSON encoding
+func (x *exportWriter) WriteSample(source, name, unit string, t time.Time, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	row := SeriesRow{Time: t.UTC(), Source: source, Series: name, Value: v, Unit: unit}
+	return x.Write(row, []string{formatExportTime(t), source, name, strconv.FormatFloat(v, 'g', -1, 64), unit})
+}
+
+// formatExportTime keeps every digit of the sample time
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// fetchPromSamples runs the chart queries for a range without decimation
+func fetchPromSamples(ctx context.Context, cr chartRange, now time.Time) chartSeries {
+	start := strconv.FormatInt(now.Add(-cr.Duration).Unix(), 10)
+	end := strconv.FormatInt(now.Unix(), 10)
+	step := strconv.Itoa(int(cr.Step.Seconds()))
+
+	series := chartSeries{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, query := range promChartQueries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := fetchPromRange(ctx, query, start, end, step)
+			if err != nil {
+				slog.Debug("prometheus export query failed", "component", "export", "series", name, "error", err)
+				return
+			}
+			mu.Lock()
+			series[name] = values
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return series
+}
+
+// chartSamples is loadCharts without the bucketing: every sample of the
+// chart series from the first backend that has data for the range
+func chartSamples(ctx context.Context, cfg Config, timex *timexSampler, cr chartRange, now time.Time) (string, chartSeries) {
+	if series := fetchPromSamples(ctx, cr, now); len(series["offset"]) > 0 || len(series["freq"]) > 0 {
+		return "prometheus", series
+	}
+	since := now.Add(-cr.Duration)
+	if cr.Duration <= cfg.TimexWindow {
+		if series := timex.samples(since); len(series["offset"]) > 0 {
+			return "adjtimex", series
+		}
+	}
+	return "chrony-logs", chronyLogReader{dir: cfg.ChronyLogDir}.trackingSamples(since)
+}
+
+// exportSources streams chrony's per-source statistics.log estimates, then
+// its measurements.log samples, each oldest first and in chrony's units
+func exportSources(x *exportWriter, logs chronyLogReader, since time.Time) error {
+	type field struct {
+		name, unit string
+		v          float64
+	}
+	for _, rec := range logs.statistics(since) {
+		for _, f := range []field{
+			{"estOffset", "s", rec.EstOffset},
+			{"stdDev", "s", rec.StdDev},
+			{"offsetSD", "s", rec.OffsetSD},
+			{"diffFreq", "ppm", rec.DiffFreq},
+			{"estSkew", "ppm", rec.EstSkew},
+		} {
+			if err := x.WriteSample(rec.Source, f.name, f.unit, rec.Time, f.v); err != nil {
+				return err
+			}
+		}
+	}
+	for _, rec := range logs.measurements(since) {
+		for _, f := range []field{{"measured", "s", rec.Offset}, {"delay", "s", rec.Delay}} {
+			if err := x.WriteSample(rec.Source, f.name, f.unit, rec.Time, f.v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exportEvents streams the stored events of the range, oldest first
+func exportEvents(x *exportWriter, events *eventStore, since time.Time) error {
+	list, err := events.Since(since, 0)
+	if err != nil {
+		return err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		e := list[i]
+		e.Time = e.Time.UTC()
+		record := []string{formatExportTime(e.Time), strconv.FormatUint(e.ID, 10), e.Kind, e.Severity, e.Source, e.Message}
+		if err := x.Write(e, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleExport serves /api/v1/export: the raw data behind the charts for
+// one of the chart ranges, as CSV or NDJSON.
+//
+//	data=charts   chart series from the backend the charts use
+//	data=sources  per-source statistics and measurements from chrony's logs
+//	data=events   the event log
+func handleExport(cfg Config, timex *timexSampler, events *eventStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		rangeName := q.Get("range")
+		if rangeName == "" {
+			rangeName = "24h"
+		}
+		if !slices.Contains(chartRangeNames, rangeName) {
+			writeAPIError(w, http.StatusBadRequest, "range: must be 1h, 6h, 24h, 7d or 30d")
+			return
+		}
+		format := q.Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		ft, ok := exportFormats[format]
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "format: must be csv or ndjson")
+			return
+		}
+		data := q.Get("data")
+		if data == "" {
+			data = "charts"
+		}
+		var header []string
+		switch data {
+		case "charts", "sources":
+			header = []string{"time", "source", "series", "value", "unit"}
+		case "events":
+			if events == nil {
+				writeAPIError(w, http.StatusServiceUnavailable, "event store unavailable")
+				return
+			}
+			header = []string{"time", "id", "kind", "severity", "source", "message"}
+		default:
+			writeAPIError(w, http.StatusBadRequest, "data: must be charts, sources or events")
+			return
+		}
+
+		cr := chartRangeFor(rangeName)
+		now := time.Now()
+		since := now.Add(-cr.Duration)
+		var series chartSeries
+		if data == "charts" {
+			// query before the headers go out so the backend can be named
+			var backend string
+			backend, series = chartSamples(r.Context(), cfg, timex, cr, now)
+			w.Header().Set("X-Chart-Backend", backend)
+		}
+
+		w.Header().Set("Content-Type", ft[0])
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ntp-%s-%s-%s.%s"`,
+			data, rangeName, now.UTC().Format("20060102T150405Z"), ft[1]))
+		w.Header().Set("Cache-Control", "no-store")
+		rc := http.NewResponseController(w)
+		x := newExportWriter(w, format, header, rc.Flush)
+
+		var err error
+		switch data {
+		case "charts":
+			for _, su := range chartSeriesUnits {
+				if err = x.WriteSeries("", su[0], su[1], series[su[0]]); err != nil {
+					break
+				}
+			}
+		case "sources":
+			err = exportSources(x, chronyLogReader{dir: cfg.ChronyLogDir}, since)
+		case "events":
+			err = exportEvents(x, events, since)
+		}
+		if err == nil {
+			err = x.Flush()
+		}
+		if err != nil {
+			// the status is already sent; the client sees a short file
+			slog.Warn("export aborted", "component", "export", "data", data, "rows", x.rows, "error", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportSourcesCSV(t *testing.T) {
+	var buf bytes.Buffer
+	x := newExportWriter(&buf, "csv", []string{"time", "source", "series", "value", "unit"}, nil)
+	if err := exportSources(x, chronyLogReader{dir: "testdata/chrony"}, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header, 2 statistics lines with 5 series, 2 measurements with 2
+	if len(rows) != 1+2*5+2*2 {
+		t.Fatalf("got %d rows: %v", len(rows), rows)
+	}
+	if got := strings.Join(rows[1], ","); got != "2026-01-01T00:00:16Z,162.159.200.1,estOffset,-2e-06,s" {
+		t.Errorf("first row %s", got)
+	}
+	if got := strings.Join(rows[11], ","); got != "2026-01-01T00:00:16Z,162.159.200.1,measured,-1.5e-06,s" {
+		t.Errorf("first measurement %s", got)
+	}
+}
+
+func TestExportSeriesNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	x := newExportWriter(&buf, "ndjson", nil, nil)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 123456789, time.FixedZone("CET", 3600))
+	samples := []timedValue{{at, 12.345678901234567}, {at.Add(time.Second), math.NaN()}}
+	if err := x.WriteSeries("", "offset", "us", samples); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("NaN not skipped: %q", lines)
+	}
+	if want := `{"time":"2025-12-31T23:00:00.123456789Z","series":"offset","value":12.345678901234567,"unit":"us"}`; lines[0] != want {
+		t.Errorf("got  %s\nwant %s", lines[0], want)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	store, err := openEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Now()
+	store.Append([]Event{
+		{Time: now.Add(-2 * time.Hour), Kind: "sync-lost", Severity: "critical", Message: "lost"},
+		{Time: now.Add(-time.Hour), Kind: "sync-regained", Severity: "info", Message: "back, \"finally\""},
+	})
+	h := handleExport(Config{}, nil, store)
+
+	for _, q := range []string{"range=2h", "format=xml", "data=logs"} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/api/v1/export?"+q, nil))
+		if rec.Code != 400 {
+			t.Errorf("%s: code %d", q, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handleExport(Config{}, nil, nil)(rec, httptest.NewRequest("GET", "/api/v1/export?data=events", nil))
+	if rec.Code != 503 {
+		t.Errorf("no event store: code %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/api/v1/export?data=events&range=6h&format=ndjson", nil))
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("code %d, type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="ntp-events-6h-`) || !strings.HasSuffix(cd, `.ndjson"`) {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+	var kinds []string
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	if strings.Join(kinds, ",") != "sync-lost,sync-regained" {
+		t.Errorf("events not oldest first: %v", kinds)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/api/v1/export?data=events&range=1h", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || strings.Join(rows[0], ",") != "time,id,kind,severity,source,message" {
+		t.Errorf("1h CSV: %v", rows)
+	}
+}
@@ -2,10 +2,18 @@ module ntp-landing
 
 go 1.25.6
 
-require github.com/playwright-community/playwright-go v0.5200.1
+require (
+	github.com/playwright-community/playwright-go v0.5200.1
+	go.etcd.io/bbolt v1.4.3
+)
 
 require (
 	github.com/deckarep/golang-set/v2 v2.7.0 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.4 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 )
+
+require landing v0.0.0-00010101000000-000000000000
+
+replace landing => ../landing
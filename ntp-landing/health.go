@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// HealthCheck is one criterion evaluated by /readyz or /status/ntp
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// HealthReport is the body of /readyz and /status/ntp. Status is "ok" when
+// every check passed and "fail" otherwise.
+type HealthReport struct {
+	Status      string        `json:"status"`
+	Checks      []HealthCheck `json:"checks"`
+	CollectedAt time.Time     `json:"collectedAt,omitempty"`
+}
+
+func newHealthReport(checks []HealthCheck, collected time.Time) HealthReport {
+	r := HealthReport{Status: "ok", Checks: checks, CollectedAt: collected}
+	for _, c := range checks {
+		if !c.OK {
+			r.Status = "fail"
+		}
+	}
+	return r
+}
+
+// freshnessCheck passes when the collector produced a snapshot within
+// maxAge. Zero updated means no snapshot was taken yet.
+func freshnessCheck(updated, now time.Time, maxAge time.Duration) HealthCheck {
+	c := HealthCheck{Name: "collector"}
+	if updated.IsZero() {
+		c.Detail = "no snapshot collected yet"
+		return c
+	}
+	age := now.Sub(updated).Truncate(time.Second)
+	c.OK = age <= maxAge
+	c.Detail = fmt.Sprintf("last snapshot %s ago (max %s)", age, maxAge)
+	return c
+}
+
+// readiness reports whether the collector is fresh enough to serve data
+func readiness(updated, now time.Time, maxAge time.Duration) HealthReport {
+	return newHealthReport([]HealthCheck{freshnessCheck(updated, now, maxAge)}, updated)
+}
+
+// ntpStatus evaluates the timekeeping criteria enabled in cfg.StatusChecks:
+// leap (leap status Normal), offset (|offset| at most StatusMaxOffset) and
+// sources (at least StatusMinSources reachable). A stale snapshot always
+// fails, since its values say nothing about the clock now.
+func ntpStatus(cfg Config, stats NTPStats, updated, now time.Time) HealthReport {
+	checks := []HealthCheck{freshnessCheck(updated, now, cfg.StatusMaxAge)}
+	for _, name := range cfg.StatusChecks {
+		c := HealthCheck{Name: name}
+		switch name {
+		case "leap":
+			c.OK = stats.LeapStatus == "Normal"
+			c.Detail = "leap status " + orUnknown(stats.LeapStatus)
+		case "offset":
+			limit := cfg.StatusMaxOffset.Seconds()
+			c.OK = stats.LeapStatus != "" && math.Abs(stats.Offset) <= limit
+			c.Detail = fmt.Sprintf("offset %s (max %s)", formatOffset(stats.Offset), formatOffset(limit))
+			if stats.LeapStatus == "" {
+				c.Detail = "no tracking data"
+			}
+		case "sources":
+			n := reachableSources(stats)
+			c.OK = n >= cfg.StatusMinSources
+			c.Detail = fmt.Sprintf("%d reachable sources (min %d)", n, cfg.StatusMinSources)
+		default:
+			continue
+		}
+		checks = append(checks, c)
+	}
+	return newHealthReport(checks, updated)
+}
+
+func reachableSources(stats NTPStats) int {
+	n := 0
+	for _, s := range stats.Sources {
+		if reachNonZero(s.Reach) {
+			n++
+		}
+	}
+	return n
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// writeHealth serves a report as JSON with 200 when it passed and 503
+// otherwise, so probers only need to look at the status code
+func writeHealth(w http.ResponseWriter, r *http.Request, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
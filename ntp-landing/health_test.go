@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func healthyStats() NTPStats {
+	return NTPStats{
+		LeapStatus: "Normal",
+		Offset:     -0.000012,
+		Sources: []NTPSource{
+			{Name: "a.example", Reach: "377"},
+			{Name: "b.example", Reach: "17"},
+			{Name: "c.example", Reach: "0"},
+		},
+	}
+}
+
+func TestNTPStatus(t *testing.T) {
+	cfg := Config{
+		StatusChecks:     []string{"leap", "offset", "sources"},
+		StatusMaxOffset:  100 * time.Millisecond,
+		StatusMinSources: 2,
+		StatusMaxAge:     90 * time.Second,
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	fresh := now.Add(-30 * time.Second)
+
+	failing := func(r HealthReport) []string {
+		var out []string
+		for _, c := range r.Checks {
+			if !c.OK {
+				out = append(out, c.Name)
+			}
+		}
+		return out
+	}
+
+	if r := ntpStatus(cfg, healthyStats(), fresh, now); r.Status != "ok" || len(r.Checks) != 4 {
+		t.Errorf("healthy = %+v", r)
+	}
+
+	unsynced := healthyStats()
+	unsynced.LeapStatus = "Not synchronised"
+	unsynced.Offset = 0.25
+	unsynced.Sources[1].Reach = "0"
+	r := ntpStatus(cfg, unsynced, fresh, now)
+	if got := failing(r); r.Status != "fail" || len(got) != 3 || got[0] != "leap" || got[1] != "offset" || got[2] != "sources" {
+		t.Errorf("unsynced failing = %v (%+v)", got, r)
+	}
+
+	if got := failing(ntpStatus(cfg, healthyStats(), now.Add(-5*time.Minute), now)); len(got) != 1 || got[0] != "collector" {
+		t.Errorf("stale failing = %v", got)
+	}
+	if got := failing(ntpStatus(cfg, NTPStats{}, time.Time{}, now)); len(got) != 4 {
+		t.Errorf("no snapshot failing = %v", got)
+	}
+
+	cfg.StatusChecks = []string{"offset", "bogus"}
+	if r := ntpStatus(cfg, unsynced, fresh, now); len(r.Checks) != 2 || r.Checks[1].Name != "offset" {
+		t.Errorf("restricted checks = %+v", r.Checks)
+	}
+}
+
+func TestWriteHealth(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		updated time.Time
+		code    int
+		status  string
+	}{
+		{now, http.StatusOK, "ok"},
+		{now.Add(-time.Hour), http.StatusServiceUnavailable, "fail"},
+	} {
+		rec := httptest.NewRecorder()
+		writeHealth(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil), readiness(tc.updated, now, time.Minute))
+		var body HealthReport
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != tc.code || body.Status != tc.status || rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("updated %v: code %d body %+v", tc.updated, rec.Code, body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	writeHealth(rec, httptest.NewRequest(http.MethodHead, "/readyz", nil), readiness(time.Time{}, now, time.Minute))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.Len() != 0 {
+		t.Errorf("HEAD = %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+}
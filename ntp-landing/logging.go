@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"landing/logging"
+)
+
+// setupLogging installs the default slog logger from the NTP_LANDING_LOG_*,
+// _SYSLOG_* and _LOKI_* settings. The returned func flushes and closes the
+// sinks.
+func setupLogging(cfg Config) func() {
+	return logging.Setup(logging.Options{
+		App:            "ntp-landing",
+		Level:          cfg.LogLevel,
+		Format:         cfg.LogFormat,
+		SyslogAddr:     cfg.SyslogAddr,
+		SyslogFacility: cfg.SyslogFacility,
+		LokiURL:        cfg.LokiURL,
+		LokiTenant:     cfg.LokiTenant,
+	})
+}
+
+// probePaths are scraped or probed every few seconds and would drown the
+// log at info level
+var probePaths = map[string]bool{"/metrics": true, "/healthz": true, "/readyz": true, "/status/ntp": true}
+
+// logRequests logs every request with its outcome, probes at debug level
+func logRequests(next http.Handler) http.Handler {
+	return logging.Requests(probePaths, next)
+}
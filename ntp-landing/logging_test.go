@@ -0,0 +1,15 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+)
+
+// TestMain discards what the code under test logs, such as the admin audit
+// lines and event warnings, so it does not drown the test output. Tests
+// that check log lines install their own handler.
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	os.Exit(m.Run())
+}
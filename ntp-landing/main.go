@@ -2,30 +2,46 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
-	"embed"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"log/slog"
 	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"landing/listen"
+	"landing/loki"
+	"landing/metrics"
+	"landing/netinfo"
+	"landing/security"
+	"landing/textview"
 )
 
 //go:embed template.html
 var htmlTemplate string
 
-var _ embed.FS
+//go:embed config.html
+var configHTMLTemplate string
+
+//go:embed admin.html
+var adminHTMLTemplate string
 
 // SystemStats holds system resource information
 type SystemStats struct {
@@ -48,16 +64,20 @@ type SystemStats struct {
 type NTPSource struct {
 	StatusIcon string `json:"statusIcon"`
 	Name       string `json:"name"`
-	Stratum    string `json:"stratum"`
-	Poll       string `json:"poll"`
-	Reach      string `json:"reach"`
-	ReachBits  []string `json:"reachBits"`
-	LastRx     string `json:"lastRx"`
-	Offset     string `json:"offset"`
-	FreqSkew   string `json:"freqSkew"`
-	StdDev     string `json:"stdDev"`
-	NTS        bool   `json:"nts"`
-	Selected   bool   `json:"selected"`
+	// ConfiguredName is the chrony.conf host the source comes from (the
+	// pool's name for pool members), empty if chronyc -N did not answer
+	ConfiguredName string   `json:"configuredName,omitempty"`
+	Stratum        string   `json:"stratum"`
+	Poll           string   `json:"poll"`
+	Reach          string   `json:"reach"`
+	ReachBits      []string `json:"reachBits"`
+	LastRx         string   `json:"lastRx"`
+	Offset         string   `json:"offset"`
+	FreqSkew       string   `json:"freqSkew"`
+	StdDev         string   `json:"stdDev"`
+	EstOffset      string   `json:"estOffset"`
+	NTS            bool     `json:"nts"`
+	Selected       bool     `json:"selected"`
 }
 
 // NTSDetail represents NTS authentication details for a source
@@ -67,6 +87,8 @@ type NTSDetail struct {
 	LastAuth     string `json:"lastAuth"`
 	Cookies      string `json:"cookies"`
 	CookieLength string `json:"cookieLength"`
+	Attempts     int    `json:"attempts"`
+	NAK          bool   `json:"nak"`
 }
 
 // NTPStats holds all NTP-related statistics
@@ -90,7 +112,12 @@ type NTPStats struct {
 	OnlineSources int         `json:"onlineSources"`
 	Sources       []NTPSource `json:"sources"`
 	NTSDetails    []NTSDetail `json:"ntsDetails"`
+	LeapStatus    string      `json:"leapStatus"`
 	Synced        bool        `json:"synced"`
+
+	// Err is set when chronyc sources or tracking could not be read, so
+	// observers can tell a failed collection from an empty one
+	Err error `json:"-"`
 }
 
 // ChartPoint is a single data point for charts
@@ -101,25 +128,36 @@ type ChartPoint struct {
 
 // ChartDataSet holds chart data for all metric types
 type ChartDataSet struct {
-	Offset []ChartPoint `json:"offset"`
-	Freq   []ChartPoint `json:"freq"`
-	MaxErr []ChartPoint `json:"maxErr"`
-	EstErr []ChartPoint `json:"estErr"`
-	PLL    []ChartPoint `json:"pll"`
+	Offset  []ChartPoint            `json:"offset"`
+	Freq    []ChartPoint            `json:"freq"`
+	MaxErr  []ChartPoint            `json:"maxErr"`
+	EstErr  []ChartPoint            `json:"estErr"`
+	PLL     []ChartPoint            `json:"pll"`
+	Skew    []ChartPoint            `json:"skew,omitempty"`
+	Sources map[string]SourceSeries `json:"sources,omitempty"`
+	Backend string                  `json:"backend"`
+	Events  []ChartEvent            `json:"events,omitempty"`
 }
 
 // PageData is the top-level struct passed to the template
 type PageData struct {
-	NTP        NTPStats       `json:"ntp"`
-	System     SystemStats    `json:"system"`
-	Charts     ChartDataSet   `json:"charts"`
-	ChartsJSON template.JS    `json:"-"`
-	CPUJSON    template.JS    `json:"-"`
-	MemJSON    template.JS    `json:"-"`
-	UpdatedAt  string         `json:"updatedAt"`
+	NTP        NTPStats            `json:"ntp"`
+	System     SystemStats         `json:"system"`
+	Charts     ChartDataSet        `json:"charts"`
+	NTSHealth  []NTSHealth         `json:"ntsHealth"`
+	Timex      *TimexReading       `json:"timex,omitempty"`
+	Hardware   ClockHardware       `json:"hardware"`
+	Problems   []ProblemSource     `json:"problems"`
+	Events     []Event             `json:"events"`
+	Network    netinfo.NetworkInfo `json:"network"`
+	Logs       bool                `json:"-"`
+	ChartsJSON template.JS         `json:"-"`
+	CPUJSON    template.JS         `json:"-"`
+	MemJSON    template.JS         `json:"-"`
+	UpdatedAt  string              `json:"updatedAt"`
 }
 
-func getSystemStats() SystemStats {
+func getSystemStats(ctx context.Context) SystemStats {
 	var stats SystemStats
 
 	hostname, err := os.Hostname()
@@ -186,12 +224,12 @@ func getSystemStats() SystemStats {
 		stats.MemTotal = memTotal * 1024
 		stats.MemUsed = (memTotal - memAvail) * 1024
 		if memTotal > 0 {
-			stats.MemPercent = math.Round(float64(memTotal-memAvail) / float64(memTotal) * 1000) / 10
+			stats.MemPercent = math.Round(float64(memTotal-memAvail)/float64(memTotal)*1000) / 10
 		}
 	}
 
 	// Disk usage
-	dfOut, err := exec.Command("df", "-h", "/").Output()
+	dfOut, err := exec.CommandContext(ctx, "df", "-h", "/").Output()
 	if err == nil {
 		lines := strings.Split(string(dfOut), "\n")
 		if len(lines) >= 2 {
@@ -227,7 +265,7 @@ func getSystemStats() SystemStats {
 	}
 
 	// Kernel
-	kernelOut, err := exec.Command("uname", "-r").Output()
+	kernelOut, err := exec.CommandContext(ctx, "uname", "-r").Output()
 	if err == nil {
 		stats.Kernel = strings.TrimSpace(string(kernelOut))
 	}
@@ -248,9 +286,9 @@ func reachToBits(reach string) []string {
 	return result
 }
 
-func getNTSMap() map[string]bool {
+func getNTSMap(ctx context.Context) map[string]bool {
 	ntsMap := make(map[string]bool)
-	out, err := exec.Command("chronyc", "authdata").Output()
+	out, err := chronycOutput(ctx, "authdata")
 	if err != nil {
 		return ntsMap
 	}
@@ -264,13 +302,19 @@ func getNTSMap() map[string]bool {
 	return ntsMap
 }
 
-func getNTSDetails() []NTSDetail {
-	var details []NTSDetail
-	out, err := exec.Command("chronyc", "authdata").Output()
+func getNTSDetails(ctx context.Context) []NTSDetail {
+	out, err := chronycOutput(ctx, "authdata")
 	if err != nil {
-		return details
+		return nil
 	}
-	lines := strings.Split(string(out), "\n")
+	return parseNTSDetails(string(out))
+}
+
+// parseNTSDetails reads the NTS rows of chronyc authdata:
+// Name Mode KeyID Type KLen Last Atmp NAK Cook CLen
+func parseNTSDetails(out string) []NTSDetail {
+	var details []NTSDetail
+	lines := strings.Split(out, "\n")
 	for _, line := range lines {
 		fields := strings.Fields(line)
 		if len(fields) >= 6 && fields[1] == "NTS" {
@@ -281,6 +325,12 @@ func getNTSDetails() []NTSDetail {
 				Cookies:      "",
 				CookieLength: "",
 			}
+			if len(fields) >= 7 {
+				detail.Attempts, _ = strconv.Atoi(fields[6])
+			}
+			if len(fields) >= 8 {
+				detail.NAK = fields[7] != "0" && fields[7] != "N"
+			}
 			if len(fields) >= 9 {
 				detail.Cookies = fields[8]
 			}
@@ -293,9 +343,11 @@ func getNTSDetails() []NTSDetail {
 	return details
 }
 
-func getSourceStats() map[string][2]string {
-	result := make(map[string][2]string)
-	out, err := exec.Command("chronyc", "sourcestats").Output()
+// getSourceStats maps each source to its sourcestats freq skew, std dev and
+// estimated offset
+func getSourceStats(ctx context.Context) map[string][3]string {
+	result := make(map[string][3]string)
+	out, err := chronycOutput(ctx, "sourcestats")
 	if err != nil {
 		return result
 	}
@@ -309,40 +361,72 @@ func getSourceStats() map[string][2]string {
 		if len(fields) >= 8 {
 			name := fields[0]
 			freqSkew := fields[5]
+			offset := fields[6]
 			stdDev := fields[7]
-			result[name] = [2]string{freqSkew, stdDev}
+			result[name] = [3]string{freqSkew, stdDev, offset}
 		}
 	}
 	return result
 }
 
-func getNTPStats() NTPStats {
+// parseSourceLine splits a row of chronyc sources into its state
+// character and the columns after the mode/state pair
+func parseSourceLine(line string) (state string, fields []string, ok bool) {
+	line = strings.TrimSpace(line)
+	if len(line) < 3 || strings.HasPrefix(line, "=") || strings.HasPrefix(line, "MS") || strings.HasPrefix(line, "210") {
+		return "", nil, false
+	}
+	fields = strings.Fields(line[2:])
+	if len(fields) < 7 {
+		return "", nil, false
+	}
+	return string(line[1]), fields, true
+}
+
+// configuredSourceNames returns, for each of the sources, the name it was
+// configured with. Plain chronyc sources shows reverse DNS names, which
+// need not be the hostnames in chrony.conf; with -N chronyc prints the
+// configured names, and pool members the name of their pool. It returns
+// nil when the two listings do not line up, e.g. a source came or went
+// between the calls.
+func configuredSourceNames(ctx context.Context, sources []NTPSource) []string {
+	out, err := chronycOutput(ctx, "-N", "sources")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		_, fields, ok := parseSourceLine(line)
+		if !ok {
+			continue
+		}
+		if len(names) >= len(sources) || fields[1] != sources[len(names)].Stratum || fields[2] != sources[len(names)].Poll {
+			return nil
+		}
+		names = append(names, fields[0])
+	}
+	if len(names) != len(sources) {
+		return nil
+	}
+	return names
+}
+
+func getNTPStats(ctx context.Context) NTPStats {
 	var stats NTPStats
-	ntsMap := getNTSMap()
-	ntsDetails := getNTSDetails()
-	sourceStatsMap := getSourceStats()
+	ntsMap := getNTSMap(ctx)
+	ntsDetails := getNTSDetails(ctx)
+	sourceStatsMap := getSourceStats(ctx)
 
 	stats.NTSDetails = ntsDetails
 
 	// Parse chronyc sources
-	out, err := exec.Command("chronyc", "sources").Output()
-	if err == nil {
-		lines := strings.Split(string(out), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "=") || strings.HasPrefix(line, "MS") || strings.HasPrefix(line, "210") {
-				continue
-			}
-			if len(line) < 3 {
-				continue
-			}
-			modeChar := string(line[0])
-			stateChar := string(line[1])
-			_ = modeChar
-
-			rest := strings.TrimSpace(line[2:])
-			fields := strings.Fields(rest)
-			if len(fields) < 7 {
+	out, err := chronycOutput(ctx, "sources")
+	if err != nil {
+		stats.Err = fmt.Errorf("chronyc sources: %w", err)
+	} else {
+		for _, line := range strings.Split(string(out), "\n") {
+			stateChar, fields, ok := parseSourceLine(line)
+			if !ok {
 				continue
 			}
 
@@ -381,6 +465,7 @@ func getNTPStats() NTPStats {
 			if ss, ok := sourceStatsMap[name]; ok {
 				source.FreqSkew = ss[0]
 				source.StdDev = ss[1]
+				source.EstOffset = ss[2]
 			}
 
 			stats.Sources = append(stats.Sources, source)
@@ -391,8 +476,14 @@ func getNTPStats() NTPStats {
 		}
 	}
 
+	if names := configuredSourceNames(ctx, stats.Sources); names != nil {
+		for i := range stats.Sources {
+			stats.Sources[i].ConfiguredName = names[i]
+		}
+	}
+
 	// Parse chronyc activity
-	actOut, err := exec.Command("chronyc", "activity").Output()
+	actOut, err := chronycOutput(ctx, "activity")
 	if err == nil {
 		lines := strings.Split(string(actOut), "\n")
 		for _, line := range lines {
@@ -408,8 +499,10 @@ func getNTPStats() NTPStats {
 	}
 
 	// Parse chronyc tracking
-	trackOut, err := exec.Command("chronyc", "tracking").Output()
-	if err == nil {
+	trackOut, err := chronycOutput(ctx, "tracking")
+	if err != nil {
+		stats.Err = errors.Join(stats.Err, fmt.Errorf("chronyc tracking: %w", err))
+	} else {
 		lines := strings.Split(string(trackOut), "\n")
 		for _, line := range lines {
 			parts := strings.SplitN(line, ":", 2)
@@ -461,20 +554,13 @@ func getNTPStats() NTPStats {
 			case "Update interval":
 				stats.UpdateInt = val
 			case "Leap status":
+				stats.LeapStatus = val
 				stats.Synced = val == "Normal"
 			}
 		}
 	}
 
-	// Format offset display
-	absOffset := math.Abs(stats.Offset)
-	if absOffset < 1e-6 {
-		stats.OffsetDisplay = fmt.Sprintf("%.1f ns", stats.Offset*1e9)
-	} else if absOffset < 1e-3 {
-		stats.OffsetDisplay = fmt.Sprintf("%.1f us", stats.Offset*1e6)
-	} else {
-		stats.OffsetDisplay = fmt.Sprintf("%.3f ms", stats.Offset*1e3)
-	}
+	stats.OffsetDisplay = formatOffset(stats.Offset)
 
 	// Format chrony tracking values for display
 	stats.RootDelay = formatSecondsStr(stats.RootDelay)
@@ -516,12 +602,21 @@ func formatSecondsStr(val string) string {
 		return fmt.Sprintf("%s%.1f min%s", sign, abs/60, rest)
 	} else if abs >= 1 {
 		return fmt.Sprintf("%s%.1f s%s", sign, abs, rest)
-	} else if abs >= 0.001 {
-		return fmt.Sprintf("%s%.2f ms%s", sign, abs*1000, rest)
-	} else if abs >= 0.000001 {
-		return fmt.Sprintf("%s%.1f us%s", sign, abs*1e6, rest)
 	}
-	return fmt.Sprintf("%s%.1f ns%s", sign, abs*1e9, rest)
+	return sign + formatOffset(abs) + rest
+}
+
+// formatOffset renders an offset in seconds with a unit suited to its
+// size. Every sub-second value on the page goes through it, so the system
+// offset, the tracking values and the kernel readings read alike.
+func formatOffset(secs float64) string {
+	abs := math.Abs(secs)
+	if abs < 1e-6 {
+		return fmt.Sprintf("%.1f ns", secs*1e9)
+	} else if abs < 1e-3 {
+		return fmt.Sprintf("%.1f us", secs*1e6)
+	}
+	return fmt.Sprintf("%.2f ms", secs*1e3)
 }
 
 // formatFreqStr formats "0.066 ppm" or "2.060 ppm" to fewer decimals
@@ -538,7 +633,42 @@ func formatFreqStr(val string) string {
 	return fmt.Sprintf("%.2f ppm", f)
 }
 
-func fetchPromRangeWithFormat(query, start, end, step, timeFmt string) []ChartPoint {
+func fetchPromRangeWithFormat(ctx context.Context, query, start, end, step, timeFmt string) []ChartPoint {
+	values, err := fetchPromRange(ctx, query, start, end, step)
+	if err != nil {
+		return nil
+	}
+
+	maxPoints := 200
+	skipEvery := 1
+	if len(values) > maxPoints {
+		skipEvery = len(values) / maxPoints
+	}
+
+	var points []ChartPoint
+	for i, v := range values {
+		if skipEvery > 1 && i%skipEvery != 0 && i != len(values)-1 {
+			continue
+		}
+		points = append(points, ChartPoint{
+			Time:  v.t.Format(timeFmt),
+			Value: v.v,
+		})
+	}
+	return points
+}
+
+// promRanges caches and coalesces the query_range calls of all pages
+var promRanges = newPromCache(queryPromRange)
+
+// fetchPromRange runs a query_range through promRanges and returns every
+// sample of the first series, without decimation.
+func fetchPromRange(ctx context.Context, query, start, end, step string) ([]timedValue, error) {
+	return promRanges.Get(ctx, query, start, end, step)
+}
+
+// queryPromRange asks Prometheus directly
+func queryPromRange(ctx context.Context, query, start, end, step string) ([]timedValue, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 		Transport: &http.Transport{
@@ -548,25 +678,26 @@ func fetchPromRangeWithFormat(query, start, end, step, timeFmt string) []ChartPo
 	promURL := fmt.Sprintf("https://prometheus.sentinella.alpina/api/v1/query_range?query=%s&start=%s&end=%s&step=%s",
 		url.QueryEscape(query), start, end, step)
 
-	req, err := http.NewRequest("GET", promURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", promURL, nil)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	req.SetBasicAuth("admin", "vURLumGa0GMu4/nR2+vejcenAQBqt1un")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	var promResp struct {
 		Status string `json:"status"`
+		Error  string `json:"error"`
 		Data   struct {
 			Result []struct {
 				Values [][]interface{} `json:"values"`
@@ -575,25 +706,18 @@ func fetchPromRangeWithFormat(query, start, end, step, timeFmt string) []ChartPo
 	}
 
 	if err := json.Unmarshal(body, &promResp); err != nil {
-		return nil
+		return nil, fmt.Errorf("prometheus: %s: %w", resp.Status, err)
 	}
 
-	if promResp.Status != "success" || len(promResp.Data.Result) == 0 {
-		return nil
+	if promResp.Status != "success" {
+		return nil, fmt.Errorf("prometheus: %s", promResp.Error)
 	}
-
-	values := promResp.Data.Result[0].Values
-	maxPoints := 200
-	skipEvery := 1
-	if len(values) > maxPoints {
-		skipEvery = len(values) / maxPoints
+	if len(promResp.Data.Result) == 0 {
+		return nil, nil
 	}
 
-	var points []ChartPoint
-	for i, v := range values {
-		if skipEvery > 1 && i%skipEvery != 0 && i != len(values)-1 {
-			continue
-		}
+	var values []timedValue
+	for _, v := range promResp.Data.Result[0].Values {
 		if len(v) < 2 {
 			continue
 		}
@@ -609,51 +733,80 @@ func fetchPromRangeWithFormat(query, start, end, step, timeFmt string) []ChartPo
 		if err != nil {
 			continue
 		}
-		t := time.Unix(int64(ts), 0)
-		points = append(points, ChartPoint{
-			Time:  t.Format(timeFmt),
-			Value: val,
-		})
+		sec, frac := math.Modf(ts)
+		values = append(values, timedValue{t: time.Unix(int64(sec), int64(math.Round(frac*1e3))*1e6), v: val})
 	}
-	return points
+	return values, nil
 }
 
-func fetchChartSetFull(rangeName string) ChartDataSet {
-	var ds ChartDataSet
-	now := time.Now()
+// chartRange describes one of the chart tabs: how far back it looks, the
+// sampling step and how its x-axis labels are formatted
+type chartRange struct {
+	Duration time.Duration
+	Step     time.Duration
+	TimeFmt  string
+}
 
-	var duration time.Duration
-	var step string
-	var timeFmt string
+// chartRangeNames are the chart tabs, shortest first
+var chartRangeNames = []string{"1h", "6h", "24h", "7d", "30d"}
 
+func chartRangeFor(rangeName string) chartRange {
 	switch rangeName {
 	case "1h":
-		duration = 1 * time.Hour
-		step = "30"
-		timeFmt = "15:04:05"
+		return chartRange{1 * time.Hour, 30 * time.Second, "15:04:05"}
 	case "6h":
-		duration = 6 * time.Hour
-		step = "120"
-		timeFmt = "15:04"
-	case "24h":
-		duration = 24 * time.Hour
-		step = "300"
-		timeFmt = "15:04"
+		return chartRange{6 * time.Hour, 120 * time.Second, "15:04"}
 	case "7d":
-		duration = 7 * 24 * time.Hour
-		step = "1800"
-		timeFmt = "Mon 15h"
+		return chartRange{7 * 24 * time.Hour, 1800 * time.Second, "Mon 15h"}
 	case "30d":
-		duration = 30 * 24 * time.Hour
-		step = "7200"
-		timeFmt = "Jan 2"
-	default:
-		duration = 24 * time.Hour
-		step = "300"
-		timeFmt = "15:04"
+		return chartRange{30 * 24 * time.Hour, 7200 * time.Second, "Jan 2"}
+	}
+	return chartRange{24 * time.Hour, 300 * time.Second, "15:04"}
+}
+
+// loadCharts returns the chart set for a range from Prometheus. When
+// Prometheus has nothing to offer it falls back to the in-memory adjtimex
+// history for ranges it covers, then to chrony's own logs.
+func loadCharts(ctx context.Context, cfg Config, timex *timexSampler, rangeName string) ChartDataSet {
+	ds := fetchChartSetFull(ctx, rangeName)
+	if len(ds.Offset) > 0 || len(ds.Freq) > 0 {
+		ds.Backend = "prometheus"
+		return ds
+	}
+	cr := chartRangeFor(rangeName)
+	now := time.Now()
+	if cr.Duration <= cfg.TimexWindow {
+		ds = timex.chartSet(cr, now)
+		if len(ds.Offset) > 0 {
+			ds.Backend = "adjtimex"
+			return ds
+		}
 	}
+	logs := chronyLogReader{dir: cfg.ChronyLogDir}
+	ds = logs.chartSet(cr, now)
+	ds.Backend = "chrony-logs"
+	return ds
+}
+
+// promChartQueries are the Prometheus queries behind the chart series,
+// keyed by their ChartDataSet JSON names
+var promChartQueries = map[string]string{
+	"offset": `node_timex_offset_seconds{instance="ntp.alpina:9100"} * 1e6`,
+	"freq":   `(node_timex_frequency_adjustment_ratio{instance="ntp.alpina:9100"} - 1) * 1e6`,
+	"maxErr": `node_timex_maxerror_seconds{instance="ntp.alpina:9100"} * 1e6`,
+	"estErr": `node_timex_estimated_error_seconds{instance="ntp.alpina:9100"} * 1e6`,
+	"pll":    `node_timex_loop_time_constant{instance="ntp.alpina:9100"}`,
+}
+
+func fetchChartSetFull(ctx context.Context, rangeName string) ChartDataSet {
+	var ds ChartDataSet
+	now := time.Now()
+
+	cr := chartRangeFor(rangeName)
+	step := fmt.Sprintf("%d", int(cr.Step.Seconds()))
+	timeFmt := cr.TimeFmt
 
-	startStr := fmt.Sprintf("%d", now.Add(-duration).Unix())
+	startStr := fmt.Sprintf("%d", now.Add(-cr.Duration).Unix())
 	endStr := fmt.Sprintf("%d", now.Unix())
 
 	type result struct {
@@ -664,20 +817,11 @@ func fetchChartSetFull(rangeName string) ChartDataSet {
 	var wg sync.WaitGroup
 	ch := make(chan result, 5)
 
-	inst := "ntp.alpina:9100"
-	queries := map[string]string{
-		"offset": fmt.Sprintf("node_timex_offset_seconds{instance=\"%s\"} * 1e6", inst),
-		"freq":   fmt.Sprintf("(node_timex_frequency_adjustment_ratio{instance=\"%s\"} - 1) * 1e6", inst),
-		"maxErr": fmt.Sprintf("node_timex_maxerror_seconds{instance=\"%s\"} * 1e6", inst),
-		"estErr": fmt.Sprintf("node_timex_estimated_error_seconds{instance=\"%s\"} * 1e6", inst),
-		"pll":    fmt.Sprintf("node_timex_loop_time_constant{instance=\"%s\"}", inst),
-	}
-
-	for name, query := range queries {
+	for name, query := range promChartQueries {
 		wg.Add(1)
 		go func(n, q string) {
 			defer wg.Done()
-			points := fetchPromRangeWithFormat(q, startStr, endStr, step, timeFmt)
+			points := fetchPromRangeWithFormat(ctx, q, startStr, endStr, step, timeFmt)
 			ch <- result{name: n, points: points}
 		}(name, query)
 	}
@@ -705,43 +849,199 @@ func fetchChartSetFull(rangeName string) ChartDataSet {
 	return ds
 }
 
-func fetchCPU30d() []ChartPoint {
+func fetchCPU30d(ctx context.Context) []ChartPoint {
 	now := time.Now()
 	start := fmt.Sprintf("%d", now.Add(-30*24*time.Hour).Unix())
 	end := fmt.Sprintf("%d", now.Unix())
-	return fetchPromRangeWithFormat(
+	return fetchPromRangeWithFormat(ctx,
 		"100-(avg(rate(node_cpu_seconds_total{instance=\"ntp.alpina:9100\",mode=\"idle\"}[5m]))*100)",
 		start, end, "7200", "Jan 2",
 	)
 }
 
-func fetchMem30d() []ChartPoint {
+func fetchMem30d(ctx context.Context) []ChartPoint {
 	now := time.Now()
 	start := fmt.Sprintf("%d", now.Add(-30*24*time.Hour).Unix())
 	end := fmt.Sprintf("%d", now.Unix())
-	return fetchPromRangeWithFormat(
+	return fetchPromRangeWithFormat(ctx,
 		"(1-node_memory_MemAvailable_bytes{instance=\"ntp.alpina:9100\"}/node_memory_MemTotal_bytes{instance=\"ntp.alpina:9100\"})*100",
 		start, end, "7200", "Jan 2",
 	)
 }
 
-func main() {
-	tmpl, err := template.New("page").Parse(htmlTemplate)
+// pageFuncs are the helpers available to template.html
+var pageFuncs = template.FuncMap{
+	"inc":   func(i int) int { return i + 1 },
+	"pct":   func(f float64) float64 { return f * 100 },
+	"asset": siteAssets.URL,
+}
+
+func parsePageTemplate() (*template.Template, error) {
+	return template.New("page").Funcs(pageFuncs).Parse(htmlTemplate)
+}
+
+func parseAdminTemplate() (*template.Template, error) {
+	return template.New("admin").Funcs(pageFuncs).Parse(adminHTMLTemplate)
+}
+
+func parseConfigTemplate() (*template.Template, error) {
+	return template.New("config").Funcs(pageFuncs).Parse(configHTMLTemplate)
+}
+
+// ConfigPageData is passed to config.html
+type ConfigPageData struct {
+	Hostname  string       `json:"-"`
+	Config    ChronyConfig `json:"config"`
+	Drift     ConfigDrift  `json:"drift"`
+	UpdatedAt string       `json:"updatedAt"`
+}
+
+// serve runs the landing page until SIGINT or SIGTERM
+func serve() {
+	cfg := loadConfig()
+	closeLogs := setupLogging(cfg)
+	defer closeLogs()
+
+	// ctx is cancelled on SIGINT/SIGTERM and stops the background loops;
+	// requests keep their own contexts so they can finish during shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := siteAssets.Verify(vendoredAssets); err != nil {
+		log.Fatalf("Vendored assets: %v", err)
+	}
+
+	tmpl, err := parsePageTemplate()
 	if err != nil {
 		log.Fatalf("Failed to parse template: %v", err)
 	}
 
+	configTmpl, err := parseConfigTemplate()
+	if err != nil {
+		log.Fatalf("Failed to parse config template: %v", err)
+	}
+
+	adminTmpl, err := parseAdminTemplate()
+	if err != nil {
+		log.Fatalf("Failed to parse admin template: %v", err)
+	}
+	auth, err := newAuthPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Auth: %v", err)
+	}
+
+	collector := newSnapshotCollector(cfg.CollectInterval)
+	ntsTracker := newNTSTracker(cfg)
+	collector.OnSnapshot(ntsTracker.Observe)
+	outliers := newOutlierDetector(cfg)
+	collector.OnSnapshot(outliers.Observe)
+	sightings := newSourceSightings()
+	collector.OnSnapshot(sightings.Observe)
+	var events *eventStore
+	if cfg.EventsDB != "" {
+		events, err = openEventStore(cfg.EventsDB)
+		if err != nil {
+			log.Printf("Event timeline disabled: %v", err)
+		} else {
+			collector.OnSnapshot(newEventDetector(events, cfg.EventsRetention, cfg.NTSMaxAttempts).Observe)
+		}
+	}
+	notifier := newNotifier(cfg, notifyTargets(cfg), ntsTracker.Health)
+	collector.OnSnapshot(notifier.Observe)
+	var mqtt *mqttPublisher
+	if cfg.MQTTBroker != "" {
+		hostname, _ := os.Hostname()
+		mqtt = newMQTTPublisher(cfg, hostname)
+		collector.OnSnapshot(mqtt.Observe)
+	}
+	collector.Collect(ctx)
+	collectorDone := make(chan struct{})
+	go func() {
+		collector.Run(ctx)
+		close(collectorDone)
+	}()
+
+	timex := newTimexSampler(cfg.TimexInterval, cfg.TimexWindow)
+	timex.Sample()
+	if err := timex.Err(); err != nil {
+		log.Printf("adjtimex unavailable: %v", err)
+	}
+	go timex.Run(ctx)
+
+	lokiBase := cfg.LokiQueryURL
+	if lokiBase == "" {
+		lokiBase = cfg.LokiURL
+	}
+	var lokiClient *loki.Querier
+	if lokiBase != "" {
+		lokiClient = loki.NewQuerier(lokiBase, cfg.LokiTenant, 10*time.Second)
+	}
+
+	var certs *listen.CertReloader
+	listening := cfg.ListenAddrs
+	if cfg.TLSCert != "" {
+		certs, err = listen.NewCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Fatalf("TLS: %v", err)
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go certs.Watch(ctx, cfg.TLSReloadInterval, hup)
+		listening = nil
+		for _, a := range cfg.ListenAddrs {
+			if cfg.HTTPMode == "redirect" {
+				a += " (redirect)"
+			}
+			listening = append(listening, a)
+		}
+		for _, a := range cfg.TLSListenAddrs {
+			listening = append(listening, a+" (https)")
+		}
+	}
+
+	dnsName := cfg.DNSName
+	if dnsName == "" {
+		dnsName, _ = os.Hostname()
+	} else if dnsName == "-" {
+		dnsName = ""
+	}
+	networkInfo := func(ctx context.Context) netinfo.NetworkInfo {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		return netinfo.Get(ctx, listening, dnsName)
+	}
+
+	http.Handle("/static/", siteAssets)
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
+		w.Header().Set("Vary", "Accept, User-Agent")
+		format := textview.Format(r)
+		if !textview.Formats[format] {
+			http.Error(w, "format must be html, ansi or text", http.StatusBadRequest)
+			return
+		}
 
-		ntpStats := getNTPStats()
-		sysStats := getSystemStats()
-		charts := fetchChartSetFull("24h")
-		cpuData := fetchCPU30d()
-		memData := fetchMem30d()
+		ntpStats := getNTPStats(r.Context())
+		sysStats := getSystemStats(r.Context())
+		if format != "html" {
+			// the terminal view has no charts, so skip the Prometheus queries
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeTextDashboard(w, PageData{
+				NTP:       ntpStats,
+				System:    sysStats,
+				Problems:  outliers.Problems(),
+				UpdatedAt: time.Now().Format("2006-01-02 15:04:05 MST"),
+			}, cfg.StatusMaxOffset, format == "ansi")
+			return
+		}
+		charts := loadCharts(r.Context(), cfg, timex, "24h")
+		charts.Events = chartEvents(events, chartRangeFor("24h"), time.Now())
+		cpuData := fetchCPU30d(r.Context())
+		memData := fetchMem30d(r.Context())
 
 		chartsJSON, _ := json.Marshal(charts)
 		cpuJSON, _ := json.Marshal(cpuData)
@@ -750,13 +1050,25 @@ func main() {
 		data := PageData{
 			NTP:        ntpStats,
 			System:     sysStats,
+			Hardware:   getClockHardware(r.Context()),
 			Charts:     charts,
+			NTSHealth:  ntsTracker.Health(),
+			Problems:   outliers.Problems(),
 			ChartsJSON: template.JS(chartsJSON),
 			CPUJSON:    template.JS(cpuJSON),
 			MemJSON:    template.JS(memJSON),
 			UpdatedAt:  time.Now().Format("2006-01-02 15:04:05 MST"),
 		}
 
+		if tx, ok := timex.Latest(); ok {
+			data.Timex = &tx
+		}
+		if events != nil {
+			data.Events, _ = events.Since(time.Now().Add(-7*24*time.Hour), 25)
+		}
+		data.Logs = lokiClient != nil
+		data.Network = networkInfo(r.Context())
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if err := tmpl.Execute(w, data); err != nil {
 			log.Printf("Template error: %v", err)
@@ -764,26 +1076,313 @@ func main() {
 		}
 	})
 
-	http.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
-		ntpStats := getNTPStats()
-		sysStats := getSystemStats()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ntp":    ntpStats,
-			"system": sysStats,
+	configPage := func() ConfigPageData {
+		conf := parseChronyConfig(findChronyConf(cfg.ChronyConf))
+		live, _ := collector.Latest()
+		hostname, _ := os.Hostname()
+		return ConfigPageData{
+			Hostname:  hostname,
+			Config:    conf,
+			Drift:     checkConfigDrift(conf, live.Sources, sightings.Seen()),
+			UpdatedAt: time.Now().Format("2006-01-02 15:04:05 MST"),
+		}
+	}
+
+	http.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := configTmpl.Execute(w, configPage()); err != nil {
+			log.Printf("Template error: %v", err)
+			http.Error(w, "Internal Server Error", 500)
+		}
+	})
+
+	handleAPI("config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, configPage())
+	})
+
+	http.HandleFunc(apiV1+"openapi.json", serveOpenAPI)
+
+	// whoami shows how the auth middleware sees the caller, to check a
+	// proxy or tailscale setup
+	http.HandleFunc(apiV1+"whoami", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := identityFrom(r.Context())
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, id)
+	})
+
+	if auth.AdminEnabled() {
+		admin := &adminServer{
+			auth:    auth,
+			csrf:    newCSRFTokens(time.Hour),
+			audit:   newAuditLog(cfg.AuditLog, 50),
+			run:     runChronyc,
+			timeout: cfg.AdminTimeout,
+			sources: func() []NTPSource {
+				stats, _ := collector.Latest()
+				return stats.Sources
+			},
+			page: func(w http.ResponseWriter, data AdminPageData) error {
+				return adminTmpl.Execute(w, data)
+			},
+		}
+		auth.denied = admin.recordDenied
+		http.HandleFunc("/admin", admin.handlePage)
+		http.HandleFunc("/api/admin/run", admin.handleRun)
+		http.HandleFunc("/api/admin/audit", admin.handleAudit)
+	} else {
+		log.Println("Admin page disabled: no admin users (NTP_LANDING_AUTH_ADMINS or NTP_LANDING_ADMIN_PASSWORD_SHA256)")
+	}
+
+	handleAPI("stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, StatsResponse{
+			NTP:      getNTPStats(r.Context()),
+			System:   getSystemStats(r.Context()),
+			Hardware: getClockHardware(r.Context()),
 		})
 	})
 
-	http.HandleFunc("/api/charts", func(w http.ResponseWriter, r *http.Request) {
+	handleAPI("charts", func(w http.ResponseWriter, r *http.Request) {
 		rangeName := r.URL.Query().Get("range")
 		if rangeName == "" {
 			rangeName = "24h"
 		}
-		charts := fetchChartSetFull(rangeName)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(charts)
+		cr := chartRangeFor(rangeName)
+		charts := loadCharts(r.Context(), cfg, timex, rangeName)
+		charts.Events = chartEvents(events, cr, time.Now())
+		writeCachedJSON(w, r, promCacheTTL(cr.Duration), charts)
+	})
+
+	handleAPI("export", handleExport(cfg, timex, events))
+
+	handleAPI("stability", func(w http.ResponseWriter, r *http.Request) {
+		rep := loadStability(r.Context(), cfg, r.URL.Query().Get("range"))
+		writeCachedJSON(w, r, promCacheTTL(stabilityRanges[rep.Range]), rep)
+	})
+
+	handleAPI("timex", func(w http.ResponseWriter, r *http.Request) {
+		tx, ok := timex.Latest()
+		if !ok {
+			msg := "no adjtimex reading"
+			if err := timex.Err(); err != nil {
+				msg = err.Error()
+			}
+			writeAPIError(w, http.StatusServiceUnavailable, msg)
+			return
+		}
+		writeJSON(w, http.StatusOK, tx)
 	})
 
-	log.Println("NTP Landing Page listening on :80")
-	log.Fatal(http.ListenAndServe(":80", nil))
+	handleAPI("events", func(w http.ResponseWriter, r *http.Request) {
+		if events == nil {
+			writeAPIError(w, http.StatusServiceUnavailable, "event store unavailable")
+			return
+		}
+		since := 24 * time.Hour
+		if v := r.URL.Query().Get("since"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "since: "+err.Error())
+				return
+			}
+			since = d
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		list, err := events.Since(time.Now().Add(-since), limit)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if list == nil {
+			list = []Event{}
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	handleAPI("logs", func(w http.ResponseWriter, r *http.Request) {
+		if lokiClient == nil {
+			writeAPIError(w, http.StatusServiceUnavailable, "loki not configured")
+			return
+		}
+		since := cfg.LogsWindow
+		if v := r.URL.Query().Get("since"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeAPIError(w, http.StatusBadRequest, "since: invalid duration")
+				return
+			}
+			since = d
+		}
+		limit := cfg.LogsLimit
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+		resp, err := lokiClient.Recent(r.Context(), cfg.LogsQuery, since, r.URL.Query().Get("level"), limit, time.Now())
+		status := http.StatusOK
+		if err != nil {
+			slog.Warn("loki query failed", "component", "logs", "error", err)
+			status = http.StatusBadGateway
+		}
+		writeJSON(w, status, resp)
+	})
+
+	handleAPI("network", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, networkInfo(r.Context()))
+	})
+
+	handleAPI("alerts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, notifier.States())
+	})
+
+	handleAPI("problems", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, outliers.Problems())
+	})
+
+	handleAPI("nts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ntsTracker.Health())
+	})
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, "ok\n")
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		_, updated := collector.Latest()
+		writeHealth(w, r, readiness(updated, time.Now(), cfg.StatusMaxAge))
+	})
+
+	http.HandleFunc("/status/ntp", func(w http.ResponseWriter, r *http.Request) {
+		stats, updated := collector.Latest()
+		writeHealth(w, r, ntpStatus(cfg, stats, updated, time.Now()))
+	})
+
+	selfMetrics.Snapshot(func() time.Time {
+		_, updated := collector.Latest()
+		return updated
+	})
+	serveMetrics := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw := metrics.NewWriter(w)
+		writeNTSMetrics(mw, cfg, ntsTracker.Health())
+		selfMetrics.Write(mw, time.Now())
+	}
+	metricsMux := http.DefaultServeMux
+	if len(cfg.MetricsListenAddrs) > 0 {
+		metricsMux = http.NewServeMux()
+	}
+	metricsMux.HandleFunc("/metrics", serveMetrics)
+
+	newServer := func(h http.Handler) *http.Server {
+		return &http.Server{
+			Handler:           logRequests(selfMetrics.Middleware(http.DefaultServeMux, security.Headers(cfg.FrameAncestors, h))),
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		}
+	}
+	srv := newServer(listen.HSTS(cfg.HSTSMaxAge, auth.Middleware(http.DefaultServeMux)))
+	servers := []*http.Server{srv}
+	plainSrv := srv
+
+	plain, err := listen.All(cfg.ListenAddrs)
+	if err != nil {
+		closeLogs()
+		log.Fatal(err)
+	}
+	var secure []net.Listener
+	if certs != nil {
+		secure, err = listen.All(cfg.TLSListenAddrs)
+		if err != nil {
+			closeLogs()
+			log.Fatal(err)
+		}
+		srv.TLSConfig = listen.TLSConfig(certs)
+		if cfg.HTTPMode == "redirect" {
+			port, err := listen.TLSPort(cfg.TLSListenAddrs)
+			if err != nil {
+				closeLogs()
+				log.Fatal(err)
+			}
+			plainSrv = newServer(listen.RedirectHTTPS(port, probePaths, http.DefaultServeMux))
+			servers = append(servers, plainSrv)
+		}
+	}
+
+	var metricsLns []net.Listener
+	if len(cfg.MetricsListenAddrs) > 0 {
+		metricsLns, err = listen.All(cfg.MetricsListenAddrs)
+		if err != nil {
+			closeLogs()
+			log.Fatal(err)
+		}
+	}
+
+	serveErr := make(chan error, len(plain)+len(secure)+len(metricsLns))
+	for _, ln := range plain {
+		slog.Info("NTP Landing Page listening", "addr", ln.Addr().String(), "tls", false, "redirect", plainSrv != srv)
+		go func(ln net.Listener) {
+			if err := plainSrv.Serve(ln); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}(ln)
+	}
+	for _, ln := range secure {
+		slog.Info("NTP Landing Page listening", "addr", ln.Addr().String(), "tls", true)
+		go func(ln net.Listener) {
+			if err := srv.ServeTLS(ln, "", ""); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}(ln)
+	}
+
+	if len(metricsLns) > 0 {
+		// scrapes are not page requests: no security headers, and they are
+		// not counted in the request metrics they report
+		metricsSrv := newServer(metricsMux)
+		metricsSrv.Handler = logRequests(metricsMux)
+		servers = append(servers, metricsSrv)
+		for _, ln := range metricsLns {
+			slog.Info("metrics listening", "addr", ln.Addr().String())
+			go func(ln net.Listener) {
+				if err := metricsSrv.Serve(ln); err != http.ErrServerClosed {
+					serveErr <- err
+				}
+			}(ln)
+		}
+	}
+
+	select {
+	case err := <-serveErr:
+		closeLogs()
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("graceful shutdown incomplete", "error", err)
+			}
+		}(s)
+	}
+	wg.Wait()
+	// observers write to the event store, so the collector has to be idle
+	// before it is closed
+	<-collectorDone
+	if events != nil {
+		events.Close()
+	}
+	if mqtt != nil {
+		mqtt.Close()
+	}
+	slog.Info("stopped")
 }
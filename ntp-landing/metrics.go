@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sort"
+
+	"landing/metrics"
+)
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeNTSMetrics exports the NTS tracker state together with the
+// thresholds it was judged against, so alert rules can reuse them.
+func writeNTSMetrics(m *metrics.Writer, cfg Config, health []NTSHealth) {
+	m.Gauge("ntp_landing_nts_stale_after_seconds", "Age of the last authenticated sample above which an NTS source is stale.", cfg.NTSStaleAfter.Seconds())
+	m.Gauge("ntp_landing_nts_min_cookies", "Cookie count at or below which an NTS source is flagged.", float64(cfg.NTSMinCookies))
+	m.Gauge("ntp_landing_nts_max_attempts", "NTS-KE attempts since last success above which an NTS source is failing.", float64(cfg.NTSMaxAttempts))
+
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_key_length_bits", "NTS key length.", float64(h.KeyLength), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_last_auth_age_seconds", "Age of the last authenticated sample, -1 if none.", h.LastAuthSecs, "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_ke_age_seconds", "Time since the last successful NTS-KE, -1 if none.", h.KEAgeSecs, "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_cookies", "NTS cookies currently held.", float64(h.Cookies), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_cookie_trend_per_hour", "Least-squares cookie count trend over the tracking window.", h.CookieTrend, "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_ke_attempts", "NTS-KE attempts since the last successful one.", float64(h.Attempts), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_nak", "Whether an NTS NAK was received since the last request.", boolMetric(h.NAK), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Counter("ntp_landing_nts_naks_total", "NTS NAKs observed since start.", float64(h.NAKCount), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Counter("ntp_landing_nts_ke_failures_total", "Failed NTS-KE attempts observed since start.", float64(h.FailedKE), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Counter("ntp_landing_nts_renegotiations_total", "NTS-KE renegotiations observed since start.", float64(h.Renegotiations), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_stale", "Whether the source's NTS authentication is stale.", boolMetric(h.Stale), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_failing", "Whether the source's NTS authentication is failing.", boolMetric(h.Failing), "source", h.Name)
+	}
+	for _, h := range health {
+		m.Gauge("ntp_landing_nts_low_cookies", "Whether the source is at or below the cookie threshold.", boolMetric(h.LowCookies), "source", h.Name)
+	}
+}
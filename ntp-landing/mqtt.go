@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"landing/mqtt"
+)
+
+// ntpHAEntities are the sensors registered for ntp-landing. Their values
+// come from the JSON state document built by ntpHAState.
+var ntpHAEntities = []mqtt.Entity{
+	{Component: "sensor", Object: "offset", Config: map[string]interface{}{
+		"name": "Clock offset", "unit_of_measurement": "µs", "state_class": "measurement",
+		"icon": "mdi:clock-outline", "value_template": "{{ value_json.offset_us }}",
+	}},
+	{Component: "sensor", Object: "frequency", Config: map[string]interface{}{
+		"name": "Frequency", "unit_of_measurement": "ppm", "state_class": "measurement",
+		"icon": "mdi:sine-wave", "value_template": "{{ value_json.frequency_ppm }}",
+	}},
+	{Component: "binary_sensor", Object: "synced", Config: map[string]interface{}{
+		"name": "Synchronised", "icon": "mdi:clock-check-outline",
+		"value_template": "{{ value_json.synced }}", "payload_on": "ON", "payload_off": "OFF",
+	}},
+	{Component: "sensor", Object: "online_sources", Config: map[string]interface{}{
+		"name": "Online sources", "state_class": "measurement",
+		"icon": "mdi:server-network", "value_template": "{{ value_json.online_sources }}",
+	}},
+	{Component: "sensor", Object: "nts_sources", Config: map[string]interface{}{
+		"name": "NTS sources", "state_class": "measurement",
+		"icon": "mdi:shield-lock-outline", "value_template": "{{ value_json.nts_sources }}",
+	}},
+	{Component: "sensor", Object: "stratum", Config: map[string]interface{}{
+		"name": "Stratum", "icon": "mdi:layers-outline", "value_template": "{{ value_json.stratum }}",
+	}},
+}
+
+func ntpHAState(stats NTPStats) map[string]interface{} {
+	synced := "OFF"
+	if stats.Synced {
+		synced = "ON"
+	}
+	return map[string]interface{}{
+		"offset_us":      stats.Offset * 1e6,
+		"frequency_ppm":  stats.FreqPPM,
+		"synced":         synced,
+		"online_sources": stats.OnlineSources,
+		"nts_sources":    stats.NTSCount,
+		"stratum":        stats.Stratum,
+		"leap_status":    stats.LeapStatus,
+	}
+}
+
+// mqttPublisher registers ntp-landing with Home Assistant through MQTT
+// discovery and publishes every collector snapshot as one retained JSON
+// state message.
+type mqttPublisher struct {
+	device *mqtt.Device
+}
+
+func newMQTTPublisher(cfg Config, host string) *mqttPublisher {
+	return &mqttPublisher{device: mqtt.NewDevice(mqtt.Options{
+		Broker:          cfg.MQTTBroker,
+		Username:        cfg.MQTTUser,
+		Password:        cfg.MQTTPassword,
+		Model:           "ntp-landing",
+		Name:            "NTP " + host,
+		Host:            host,
+		TopicPrefix:     cfg.MQTTTopicPrefix,
+		DiscoveryPrefix: cfg.MQTTDiscoveryPrefix,
+		Entities:        ntpHAEntities,
+	})}
+}
+
+// Close marks the entities unavailable and disconnects
+func (p *mqttPublisher) Close() {
+	p.device.Close()
+}
+
+// Observe is registered as a collector observer. Failed collections are
+// not published, so Home Assistant keeps the last good state.
+func (p *mqttPublisher) Observe(stats NTPStats, _ time.Time) {
+	if stats.Err != nil {
+		return
+	}
+	if err := p.device.Publish(ntpHAState(stats)); err != nil {
+		slog.Warn("mqtt publish failed", "component", "mqtt", "error", err)
+	}
+}
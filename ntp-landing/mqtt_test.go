@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/mqtt/mqtttest"
+)
+
+func TestMQTTPublisherDiscoveryAndState(t *testing.T) {
+	broker := mqtttest.NewBroker(t, 0)
+	cfg := Config{MQTTBroker: broker.Addr, MQTTUser: "ha", MQTTPassword: "pw", MQTTTopicPrefix: "ntp-landing", MQTTDiscoveryPrefix: "homeassistant"}
+	p := newMQTTPublisher(cfg, "ntp.alpina")
+	defer p.Close()
+
+	p.Observe(NTPStats{Synced: true, Offset: 12e-6, FreqPPM: -3.5, OnlineSources: 30, NTSCount: 5, Stratum: "2"}, time.Now())
+
+	connect := <-broker.Connects
+	for _, want := range []string{"MQTT", "ntp_landing_ntp_alpina", "ntp-landing/ntp.alpina/availability", "offline", "ha", "pw"} {
+		if !strings.Contains(string(connect), want) {
+			t.Errorf("CONNECT missing %q", want)
+		}
+	}
+	if flags := connect[7]; flags != 0x80|0x40|0x20|0x04|0x02 {
+		t.Errorf("connect flags = %08b", flags)
+	}
+
+	got := map[string]mqtttest.Message{}
+	for i := 0; i < len(ntpHAEntities)+2; i++ {
+		select {
+		case m := <-broker.Messages:
+			got[m.Topic] = m
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d messages: %v", i, got)
+		}
+	}
+
+	disc, ok := got["homeassistant/sensor/ntp_landing_ntp_alpina/offset/config"]
+	if !ok || !disc.Retain {
+		t.Fatalf("offset discovery missing or not retained: %+v", got)
+	}
+	var dc map[string]interface{}
+	if err := json.Unmarshal([]byte(disc.Payload), &dc); err != nil {
+		t.Fatal(err)
+	}
+	if dc["state_topic"] != "ntp-landing/ntp.alpina/state" || dc["unique_id"] != "ntp_landing_ntp_alpina_offset" || dc["unit_of_measurement"] != "µs" {
+		t.Errorf("offset discovery = %v", dc)
+	}
+	if _, ok := got["homeassistant/binary_sensor/ntp_landing_ntp_alpina/synced/config"]; !ok {
+		t.Error("synced binary_sensor not announced")
+	}
+	if a := got["ntp-landing/ntp.alpina/availability"]; a.Payload != "online" || !a.Retain {
+		t.Errorf("availability = %+v", a)
+	}
+
+	var state map[string]interface{}
+	if err := json.Unmarshal([]byte(got["ntp-landing/ntp.alpina/state"].Payload), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state["synced"] != "ON" || state["offset_us"].(float64) != 12 || state["online_sources"].(float64) != 30 || state["nts_sources"].(float64) != 5 {
+		t.Errorf("state = %v", state)
+	}
+
+	// Later snapshots only publish state
+	p.Observe(NTPStats{}, time.Now())
+	select {
+	case m := <-broker.Messages:
+		if m.Topic != "ntp-landing/ntp.alpina/state" || !strings.Contains(m.Payload, `"synced":"OFF"`) {
+			t.Errorf("second publish = %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no state after second snapshot")
+	}
+}
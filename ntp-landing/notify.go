@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification is one firing or resolved message for an alert rule
+type Notification struct {
+	Rule     string    `json:"rule"`
+	Status   string    `json:"status"` // firing or resolved
+	Severity string    `json:"severity"`
+	Host     string    `json:"host"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	StartsAt time.Time `json:"startsAt"`
+	Time     time.Time `json:"time"`
+}
+
+// alertRule checks one condition on every snapshot. A rule has to hold for
+// its whole For duration before it fires. Only rules with onFailure set are
+// checked when chronyc could not be read; the others keep their state until
+// the next good snapshot.
+type alertRule struct {
+	Name      string
+	Severity  string
+	For       time.Duration
+	onFailure bool
+	check     func(stats NTPStats, nts []NTSHealth) (bool, string)
+}
+
+// alertRules builds the enabled rules from the configuration
+func alertRules(cfg Config) []alertRule {
+	all := map[string]alertRule{
+		"offset": {
+			Name: "offset", Severity: "warning", For: cfg.NotifyOffsetFor,
+			check: func(stats NTPStats, _ []NTSHealth) (bool, string) {
+				limit := cfg.NotifyOffsetThreshold.Seconds()
+				return math.Abs(stats.Offset) > limit,
+					fmt.Sprintf("system clock offset %s exceeds %s", formatOffset(stats.Offset), formatOffset(limit))
+			},
+		},
+		"collection": {
+			Name: "collection", Severity: "critical", For: cfg.NotifyFor, onFailure: true,
+			check: func(stats NTPStats, _ []NTSHealth) (bool, string) {
+				return stats.Err != nil, fmt.Sprintf("collecting chrony statistics failed: %v", stats.Err)
+			},
+		},
+		"unsynced": {
+			Name: "unsynced", Severity: "critical", For: cfg.NotifyFor,
+			check: func(stats NTPStats, _ []NTSHealth) (bool, string) {
+				status := stats.LeapStatus
+				if status == "" {
+					status = "unknown"
+				}
+				return !stats.Synced, "chronyd is not synchronised (leap status " + status + ")"
+			},
+		},
+		"sources": {
+			Name: "sources", Severity: "warning", For: cfg.NotifyFor,
+			check: func(stats NTPStats, _ []NTSHealth) (bool, string) {
+				return stats.OnlineSources < cfg.NotifyMinSources,
+					fmt.Sprintf("%d of %d sources online, want at least %d", stats.OnlineSources, stats.TotalSources, cfg.NotifyMinSources)
+			},
+		},
+		"nts": {
+			Name: "nts", Severity: "warning", For: 0,
+			check: func(_ NTPStats, nts []NTSHealth) (bool, string) {
+				var bad []string
+				for _, h := range nts {
+					if h.Stale || h.Failing {
+						bad = append(bad, fmt.Sprintf("%s (%s)", h.Name, h.Status()))
+					}
+				}
+				return len(bad) > 0, "NTS authentication unhealthy: " + strings.Join(bad, ", ")
+			},
+		},
+	}
+	var rules []alertRule
+	for _, name := range cfg.NotifyRules {
+		if r, ok := all[name]; ok {
+			rules = append(rules, r)
+		} else {
+			log.Printf("Ignoring unknown notify rule %q", name)
+		}
+	}
+	return rules
+}
+
+// AlertState is the current state of one rule, served at /api/alerts
+type AlertState struct {
+	Rule         string    `json:"rule"`
+	Severity     string    `json:"severity"`
+	State        string    `json:"state"` // ok, pending or firing
+	Detail       string    `json:"detail,omitempty"`
+	Since        time.Time `json:"since"`
+	LastNotified time.Time `json:"lastNotified"`
+}
+
+type ruleState struct {
+	pendingSince time.Time
+	firing       bool
+	detail       string
+	lastNotified time.Time
+}
+
+// notifyTarget delivers notifications to one service
+type notifyTarget interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// Notifier evaluates the alert rules on every collector snapshot and sends
+// a notification when a rule starts firing, again every repeat interval
+// while it keeps firing, and once more when it resolves.
+type Notifier struct {
+	rules   []alertRule
+	targets []notifyTarget
+	nts     func() []NTSHealth
+	repeat  time.Duration
+	timeout time.Duration
+	host    string
+	// async sends in the background so a slow target cannot hold up the
+	// collector; tests turn it off.
+	async bool
+
+	mu     sync.Mutex
+	states map[string]*ruleState
+}
+
+func newNotifier(cfg Config, targets []notifyTarget, nts func() []NTSHealth) *Notifier {
+	host, _ := os.Hostname()
+	return &Notifier{
+		rules:   alertRules(cfg),
+		targets: targets,
+		nts:     nts,
+		repeat:  cfg.NotifyRepeat,
+		timeout: 10 * time.Second,
+		host:    host,
+		async:   true,
+		states:  make(map[string]*ruleState),
+	}
+}
+
+// Observe is registered as a collector observer, after the NTS tracker
+func (n *Notifier) Observe(stats NTPStats, at time.Time) {
+	var health []NTSHealth
+	if n.nts != nil {
+		health = n.nts()
+	}
+
+	n.mu.Lock()
+	var out []Notification
+	for _, r := range n.rules {
+		st, ok := n.states[r.Name]
+		if !ok {
+			st = &ruleState{}
+			n.states[r.Name] = st
+		}
+		if stats.Err != nil && !r.onFailure {
+			continue
+		}
+		bad, detail := r.check(stats, health)
+		note := Notification{Rule: r.Name, Severity: r.Severity, Host: n.host, Time: at}
+		switch {
+		case bad && st.pendingSince.IsZero():
+			st.pendingSince = at
+			st.detail = detail
+			if r.For > 0 {
+				continue
+			}
+			fallthrough
+		case bad && !st.firing && at.Sub(st.pendingSince) >= r.For:
+			st.firing = true
+			st.detail = detail
+			st.lastNotified = at
+			note.Status, note.Message, note.StartsAt = "firing", detail, st.pendingSince
+		case bad && st.firing && n.repeat > 0 && at.Sub(st.lastNotified) >= n.repeat:
+			st.detail = detail
+			st.lastNotified = at
+			note.Status, note.Message, note.StartsAt = "firing", detail, st.pendingSince
+		case bad:
+			// Pending, or firing and already notified
+			st.detail = detail
+			continue
+		case st.firing:
+			note.Status, note.StartsAt = "resolved", st.pendingSince
+			note.Message = fmt.Sprintf("resolved after %s: %s", at.Sub(st.pendingSince).Round(time.Second), st.detail)
+			*st = ruleState{}
+		default:
+			*st = ruleState{}
+			continue
+		}
+		note.Title = fmt.Sprintf("[%s] %s %s on %s", strings.ToUpper(note.Status), note.Severity, note.Rule, n.host)
+		out = append(out, note)
+	}
+	n.mu.Unlock()
+
+	for _, note := range out {
+		if n.async {
+			go n.deliver(note)
+		} else {
+			n.deliver(note)
+		}
+	}
+}
+
+// deliver sends a notification to every target and logs failures
+func (n *Notifier) deliver(note Notification) {
+	slog.Info(note.Title, "component", "notify", "rule", note.Rule, "status", note.Status, "severity", note.Severity)
+	for _, t := range n.targets {
+		ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+		if err := t.Send(ctx, note); err != nil {
+			slog.Error("notification failed", "component", "notify", "target", t.Name(), "rule", note.Rule, "error", err)
+		}
+		cancel()
+	}
+}
+
+// States returns the current state of every rule, sorted by name
+func (n *Notifier) States() []AlertState {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := make([]AlertState, 0, len(n.rules))
+	for _, r := range n.rules {
+		s := AlertState{Rule: r.Name, Severity: r.Severity, State: "ok"}
+		if st, ok := n.states[r.Name]; ok && !st.pendingSince.IsZero() {
+			s.State = "pending"
+			if st.firing {
+				s.State = "firing"
+			}
+			s.Detail, s.Since, s.LastNotified = st.detail, st.pendingSince, st.lastNotified
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rule < out[j].Rule })
+	return out
+}
+
+// notifyTargets builds the targets that have an address configured
+func notifyTargets(cfg Config) []notifyTarget {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var targets []notifyTarget
+	if cfg.NotifyWebhookURL != "" {
+		targets = append(targets, &webhookTarget{url: cfg.NotifyWebhookURL, client: client})
+	}
+	if cfg.NotifyNtfyURL != "" {
+		targets = append(targets, &ntfyTarget{url: cfg.NotifyNtfyURL, token: cfg.NotifyNtfyToken, client: client})
+	}
+	if cfg.NotifyGotifyURL != "" {
+		targets = append(targets, &gotifyTarget{url: cfg.NotifyGotifyURL, token: cfg.NotifyGotifyToken, client: client})
+	}
+	if cfg.NotifyHassURL != "" {
+		targets = append(targets, &hassTarget{url: cfg.NotifyHassURL, token: cfg.NotifyHassToken, service: cfg.NotifyHassService, client: client})
+	}
+	if cfg.NotifySMTPAddr != "" && len(cfg.NotifySMTPTo) > 0 {
+		targets = append(targets, &smtpTarget{
+			addr: cfg.NotifySMTPAddr, from: cfg.NotifySMTPFrom, to: cfg.NotifySMTPTo,
+			username: cfg.NotifySMTPUser, password: cfg.NotifySMTPPassword,
+		})
+	}
+	return targets
+}
+
+// postJSON posts body as JSON with extra headers and fails on non-2xx
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}, headers map[string]string) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return doNotifyRequest(client, req)
+}
+
+func doNotifyRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// webhookTarget posts the Notification as JSON
+type webhookTarget struct {
+	url    string
+	client *http.Client
+}
+
+func (t *webhookTarget) Name() string { return "webhook" }
+
+func (t *webhookTarget) Send(ctx context.Context, n Notification) error {
+	return postJSON(ctx, t.client, t.url, n, nil)
+}
+
+// ntfyTarget publishes to an ntfy topic URL (https://ntfy.sh/mytopic)
+type ntfyTarget struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (t *ntfyTarget) Name() string { return "ntfy" }
+
+func (t *ntfyTarget) Send(ctx context.Context, n Notification) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", n.Title)
+	priority, tags := "default", "white_check_mark"
+	if n.Status == "firing" {
+		tags = "warning"
+		if n.Severity == "critical" {
+			priority, tags = "urgent", "rotating_light"
+		} else {
+			priority = "high"
+		}
+	}
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", tags)
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return doNotifyRequest(t.client, req)
+}
+
+// gotifyTarget posts to a Gotify server's /message endpoint
+type gotifyTarget struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (t *gotifyTarget) Name() string { return "gotify" }
+
+func (t *gotifyTarget) Send(ctx context.Context, n Notification) error {
+	priority := 2
+	if n.Status == "firing" {
+		priority = 5
+		if n.Severity == "critical" {
+			priority = 8
+		}
+	}
+	body := map[string]interface{}{"title": n.Title, "message": n.Message, "priority": priority}
+	return postJSON(ctx, t.client, strings.TrimRight(t.url, "/")+"/message", body, map[string]string{"X-Gotify-Key": t.token})
+}
+
+// hassTarget calls a Home Assistant notify service through the REST API
+type hassTarget struct {
+	url     string
+	token   string
+	service string
+	client  *http.Client
+}
+
+func (t *hassTarget) Name() string { return "homeassistant" }
+
+func (t *hassTarget) Send(ctx context.Context, n Notification) error {
+	url := strings.TrimRight(t.url, "/") + "/api/services/notify/" + t.service
+	body := map[string]interface{}{
+		"title":   n.Title,
+		"message": n.Message,
+		"data":    map[string]string{"rule": n.Rule, "status": n.Status, "severity": n.Severity},
+	}
+	return postJSON(ctx, t.client, url, body, map[string]string{"Authorization": "Bearer " + t.token})
+}
+
+// smtpTarget mails notifications. Authentication is only used when a user
+// is configured; net/smtp refuses to send it unencrypted to remote hosts.
+type smtpTarget struct {
+	addr     string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (t *smtpTarget) Name() string { return "smtp" }
+
+func (t *smtpTarget) Send(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+	if t.username != "" {
+		host, _, err := net.SplitHostPort(t.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", t.username, t.password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", t.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(t.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.Title)
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nRule: %s\r\nSeverity: %s\r\nSince: %s\r\n",
+		n.Message, n.Rule, n.Severity, n.StartsAt.Format(time.RFC3339))
+
+	// net/smtp has no context support, so bound the whole exchange by
+	// running it in the background and giving up at the deadline
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(t.addr, auth, t.from, t.to, msg.Bytes()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
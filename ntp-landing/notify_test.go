@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingTarget struct {
+	mu    sync.Mutex
+	notes []Notification
+}
+
+func (r *recordingTarget) Name() string { return "recording" }
+
+func (r *recordingTarget) Send(_ context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notes = append(r.notes, n)
+	return nil
+}
+
+func testNotifyConfig() Config {
+	return Config{
+		NotifyRules:           []string{"offset", "unsynced", "sources", "nts"},
+		NotifyOffsetThreshold: time.Millisecond,
+		NotifyOffsetFor:       5 * time.Minute,
+		NotifyFor:             2 * time.Minute,
+		NotifyMinSources:      2,
+		NotifyRepeat:          time.Hour,
+	}
+}
+
+func healthySnapshot() NTPStats {
+	return NTPStats{Synced: true, LeapStatus: "Normal", Offset: 20e-6, OnlineSources: 4, TotalSources: 4}
+}
+
+func TestNotifierLifecycle(t *testing.T) {
+	rec := &recordingTarget{}
+	n := newNotifier(testNotifyConfig(), []notifyTarget{rec}, nil)
+	n.async = false
+	t0 := time.Unix(1700000000, 0)
+
+	bad := healthySnapshot()
+	bad.Offset = 0.004
+	n.Observe(healthySnapshot(), t0)
+	n.Observe(bad, t0.Add(time.Minute))
+	n.Observe(bad, t0.Add(4*time.Minute))
+	if len(rec.notes) != 0 {
+		t.Fatalf("fired before the for duration: %+v", rec.notes)
+	}
+	if s := n.States(); s[1].Rule != "offset" || s[1].State != "pending" {
+		t.Errorf("states = %+v", s)
+	}
+
+	n.Observe(bad, t0.Add(6*time.Minute))
+	n.Observe(bad, t0.Add(7*time.Minute))
+	if len(rec.notes) != 1 || rec.notes[0].Status != "firing" || rec.notes[0].Rule != "offset" {
+		t.Fatalf("after 5m: %+v", rec.notes)
+	}
+	if !strings.Contains(rec.notes[0].Message, "4.00 ms") || !rec.notes[0].StartsAt.Equal(t0.Add(time.Minute)) {
+		t.Errorf("firing note = %+v", rec.notes[0])
+	}
+
+	// Repeated only after NotifyRepeat
+	n.Observe(bad, t0.Add(66*time.Minute))
+	if len(rec.notes) != 2 {
+		t.Fatalf("repeat: %d notes", len(rec.notes))
+	}
+
+	n.Observe(healthySnapshot(), t0.Add(70*time.Minute))
+	n.Observe(healthySnapshot(), t0.Add(71*time.Minute))
+	if len(rec.notes) != 3 || rec.notes[2].Status != "resolved" || !strings.HasPrefix(rec.notes[2].Message, "resolved after 1h9m0s") {
+		t.Fatalf("resolve: %+v", rec.notes)
+	}
+}
+
+func TestNotifierPendingClearsWithoutFiring(t *testing.T) {
+	rec := &recordingTarget{}
+	n := newNotifier(testNotifyConfig(), []notifyTarget{rec}, nil)
+	n.async = false
+	t0 := time.Unix(1700000000, 0)
+
+	down := healthySnapshot()
+	down.Synced, down.LeapStatus, down.OnlineSources = false, "Not synchronised", 1
+	n.Observe(down, t0)
+	n.Observe(healthySnapshot(), t0.Add(time.Minute))
+	n.Observe(down, t0.Add(2*time.Minute))
+	n.Observe(down, t0.Add(3*time.Minute))
+	if len(rec.notes) != 0 {
+		t.Fatalf("flap shorter than for fired: %+v", rec.notes)
+	}
+	n.Observe(down, t0.Add(4*time.Minute))
+	if len(rec.notes) != 2 || rec.notes[0].Rule != "unsynced" || rec.notes[0].Severity != "critical" || rec.notes[1].Rule != "sources" {
+		t.Fatalf("notes = %+v", rec.notes)
+	}
+}
+
+func TestNotifierFailedCollection(t *testing.T) {
+	rec := &recordingTarget{}
+	cfg := testNotifyConfig()
+	cfg.NotifyRules = append(cfg.NotifyRules, "collection")
+	n := newNotifier(cfg, []notifyTarget{rec}, nil)
+	n.async = false
+	t0 := time.Unix(1700000000, 0)
+
+	// A chronyc timeout is not reported as unsynced or missing sources
+	failed := NTPStats{Err: errors.New("chronyc tracking: context deadline exceeded")}
+	n.Observe(healthySnapshot(), t0)
+	for i := 1; i <= 3; i++ {
+		n.Observe(failed, t0.Add(time.Duration(i)*time.Minute))
+	}
+	if len(rec.notes) != 1 || rec.notes[0].Rule != "collection" || !strings.Contains(rec.notes[0].Message, "deadline exceeded") {
+		t.Fatalf("notes = %+v", rec.notes)
+	}
+
+	n.Observe(healthySnapshot(), t0.Add(4*time.Minute))
+	if len(rec.notes) != 2 || rec.notes[1].Rule != "collection" || rec.notes[1].Status != "resolved" {
+		t.Fatalf("notes = %+v", rec.notes)
+	}
+}
+
+func TestNotifierNTSFiresImmediately(t *testing.T) {
+	rec := &recordingTarget{}
+	health := []NTSHealth{{Name: "nts.example", Stale: true}}
+	n := newNotifier(testNotifyConfig(), []notifyTarget{rec}, func() []NTSHealth { return health })
+	n.async = false
+	n.Observe(healthySnapshot(), time.Unix(1700000000, 0))
+	if len(rec.notes) != 1 || rec.notes[0].Rule != "nts" || !strings.Contains(rec.notes[0].Message, "nts.example (stale)") {
+		t.Fatalf("notes = %+v", rec.notes)
+	}
+}
+
+// capturedRequest is what a stand-in HTTP server received
+type capturedRequest struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+func captureServer(t *testing.T) (*httptest.Server, <-chan capturedRequest) {
+	t.Helper()
+	ch := make(chan capturedRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		ch <- capturedRequest{path: r.URL.Path, header: r.Header.Clone(), body: string(b)}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func TestHTTPTargets(t *testing.T) {
+	note := Notification{Rule: "unsynced", Status: "firing", Severity: "critical", Title: "[FIRING] critical unsynced on ntp", Message: "chronyd is not synchronised"}
+	ctx := context.Background()
+
+	srv, ch := captureServer(t)
+	if err := (&webhookTarget{url: srv.URL + "/hook", client: srv.Client()}).Send(ctx, note); err != nil {
+		t.Fatal(err)
+	}
+	got := <-ch
+	var decoded Notification
+	if err := json.Unmarshal([]byte(got.body), &decoded); err != nil || decoded.Rule != "unsynced" || got.path != "/hook" {
+		t.Errorf("webhook: %+v (%v)", got, err)
+	}
+
+	if err := (&ntfyTarget{url: srv.URL + "/alpina", token: "tk", client: srv.Client()}).Send(ctx, note); err != nil {
+		t.Fatal(err)
+	}
+	got = <-ch
+	if got.path != "/alpina" || got.body != note.Message || got.header.Get("Title") != note.Title ||
+		got.header.Get("Priority") != "urgent" || got.header.Get("Authorization") != "Bearer tk" {
+		t.Errorf("ntfy: %+v", got)
+	}
+
+	if err := (&gotifyTarget{url: srv.URL + "/", token: "app", client: srv.Client()}).Send(ctx, note); err != nil {
+		t.Fatal(err)
+	}
+	got = <-ch
+	if got.path != "/message" || got.header.Get("X-Gotify-Key") != "app" || !strings.Contains(got.body, `"priority":8`) {
+		t.Errorf("gotify: %+v", got)
+	}
+
+	if err := (&hassTarget{url: srv.URL, token: "ha", service: "mobile_app_phone", client: srv.Client()}).Send(ctx, note); err != nil {
+		t.Fatal(err)
+	}
+	got = <-ch
+	if got.path != "/api/services/notify/mobile_app_phone" || got.header.Get("Authorization") != "Bearer ha" || !strings.Contains(got.body, `"title":"[FIRING]`) {
+		t.Errorf("home assistant: %+v", got)
+	}
+}
+
+func TestHTTPTargetError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	err := (&webhookTarget{url: srv.URL, client: srv.Client()}).Send(context.Background(), Notification{})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// fakeSMTP accepts one message and returns the envelope and data
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		var transcript strings.Builder
+		reply("220 fake ESMTP")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					reply("250 queued")
+				}
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				ch <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestSMTPTarget(t *testing.T) {
+	addr, ch := fakeSMTP(t)
+	target := &smtpTarget{addr: addr, from: "ntp@alpina", to: []string{"ops@alpina"}}
+	note := Notification{Rule: "sources", Status: "resolved", Severity: "warning", Title: "[RESOLVED] warning sources on ntp", Message: "resolved after 3m0s"}
+	if err := target.Send(context.Background(), note); err != nil {
+		t.Fatal(err)
+	}
+	transcript := <-ch
+	for _, want := range []string{"MAIL FROM:<ntp@alpina>", "RCPT TO:<ops@alpina>", "Subject: [RESOLVED] warning sources on ntp", "resolved after 3m0s", "Rule: sources"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript missing %q:\n%s", want, transcript)
+		}
+	}
+}
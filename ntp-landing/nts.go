@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NTSHealth is the tracked NTS state of a single source
+type NTSHealth struct {
+	Name            string   `json:"name"`
+	KeyLength       int      `json:"keyLength"`
+	LastAuthSecs    float64  `json:"lastAuthSecs"`
+	LastAuth        string   `json:"lastAuth"`
+	KEAgeSecs       float64  `json:"keAgeSecs"`
+	KEAge           string   `json:"keAge"`
+	Cookies         int      `json:"cookies"`
+	MinCookies      int      `json:"minCookies"`
+	CookieTrend     float64  `json:"cookieTrend"`
+	CookiesEmptyIn  string   `json:"cookiesEmptyIn"`
+	Attempts        int      `json:"attempts"`
+	NAK             bool     `json:"nak"`
+	NAKCount        int      `json:"nakCount"`
+	FailedKE        int      `json:"failedKE"`
+	Renegotiations  int      `json:"renegotiations"`
+	Stale           bool     `json:"stale"`
+	Failing         bool     `json:"failing"`
+	LowCookies      bool     `json:"lowCookies"`
+	Reasons         []string `json:"reasons"`
+	FirstSeen       string   `json:"firstSeen"`
+	ObservedSamples int      `json:"observedSamples"`
+}
+
+// Status is a one-word summary used for badges and metrics labels
+func (h NTSHealth) Status() string {
+	switch {
+	case h.Failing:
+		return "failing"
+	case h.Stale:
+		return "stale"
+	case h.LowCookies:
+		return "low-cookies"
+	}
+	return "ok"
+}
+
+type ntsSample struct {
+	at      time.Time
+	cookies int
+}
+
+type ntsSourceState struct {
+	firstSeen    time.Time
+	samples      []ntsSample
+	keyLength    int
+	lastAuth     float64
+	keAge        float64
+	cookies      int
+	attempts     int
+	nak          bool
+	nakCount     int
+	failedKE     int
+	renegotiated int
+	observed     int
+}
+
+// NTSTracker follows chronyc authdata across collector snapshots so that
+// trends (cookie drain, repeated NTS-KE, NAKs) become visible instead of
+// only the instantaneous values chronyc prints.
+type NTSTracker struct {
+	cfg     Config
+	mu      sync.Mutex
+	sources map[string]*ntsSourceState
+}
+
+func newNTSTracker(cfg Config) *NTSTracker {
+	return &NTSTracker{cfg: cfg, sources: make(map[string]*ntsSourceState)}
+}
+
+// Observe records one snapshot. It is registered as a collector observer.
+// Failed collections are skipped.
+func (t *NTSTracker) Observe(stats NTPStats, at time.Time) {
+	if stats.Err != nil {
+		return
+	}
+	lastRx := make(map[string]float64)
+	for _, src := range stats.Sources {
+		if src.NTS {
+			lastRx[src.Name] = parseChronyInterval(src.LastRx)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, d := range stats.NTSDetails {
+		st, ok := t.sources[d.Name]
+		keAge := parseChronyInterval(d.LastAuth)
+		cookies, _ := strconv.Atoi(d.Cookies)
+		if !ok {
+			st = &ntsSourceState{firstSeen: at, keAge: keAge, attempts: d.Attempts}
+			t.sources[d.Name] = st
+		} else {
+			// chronyc truncates ages to s/m/h/d, so an age that goes
+			// backwards means a fresh key establishment happened.
+			if keAge >= 0 && st.keAge >= 0 && keAge < st.keAge {
+				st.renegotiated++
+			}
+			// Atmp counts attempts since the last success; any retry
+			// means the previous attempt failed. Counting from at least
+			// one keeps a jump from zero, where the first attempt is not
+			// yet known to have failed, from being missed.
+			if d.Attempts > st.attempts && d.Attempts > 1 {
+				st.failedKE += d.Attempts - max(st.attempts, 1)
+			}
+		}
+		if d.NAK && !st.nak {
+			st.nakCount++
+		}
+
+		st.keyLength, _ = strconv.Atoi(d.KeyLength)
+		st.keAge = keAge
+		st.cookies = cookies
+		st.attempts = d.Attempts
+		st.nak = d.NAK
+		st.observed++
+		if age, ok := lastRx[d.Name]; ok {
+			st.lastAuth = age
+		} else {
+			st.lastAuth = -1
+		}
+
+		st.samples = append(st.samples, ntsSample{at: at, cookies: cookies})
+		cutoff := at.Add(-t.cfg.NTSHistory)
+		drop := 0
+		for drop < len(st.samples)-1 && st.samples[drop].at.Before(cutoff) {
+			drop++
+		}
+		st.samples = st.samples[drop:]
+	}
+}
+
+// Health returns the current assessment of every tracked NTS source,
+// sorted by name.
+func (t *NTSTracker) Health() []NTSHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]NTSHealth, 0, len(t.sources))
+	for name, st := range t.sources {
+		h := NTSHealth{
+			Name:            name,
+			KeyLength:       st.keyLength,
+			LastAuthSecs:    st.lastAuth,
+			LastAuth:        formatAge(st.lastAuth),
+			KEAgeSecs:       st.keAge,
+			KEAge:           formatAge(st.keAge),
+			Cookies:         st.cookies,
+			MinCookies:      st.cookies,
+			Attempts:        st.attempts,
+			NAK:             st.nak,
+			NAKCount:        st.nakCount,
+			FailedKE:        st.failedKE,
+			Renegotiations:  st.renegotiated,
+			FirstSeen:       st.firstSeen.Format("2006-01-02 15:04:05"),
+			ObservedSamples: st.observed,
+		}
+		for _, s := range st.samples {
+			if s.cookies < h.MinCookies {
+				h.MinCookies = s.cookies
+			}
+		}
+		h.CookieTrend = cookieSlope(st.samples)
+		if h.CookieTrend < 0 && h.Cookies > 0 {
+			h.CookiesEmptyIn = formatAge(float64(h.Cookies) / -h.CookieTrend * 3600)
+		}
+
+		if st.lastAuth < 0 {
+			h.Stale = true
+			h.Reasons = append(h.Reasons, "no authenticated sample yet")
+		} else if st.lastAuth > t.cfg.NTSStaleAfter.Seconds() {
+			h.Stale = true
+			h.Reasons = append(h.Reasons, fmt.Sprintf("last authenticated sample %s ago", h.LastAuth))
+		}
+		if st.cookies <= t.cfg.NTSMinCookies {
+			h.LowCookies = true
+			h.Reasons = append(h.Reasons, fmt.Sprintf("%d cookies left", st.cookies))
+		}
+		if st.nak {
+			h.Failing = true
+			h.Reasons = append(h.Reasons, "NTS NAK received")
+		}
+		if st.attempts > t.cfg.NTSMaxAttempts {
+			h.Failing = true
+			h.Reasons = append(h.Reasons, fmt.Sprintf("%d NTS-KE attempts since last success", st.attempts))
+		}
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// cookieSlope is the least-squares cookie count trend in cookies per hour
+func cookieSlope(samples []ntsSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	t0 := samples[0].at
+	var sx, sy, sxx, sxy float64
+	n := float64(len(samples))
+	for _, s := range samples {
+		x := s.at.Sub(t0).Hours()
+		y := float64(s.cookies)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / den
+}
+
+// parseChronyInterval converts chronyc's compact interval column ("45",
+// "63m", "11h", "12d", "3y") to seconds. "-" and unparsable values yield -1.
+func parseChronyInterval(s string) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-" {
+		return -1
+	}
+	mult := 1.0
+	switch s[len(s)-1] {
+	case 'm':
+		mult = 60
+	case 'h':
+		mult = 3600
+	case 'd':
+		mult = 86400
+	case 'y':
+		mult = 365 * 86400
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return -1
+	}
+	return n * mult
+}
+
+// formatAge renders a number of seconds as a short age like "4m" or "2.5h"
+func formatAge(secs float64) string {
+	switch {
+	case secs < 0:
+		return "-"
+	case secs < 120:
+		return fmt.Sprintf("%.0fs", secs)
+	case secs < 7200:
+		return fmt.Sprintf("%.0fm", secs/60)
+	case secs < 172800:
+		return fmt.Sprintf("%.1fh", secs/3600)
+	}
+	return fmt.Sprintf("%.1fd", secs/86400)
+}
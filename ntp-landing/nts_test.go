@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/metrics"
+)
+
+const sampleAuthData = `Name/IP address             Mode KeyID Type KLen Last Atmp  NAK Cook CLen
+=========================================================================
+time.cloudflare.com          NTS     1   15  256  33m    0    0    8  100
+nts.netnod.se                NTS     1   15  256   2h    3    1    1  100
+192.168.1.1                    -     0    0    0    -    0    0    0    0
+`
+
+func TestParseNTSDetails(t *testing.T) {
+	details := parseNTSDetails(sampleAuthData)
+	if len(details) != 2 {
+		t.Fatalf("expected 2 NTS rows, got %d", len(details))
+	}
+	cf := details[0]
+	if cf.Name != "time.cloudflare.com" || cf.KeyLength != "256" || cf.LastAuth != "33m" || cf.Cookies != "8" || cf.CookieLength != "100" {
+		t.Errorf("unexpected cloudflare row: %+v", cf)
+	}
+	if cf.NAK || cf.Attempts != 0 {
+		t.Errorf("cloudflare should have no NAK or pending attempts: %+v", cf)
+	}
+	if !details[1].NAK || details[1].Attempts != 3 {
+		t.Errorf("netnod should have NAK and 3 attempts: %+v", details[1])
+	}
+}
+
+func TestParseChronyInterval(t *testing.T) {
+	cases := map[string]float64{
+		"45":  45,
+		"63m": 63 * 60,
+		"11h": 11 * 3600,
+		"12d": 12 * 86400,
+		"-":   -1,
+		"":    -1,
+		"xyz": -1,
+	}
+	for in, want := range cases {
+		if got := parseChronyInterval(in); got != want {
+			t.Errorf("parseChronyInterval(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func ntsSnapshot(lastRx, keAge, cookies string, attempts int, nak bool) NTPStats {
+	return NTPStats{
+		Sources: []NTPSource{{Name: "nts.example", NTS: true, LastRx: lastRx}},
+		NTSDetails: []NTSDetail{{
+			Name: "nts.example", KeyLength: "256", LastAuth: keAge,
+			Cookies: cookies, Attempts: attempts, NAK: nak,
+		}},
+	}
+}
+
+func TestNTSTrackerHealthy(t *testing.T) {
+	cfg := Config{NTSStaleAfter: 15 * time.Minute, NTSMinCookies: 2, NTSMaxAttempts: 1, NTSHistory: time.Hour}
+	tr := newNTSTracker(cfg)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr.Observe(ntsSnapshot("30", "33m", "8", 0, false), t0)
+	tr.Observe(ntsSnapshot("12", "34m", "8", 0, false), t0.Add(time.Minute))
+
+	h := tr.Health()
+	if len(h) != 1 {
+		t.Fatalf("expected 1 tracked source, got %d", len(h))
+	}
+	if h[0].Status() != "ok" || len(h[0].Reasons) != 0 {
+		t.Errorf("expected healthy source, got %s %v", h[0].Status(), h[0].Reasons)
+	}
+	if h[0].KeyLength != 256 || h[0].LastAuthSecs != 12 || h[0].KEAgeSecs != 34*60 {
+		t.Errorf("unexpected values: %+v", h[0])
+	}
+}
+
+func TestNTSTrackerDetectsProblems(t *testing.T) {
+	cfg := Config{NTSStaleAfter: 15 * time.Minute, NTSMinCookies: 2, NTSMaxAttempts: 1, NTSHistory: time.Hour}
+	tr := newNTSTracker(cfg)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tr.Observe(ntsSnapshot("30", "5h", "8", 0, false), t0)
+	tr.Observe(ntsSnapshot("60", "5h", "5", 0, false), t0.Add(10*time.Minute))
+	// NTS-KE age resets: renegotiation
+	tr.Observe(ntsSnapshot("90", "20", "3", 1, false), t0.Add(20*time.Minute))
+	// retries and a NAK
+	tr.Observe(ntsSnapshot("25m", "11m", "1", 3, true), t0.Add(30*time.Minute))
+
+	h := tr.Health()[0]
+	if h.Renegotiations != 1 {
+		t.Errorf("expected 1 renegotiation, got %d", h.Renegotiations)
+	}
+	if h.FailedKE != 2 {
+		t.Errorf("expected 2 failed NTS-KE attempts, got %d", h.FailedKE)
+	}
+	if h.NAKCount != 1 {
+		t.Errorf("expected 1 NAK, got %d", h.NAKCount)
+	}
+	if !h.Stale || !h.Failing || !h.LowCookies {
+		t.Errorf("expected stale, failing and low cookies: %+v", h)
+	}
+	if h.CookieTrend >= 0 || h.CookiesEmptyIn == "" {
+		t.Errorf("expected a draining cookie trend, got %v (%q)", h.CookieTrend, h.CookiesEmptyIn)
+	}
+	if h.MinCookies != 1 {
+		t.Errorf("expected min cookies 1, got %d", h.MinCookies)
+	}
+}
+
+func TestNTSTrackerCountsRetriesFromZero(t *testing.T) {
+	cfg := Config{NTSStaleAfter: 15 * time.Minute, NTSMinCookies: 2, NTSMaxAttempts: 1, NTSHistory: time.Hour}
+	tr := newNTSTracker(cfg)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr.Observe(ntsSnapshot("30", "5h", "8", 0, false), t0)
+	tr.Observe(ntsSnapshot("60", "5h", "8", 1, false), t0.Add(time.Minute))
+	if h := tr.Health()[0]; h.FailedKE != 0 {
+		t.Errorf("a first attempt is not a failure, got %d", h.FailedKE)
+	}
+
+	tr = newNTSTracker(cfg)
+	tr.Observe(ntsSnapshot("30", "5h", "8", 0, false), t0)
+	tr.Observe(ntsSnapshot("60", "5h", "8", 3, false), t0.Add(time.Minute))
+	if h := tr.Health()[0]; h.FailedKE != 2 {
+		t.Errorf("expected 2 failed NTS-KE attempts after 0 -> 3, got %d", h.FailedKE)
+	}
+}
+
+func TestWriteNTSMetrics(t *testing.T) {
+	cfg := Config{NTSStaleAfter: 15 * time.Minute, NTSMinCookies: 2, NTSMaxAttempts: 1, NTSHistory: time.Hour}
+	tr := newNTSTracker(cfg)
+	tr.Observe(ntsSnapshot("30", "33m", "8", 0, false), time.Now())
+
+	var buf bytes.Buffer
+	writeNTSMetrics(metrics.NewWriter(&buf), cfg, tr.Health())
+	out := buf.String()
+
+	for _, want := range []string{
+		"ntp_landing_nts_stale_after_seconds 900\n",
+		"ntp_landing_nts_min_cookies 2\n",
+		`ntp_landing_nts_cookies{source="nts.example"} 8`,
+		`ntp_landing_nts_stale{source="nts.example"} 0`,
+		"# TYPE ntp_landing_nts_renegotiations_total counter\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	if n := strings.Count(out, "# HELP ntp_landing_nts_cookies "); n != 1 {
+		t.Errorf("expected one HELP line for cookies, got %d", n)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProblemSource is one entry of the ranked problem sources list
+type ProblemSource struct {
+	Name            string   `json:"name"`
+	Severity        float64  `json:"severity"`
+	Deviation       float64  `json:"deviation"`
+	Scored          bool     `json:"scored"`
+	OffsetDisplay   string   `json:"offsetDisplay"`
+	OutlierFraction float64  `json:"outlierFraction"`
+	SelectionFlaps  int      `json:"selectionFlaps"`
+	ReachMissed     int      `json:"reachMissed"`
+	ReachDrops      int      `json:"reachDrops"`
+	ChronyState     string   `json:"chronyState"`
+	Reasons         []string `json:"reasons"`
+}
+
+type sourceObservation struct {
+	at       time.Time
+	score    float64 // robust deviation from consensus, NaN if not scored
+	selected bool
+}
+
+type sourceHistory struct {
+	obs        []sourceObservation
+	reach      uint64
+	reachDrops int
+	state      string
+	offset     float64
+	hasOffset  bool
+}
+
+// OutlierDetector compares every source against a robust consensus of all
+// reachable sources on each collector snapshot. It keeps a window of
+// deviation scores, selection changes and reach losses so sources that
+// persistently disagree or flap can be ranked, beyond the instantaneous
+// falseticker marking chrony itself does.
+type OutlierDetector struct {
+	cfg     Config
+	mu      sync.Mutex
+	sources map[string]*sourceHistory
+}
+
+func newOutlierDetector(cfg Config) *OutlierDetector {
+	return &OutlierDetector{cfg: cfg, sources: make(map[string]*sourceHistory)}
+}
+
+// madScale turns a median absolute deviation into a standard deviation
+// estimate for normally distributed data
+const madScale = 1.4826
+
+// Observe scores one snapshot. It is registered as a collector observer.
+// Failed collections are skipped so a chronyc error does not forget every
+// source's history.
+func (d *OutlierDetector) Observe(stats NTPStats, at time.Time) {
+	if stats.Err != nil {
+		return
+	}
+	offsets := make(map[string]float64)
+	stddevs := make(map[string]float64)
+	var consensus []float64
+	for _, src := range stats.Sources {
+		off, ok := parseChronyDuration(src.EstOffset)
+		if !ok {
+			continue
+		}
+		reach, _ := strconv.ParseUint(strings.TrimSpace(src.Reach), 8, 16)
+		if reach == 0 {
+			continue
+		}
+		offsets[src.Name] = off
+		if sd, ok := parseChronyDuration(src.StdDev); ok {
+			stddevs[src.Name] = sd
+		}
+		consensus = append(consensus, off)
+	}
+	med := median(consensus)
+	spread := make([]float64, len(consensus))
+	for i, v := range consensus {
+		spread[i] = math.Abs(v - med)
+	}
+	sigma := madScale * median(spread)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := at.Add(-d.cfg.OutlierWindow)
+	seen := make(map[string]bool)
+	for _, src := range stats.Sources {
+		seen[src.Name] = true
+		h, ok := d.sources[src.Name]
+		if !ok {
+			h = &sourceHistory{}
+			d.sources[src.Name] = h
+		}
+		reach, _ := strconv.ParseUint(strings.TrimSpace(src.Reach), 8, 16)
+		if reach == 0 && (h.reach != 0 || !ok) {
+			h.reachDrops++
+		}
+		h.reach = reach
+		h.state = src.StatusIcon
+
+		score := math.NaN()
+		off, hasOffset := offsets[src.Name]
+		h.offset, h.hasOffset = off, hasOffset
+		if hasOffset && len(consensus) >= 3 {
+			// A source's own jitter widens its tolerance so noisy but
+			// unbiased sources are not reported as outliers
+			tol := math.Hypot(sigma, stddevs[src.Name])
+			if tol > 0 {
+				score = math.Abs(off-med) / tol
+			}
+		}
+		h.obs = append(h.obs, sourceObservation{
+			at:       at,
+			score:    score,
+			selected: src.StatusIcon == "*" || src.StatusIcon == "+",
+		})
+		drop := 0
+		for drop < len(h.obs) && h.obs[drop].at.Before(cutoff) {
+			drop++
+		}
+		h.obs = h.obs[drop:]
+	}
+	for name := range d.sources {
+		if !seen[name] {
+			delete(d.sources, name)
+		}
+	}
+}
+
+// Problems returns the sources with at least one reason to look at them,
+// most severe first.
+func (d *OutlierDetector) Problems() []ProblemSource {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []ProblemSource
+	for name, h := range d.sources {
+		p := ProblemSource{
+			Name:        name,
+			ChronyState: h.state,
+			ReachMissed: 8 - bits.OnesCount64(h.reach&0xff),
+			ReachDrops:  h.reachDrops,
+		}
+		if h.hasOffset {
+			p.OffsetDisplay = formatOffset(h.offset)
+		}
+
+		scored, outliers := 0, 0
+		for i, o := range h.obs {
+			if !math.IsNaN(o.score) {
+				scored++
+				if o.score > d.cfg.OutlierThreshold {
+					outliers++
+				}
+			}
+			if i > 0 && o.selected != h.obs[i-1].selected {
+				p.SelectionFlaps++
+			}
+		}
+		if n := len(h.obs); n > 0 && !math.IsNaN(h.obs[n-1].score) {
+			p.Deviation = h.obs[n-1].score
+			p.Scored = true
+		}
+		if scored > 0 {
+			p.OutlierFraction = float64(outliers) / float64(scored)
+		}
+
+		if scored >= d.cfg.OutlierMinSamples && p.OutlierFraction >= d.cfg.OutlierPersist {
+			p.Reasons = append(p.Reasons, fmt.Sprintf("disagrees with consensus in %.0f%% of samples", p.OutlierFraction*100))
+			p.Severity += 4 * p.OutlierFraction
+		}
+		if p.Scored && p.Deviation > d.cfg.OutlierThreshold {
+			p.Reasons = append(p.Reasons, fmt.Sprintf("currently %.1f sigma from consensus", p.Deviation))
+			p.Severity += math.Min(p.Deviation/d.cfg.OutlierThreshold, 3)
+		}
+		switch h.state {
+		case "x":
+			p.Reasons = append(p.Reasons, "chrony marks it a falseticker")
+			p.Severity += 2
+		case "~":
+			p.Reasons = append(p.Reasons, "chrony marks it too variable")
+			p.Severity++
+		}
+		if p.SelectionFlaps >= d.cfg.FlapThreshold {
+			p.Reasons = append(p.Reasons, fmt.Sprintf("flapped %d times between selected and unselected", p.SelectionFlaps))
+			p.Severity += float64(p.SelectionFlaps) / float64(d.cfg.FlapThreshold)
+		}
+		if h.reach == 0 {
+			p.Reasons = append(p.Reasons, "unreachable")
+			p.Severity += 3
+		} else if p.ReachMissed > 0 {
+			p.Reasons = append(p.Reasons, fmt.Sprintf("missed %d of last 8 polls", p.ReachMissed))
+			p.Severity += float64(p.ReachMissed) / 8
+		}
+		if len(p.Reasons) > 0 {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Severity != out[j].Severity {
+			return out[i].Severity > out[j].Severity
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func median(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), vals...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// parseChronyDuration converts chronyc's offset/stddev notation ("+61us",
+// "-1234ns", "2ms", "1.5s") to seconds.
+func parseChronyDuration(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   float64
+	}{{"ns", 1e-9}, {"us", 1e-6}, {"ms", 1e-3}, {"s", 1}}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, false
+			}
+			return v * u.mult, true
+		}
+	}
+	return 0, false
+}
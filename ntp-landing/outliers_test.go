@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func outlierConfig() Config {
+	return Config{
+		OutlierThreshold:  3.5,
+		OutlierPersist:    0.5,
+		OutlierWindow:     time.Hour,
+		OutlierMinSamples: 3,
+		FlapThreshold:     3,
+	}
+}
+
+func consensusSnapshot(badOffset, badState, flapState string) NTPStats {
+	return NTPStats{Sources: []NTPSource{
+		{Name: "a", StatusIcon: "*", Reach: "377", EstOffset: "+10us", StdDev: "5us"},
+		{Name: "b", StatusIcon: "+", Reach: "377", EstOffset: "+12us", StdDev: "5us"},
+		{Name: "c", StatusIcon: "+", Reach: "377", EstOffset: "+8us", StdDev: "5us"},
+		{Name: "d", StatusIcon: "+", Reach: "377", EstOffset: "+11us", StdDev: "5us"},
+		{Name: "flappy", StatusIcon: flapState, Reach: "377", EstOffset: "+9us", StdDev: "5us"},
+		{Name: "bad", StatusIcon: badState, Reach: "377", EstOffset: badOffset, StdDev: "5us"},
+		{Name: "lossy", StatusIcon: "-", Reach: "375", EstOffset: "+10us", StdDev: "5us"},
+	}}
+}
+
+func TestOutlierDetectorRanksProblems(t *testing.T) {
+	d := newOutlierDetector(outlierConfig())
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	flap := []string{"+", "-", "+", "-", "+"}
+	for i := 0; i < 5; i++ {
+		d.Observe(consensusSnapshot("+2ms", "x", flap[i]), t0.Add(time.Duration(i)*time.Minute))
+	}
+
+	problems := d.Problems()
+	byName := make(map[string]ProblemSource)
+	for _, p := range problems {
+		byName[p.Name] = p
+	}
+	for _, healthy := range []string{"a", "b", "c", "d"} {
+		if p, ok := byName[healthy]; ok {
+			t.Errorf("%s should not be a problem: %v", healthy, p.Reasons)
+		}
+	}
+
+	if len(problems) == 0 || problems[0].Name != "bad" {
+		t.Fatalf("expected the falseticker ranked first, got %+v", problems)
+	}
+	bad := problems[0]
+	if bad.OutlierFraction != 1 || !bad.Scored || bad.Deviation < 3.5 || len(bad.Reasons) != 3 {
+		t.Errorf("unexpected assessment of bad source: %+v", bad)
+	}
+
+	flappy, ok := byName["flappy"]
+	if !ok || flappy.SelectionFlaps != 4 {
+		t.Errorf("expected 4 selection flaps, got %+v", flappy)
+	}
+	lossy, ok := byName["lossy"]
+	if !ok || lossy.ReachMissed != 1 {
+		t.Errorf("expected one missed poll, got %+v", lossy)
+	}
+}
+
+func TestOutlierDetectorReachDrops(t *testing.T) {
+	d := newOutlierDetector(outlierConfig())
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	reach := []string{"377", "0", "1", "0"}
+	for i, r := range reach {
+		d.Observe(NTPStats{Sources: []NTPSource{{Name: "gone", StatusIcon: "?", Reach: r}}}, t0.Add(time.Duration(i)*time.Minute))
+	}
+	p := d.Problems()
+	if len(p) != 1 || p[0].ReachDrops != 2 || p[0].Reasons[len(p[0].Reasons)-1] != "unreachable" {
+		t.Errorf("expected two drops to zero and unreachable, got %+v", p)
+	}
+
+	// A failed collection keeps the history
+	d.Observe(NTPStats{Err: errors.New("chronyc sources: timeout")}, t0.Add(30*time.Minute))
+	if len(d.Problems()) != 1 {
+		t.Error("expected history to survive a failed collection")
+	}
+
+	// Sources that leave the configuration are forgotten
+	d.Observe(NTPStats{Sources: []NTPSource{{Name: "new", StatusIcon: "*", Reach: "377"}}}, t0.Add(time.Hour))
+	if p := d.Problems(); len(p) != 0 {
+		t.Error("expected removed source to be dropped")
+	}
+}
+
+func TestParseChronyDuration(t *testing.T) {
+	cases := map[string]float64{"+61us": 61e-6, "-1234ns": -1234e-9, "2ms": 2e-3, "1.5s": 1.5}
+	for in, want := range cases {
+		got, ok := parseChronyDuration(in)
+		if !ok || !closeTo(got, want, 1e-12) {
+			t.Errorf("parseChronyDuration(%q) = %v, %v", in, got, ok)
+		}
+	}
+	if _, ok := parseChronyDuration("-"); ok {
+		t.Error("expected '-' to be rejected")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// promRangeFunc runs a Prometheus query_range; start and end are Unix
+// seconds and step is in seconds, as in the HTTP API
+type promRangeFunc func(ctx context.Context, query, start, end, step string) ([]timedValue, error)
+
+// promCache sits in front of query_range. Results are keyed by query,
+// step and the length of the range rather than its exact ends, so every
+// browser asking for the same chart within the TTL shares one query, and
+// concurrent misses for a key wait for a single upstream call.
+type promCache struct {
+	fetch promRangeFunc
+	now   func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]promEntry
+	inflight map[string]*promCall
+}
+
+type promEntry struct {
+	values  []timedValue
+	expires time.Time
+}
+
+// promCall is a query_range in progress that later callers wait on
+type promCall struct {
+	done   chan struct{}
+	values []timedValue
+	err    error
+}
+
+// promCacheMaxEntries bounds the cache; the charts, stability and export
+// views need a few dozen keys at most
+const promCacheMaxEntries = 256
+
+func newPromCache(fetch promRangeFunc) *promCache {
+	return &promCache{
+		fetch:    fetch,
+		now:      time.Now,
+		entries:  map[string]promEntry{},
+		inflight: map[string]*promCall{},
+	}
+}
+
+// promCacheTTL is how long a range stays cached: about one chart point
+// (a 288th of the range), between 10 seconds and 10 minutes
+func promCacheTTL(span time.Duration) time.Duration {
+	return min(max(span/288, 10*time.Second), 10*time.Minute)
+}
+
+// Get returns the cached result for the query or fetches it. The returned
+// slice is the caller's own.
+func (c *promCache) Get(ctx context.Context, query, start, end, step string) ([]timedValue, error) {
+	s, _ := strconv.ParseInt(start, 10, 64)
+	e, _ := strconv.ParseInt(end, 10, 64)
+	span := time.Duration(e-s) * time.Second
+	key := query + "\x00" + step + "\x00" + span.String()
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && c.now().Before(entry.expires) {
+		c.mu.Unlock()
+		selfMetrics.PromCache("hit")
+		return slices.Clone(entry.values), nil
+	}
+	call, ok := c.inflight[key]
+	if ok {
+		selfMetrics.PromCache("shared")
+	} else {
+		selfMetrics.PromCache("miss")
+		call = &promCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		// the shared call must not fail because the first caller went away
+		go c.run(context.WithoutCancel(ctx), key, call, query, start, end, step, promCacheTTL(span))
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return slices.Clone(call.values), call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *promCache) run(ctx context.Context, key string, call *promCall, query, start, end, step string, ttl time.Duration) {
+	began := time.Now()
+	call.values, call.err = c.fetch(ctx, query, start, end, step)
+	selfMetrics.ObservePromQuery(time.Since(began), call.err)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	// errors are not cached, so the next request retries
+	if call.err == nil {
+		now := c.now()
+		if len(c.entries) >= promCacheMaxEntries {
+			for k, entry := range c.entries {
+				if !now.Before(entry.expires) {
+					delete(c.entries, k)
+				}
+			}
+			if len(c.entries) >= promCacheMaxEntries {
+				c.entries = map[string]promEntry{}
+			}
+		}
+		c.entries[key] = promEntry{values: call.values, expires: now.Add(ttl)}
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
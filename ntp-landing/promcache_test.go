@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPromCacheTTL(t *testing.T) {
+	for span, want := range map[time.Duration]time.Duration{
+		time.Hour:           12500 * time.Millisecond,
+		15 * time.Minute:    10 * time.Second,
+		24 * time.Hour:      5 * time.Minute,
+		30 * 24 * time.Hour: 10 * time.Minute,
+	} {
+		if got := promCacheTTL(span); got != want {
+			t.Errorf("ttl(%s) = %s, want %s", span, got, want)
+		}
+	}
+}
+
+func TestPromCacheCoalesces(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := newPromCache(func(ctx context.Context, query, start, end, step string) ([]timedValue, error) {
+		calls.Add(1)
+		<-release
+		return []timedValue{{time.Unix(1, 0), 1}}, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([][]timedValue, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = c.Get(context.Background(), "up", "0", "3600", "30")
+		}()
+	}
+	// let every caller find the call in flight before it completes
+	for {
+		c.mu.Lock()
+		n := len(c.inflight)
+		c.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("%d upstream calls for identical requests", calls.Load())
+	}
+	for i, r := range results {
+		if len(r) != 1 || r[0].v != 1 {
+			t.Errorf("caller %d got %v", i, r)
+		}
+	}
+	results[0][0].v = 99
+	if r, _ := c.Get(context.Background(), "up", "0", "3600", "30"); r[0].v != 1 {
+		t.Error("callers share the cached slice")
+	}
+}
+
+func TestPromCacheExpiry(t *testing.T) {
+	var calls atomic.Int32
+	fail := false
+	c := newPromCache(func(ctx context.Context, query, start, end, step string) ([]timedValue, error) {
+		calls.Add(1)
+		if fail {
+			return nil, errors.New("prometheus down")
+		}
+		return nil, nil
+	})
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	get := func(end int) error {
+		_, err := c.Get(context.Background(), "up", strconv.Itoa(end-3600), strconv.Itoa(end), "30")
+		return err
+	}
+
+	get(1000000)
+	// a later request for the same range length is answered from the cache
+	now = now.Add(10 * time.Second)
+	get(1000010)
+	if calls.Load() != 1 {
+		t.Fatalf("cache missed within the TTL: %d calls", calls.Load())
+	}
+	now = now.Add(5 * time.Second)
+	fail = true
+	if get(1000015) == nil || calls.Load() != 2 {
+		t.Fatalf("expired entry not refetched: %d calls", calls.Load())
+	}
+	// errors are not cached
+	fail = false
+	if err := get(1000015); err != nil || calls.Load() != 3 {
+		t.Errorf("error was cached: %v, %d calls", err, calls.Load())
+	}
+}
+
+func TestPromCacheCallerCancel(t *testing.T) {
+	release := make(chan struct{})
+	c := newPromCache(func(ctx context.Context, query, start, end, step string) ([]timedValue, error) {
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return []timedValue{{time.Unix(1, 0), 1}}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, "up", "0", "3600", "30"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller got %v", err)
+	}
+	close(release)
+	// the shared call finished for the callers still waiting and was cached
+	if r, err := c.Get(context.Background(), "up", "0", "3600", "30"); err != nil || len(r) != 1 {
+		t.Errorf("after cancel: %v %v", r, err)
+	}
+}
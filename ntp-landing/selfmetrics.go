@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"landing/metrics"
+)
+
+// instruments are the landing page's own metrics: how it serves requests
+// and how the chronyc and Prometheus calls behind them behave
+type instruments struct {
+	start time.Time
+
+	requests *metrics.Requests
+
+	mu              sync.Mutex
+	chronycSeconds  map[string]*metrics.Histogram // by command
+	chronycFailures map[string]uint64
+	promSeconds     *metrics.Histogram
+	promErrors      uint64
+	promCache       map[string]uint64 // hit, miss or shared
+	snapshotUpdated func() time.Time
+}
+
+var selfMetrics = newInstruments()
+
+func newInstruments() *instruments {
+	return &instruments{
+		start:           time.Now(),
+		requests:        metrics.NewRequests(),
+		chronycSeconds:  map[string]*metrics.Histogram{},
+		chronycFailures: map[string]uint64{},
+		promSeconds:     metrics.NewHistogram(metrics.LatencyBuckets),
+		promCache:       map[string]uint64{},
+	}
+}
+
+func (in *instruments) ObserveChronyc(command string, d time.Duration, err error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	h, ok := in.chronycSeconds[command]
+	if !ok {
+		h = metrics.NewHistogram(metrics.LatencyBuckets)
+		in.chronycSeconds[command] = h
+	}
+	h.Observe(d.Seconds())
+	if err != nil {
+		in.chronycFailures[command]++
+	}
+}
+
+func (in *instruments) ObservePromQuery(d time.Duration, err error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.promSeconds.Observe(d.Seconds())
+	if err != nil {
+		in.promErrors++
+	}
+}
+
+// PromCache counts a promCache lookup: hit, miss or shared (joined a
+// query already in flight)
+func (in *instruments) PromCache(result string) {
+	in.mu.Lock()
+	in.promCache[result]++
+	in.mu.Unlock()
+}
+
+// Snapshot tells the metrics where to find the collector's last snapshot time
+func (in *instruments) Snapshot(updated func() time.Time) {
+	in.mu.Lock()
+	in.snapshotUpdated = updated
+	in.mu.Unlock()
+}
+
+// Middleware records every request under the ServeMux pattern that serves
+// it, which keeps the route label bounded
+func (in *instruments) Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return in.requests.Middleware(mux, next)
+}
+
+// Write emits the metrics in a stable order
+func (in *instruments) Write(m *metrics.Writer, now time.Time) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.requests.Write(m, "ntp_landing")
+
+	for _, cmd := range metrics.SortedKeys(in.chronycSeconds) {
+		m.Histogram("ntp_landing_chronyc_duration_seconds", "Run time of chronyc commands.", in.chronycSeconds[cmd], "command", cmd)
+	}
+	for _, cmd := range metrics.SortedKeys(in.chronycSeconds) {
+		m.Counter("ntp_landing_chronyc_failures_total", "chronyc commands that failed or timed out.", float64(in.chronycFailures[cmd]), "command", cmd)
+	}
+
+	m.Histogram("ntp_landing_prometheus_query_duration_seconds", "Time of Prometheus query_range calls that missed the cache.", in.promSeconds)
+	m.Counter("ntp_landing_prometheus_query_errors_total", "Prometheus query_range calls that failed.", float64(in.promErrors))
+	for _, result := range []string{"hit", "miss", "shared"} {
+		m.Counter("ntp_landing_prometheus_cache_requests_total", "Query cache lookups by result; shared joined a query in flight.", float64(in.promCache[result]), "result", result)
+	}
+
+	age := -1.0
+	if in.snapshotUpdated != nil {
+		if t := in.snapshotUpdated(); !t.IsZero() {
+			age = now.Sub(t).Seconds()
+		}
+	}
+	m.Gauge("ntp_landing_snapshot_age_seconds", "Age of the collector's last chrony snapshot, -1 before the first.", age)
+
+	metrics.WriteRuntime(m, in.start)
+}
+
+// chronycOutput runs a read-only chronyc command and records its latency
+// and failures under the command name, without leading options
+func chronycOutput(ctx context.Context, args ...string) ([]byte, error) {
+	command := args[0]
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			command = a
+			break
+		}
+	}
+	start := time.Now()
+	out, err := exec.CommandContext(ctx, "chronyc", args...).Output()
+	selfMetrics.ObserveChronyc(command, time.Since(start), err)
+	return out, err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/metrics"
+)
+
+func TestInstrumentsWrite(t *testing.T) {
+	in := newInstruments()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/charts", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	h := in.Middleware(mux, mux)
+	for _, path := range []string{"/api/v1/charts?range=7d", "/api/v1/charts?range=30d", "/admin", "/no/such/page"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	in.ObserveChronyc("tracking", 30*time.Millisecond, nil)
+	in.ObserveChronyc("tracking", 3*time.Second, errors.New("signal: killed"))
+	in.ObservePromQuery(200*time.Millisecond, nil)
+	in.PromCache("hit")
+	updated := time.Unix(1700000000, 0)
+	in.Snapshot(func() time.Time { return updated })
+
+	var buf bytes.Buffer
+	in.Write(metrics.NewWriter(&buf), updated.Add(45*time.Second))
+	out := buf.String()
+	for _, want := range []string{
+		`ntp_landing_http_requests_total{route="/api/v1/charts",method="GET",code="200"} 2`,
+		`ntp_landing_http_requests_total{route="/admin",method="GET",code="403"} 1`,
+		`ntp_landing_http_requests_total{route="unmatched",method="GET",code="404"} 1`,
+		`ntp_landing_http_request_duration_seconds_count{route="/api/v1/charts"} 2`,
+		"# TYPE ntp_landing_http_request_duration_seconds histogram\n",
+		`ntp_landing_chronyc_duration_seconds_bucket{command="tracking",le="0.05"} 1`,
+		`ntp_landing_chronyc_duration_seconds_bucket{command="tracking",le="5"} 2`,
+		`ntp_landing_chronyc_duration_seconds_bucket{command="tracking",le="+Inf"} 2`,
+		`ntp_landing_chronyc_duration_seconds_sum{command="tracking"} 3.03`,
+		`ntp_landing_chronyc_failures_total{command="tracking"} 1`,
+		`ntp_landing_prometheus_query_duration_seconds_bucket{le="0.25"} 1`,
+		"ntp_landing_prometheus_query_errors_total 0\n",
+		`ntp_landing_prometheus_cache_requests_total{result="hit"} 1`,
+		"ntp_landing_snapshot_age_seconds 45\n",
+		"# TYPE go_goroutines gauge\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	if n := strings.Count(out, "# HELP ntp_landing_chronyc_duration_seconds "); n != 1 {
+		t.Errorf("expected one HELP line per histogram, got %d", n)
+	}
+	if strings.Contains(out, "# TYPE ntp_landing_chronyc_duration_seconds_bucket") {
+		t.Error("histogram series got their own HELP/TYPE lines")
+	}
+}
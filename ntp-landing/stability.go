@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// StabilityPoint holds the deviations at one averaging time
+type StabilityPoint struct {
+	Tau  float64 `json:"tau"`
+	ADEV float64 `json:"adev"`
+	MDEV float64 `json:"mdev"`
+	TDEV float64 `json:"tdev"`
+	N    int     `json:"n"`
+}
+
+// StabilityReport is the response of /api/stability
+type StabilityReport struct {
+	Range   string           `json:"range"`
+	Backend string           `json:"backend"`
+	Tau0    float64          `json:"tau0"`
+	Samples int              `json:"samples"`
+	Points  []StabilityPoint `json:"points"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// stabilityRanges are the ranges the analysis is offered for. Short ranges
+// have too few octaves of tau to be useful.
+var stabilityRanges = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// maxStabilitySamples keeps query_range below Prometheus's 11000 point
+// limit per series.
+const maxStabilitySamples = 10000
+
+// loadStability computes ADEV/MDEV/TDEV of the system clock offset over a
+// range, using Prometheus when it answers and chrony's tracking.log
+// otherwise.
+func loadStability(ctx context.Context, cfg Config, rangeName string) StabilityReport {
+	dur, ok := stabilityRanges[rangeName]
+	if !ok {
+		rangeName = "7d"
+		dur = stabilityRanges[rangeName]
+	}
+	rep := StabilityReport{Range: rangeName}
+	now := time.Now()
+
+	step := dur / maxStabilitySamples
+	if step < 15*time.Second {
+		step = 15 * time.Second
+	}
+	step = step.Round(time.Second)
+
+	query := `node_timex_offset_seconds{instance="ntp.alpina:9100"}`
+	values, err := fetchPromRange(ctx, query,
+		fmt.Sprintf("%d", now.Add(-dur).Unix()), fmt.Sprintf("%d", now.Unix()),
+		fmt.Sprintf("%d", int(step.Seconds())))
+	if err == nil && len(values) > 0 {
+		rep.Backend = "prometheus"
+	} else {
+		logs := chronyLogReader{dir: cfg.ChronyLogDir}
+		values = nil
+		for _, rec := range logs.tracking(now.Add(-dur)) {
+			values = append(values, timedValue{rec.Time, rec.Offset})
+		}
+		rep.Backend = "chrony-logs"
+	}
+
+	// tau0 is never shorter than the interval the offsets were really
+	// sampled at: chrony logs tracking every poll, a minute or more apart,
+	// and phase interpolated between those samples would make the short-tau
+	// deviations look better than the clock is
+	step = max(step, sampleInterval(values).Round(time.Second))
+	phase := resamplePhase(values, step)
+	rep.Tau0 = step.Seconds()
+	rep.Samples = len(phase)
+	rep.Points = stabilityCurve(phase, rep.Tau0)
+	if len(rep.Points) == 0 {
+		rep.Error = "not enough offset history for stability analysis"
+	}
+	return rep
+}
+
+// sampleInterval is the median spacing of the samples, the interval they
+// were taken at once occasional gaps are discounted
+func sampleInterval(samples []timedValue) time.Duration {
+	times := make([]time.Time, len(samples))
+	for i, s := range samples {
+		times[i] = s.t
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	var gaps []time.Duration
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d > 0 {
+			gaps = append(gaps, d)
+		}
+	}
+	if len(gaps) == 0 {
+		return 0
+	}
+	slices.Sort(gaps)
+	return gaps[len(gaps)/2]
+}
+
+// resamplePhase puts irregular offset samples (seconds) onto a uniform grid
+// of the given step by averaging within each step. Empty steps are filled
+// by linear interpolation so the deviations see evenly spaced phase data.
+func resamplePhase(samples []timedValue, step time.Duration) []float64 {
+	if len(samples) == 0 {
+		return nil
+	}
+	t0 := samples[0].t.Truncate(step)
+	for _, s := range samples {
+		if s.t.Before(t0) {
+			t0 = s.t.Truncate(step)
+		}
+	}
+	var last time.Time
+	for _, s := range samples {
+		if s.t.After(last) {
+			last = s.t
+		}
+	}
+	n := int(last.Sub(t0)/step) + 1
+	sum := make([]float64, n)
+	cnt := make([]int, n)
+	for _, s := range samples {
+		i := int(s.t.Sub(t0) / step)
+		sum[i] += s.v
+		cnt[i]++
+	}
+
+	phase := make([]float64, n)
+	prev := -1
+	for i := 0; i < n; i++ {
+		if cnt[i] == 0 {
+			continue
+		}
+		phase[i] = sum[i] / float64(cnt[i])
+		if prev >= 0 && i-prev > 1 {
+			for j := prev + 1; j < i; j++ {
+				frac := float64(j-prev) / float64(i-prev)
+				phase[j] = phase[prev] + frac*(phase[i]-phase[prev])
+			}
+		}
+		prev = i
+	}
+	// Trim leading/trailing gaps that could not be interpolated
+	first := 0
+	for first < n && cnt[first] == 0 {
+		first++
+	}
+	return phase[first : prev+1]
+}
+
+// stabilityCurve evaluates the deviations at octave-spaced averaging
+// factors m = 1, 2, 4, ... while enough samples remain for MDEV.
+func stabilityCurve(phase []float64, tau0 float64) []StabilityPoint {
+	var pts []StabilityPoint
+	for m := 1; 3*m < len(phase); m *= 2 {
+		adev, n := allanDeviation(phase, m, tau0)
+		mdev := modifiedAllanDeviation(phase, m, tau0)
+		tau := float64(m) * tau0
+		pts = append(pts, StabilityPoint{
+			Tau:  tau,
+			ADEV: adev,
+			MDEV: mdev,
+			TDEV: tau / math.Sqrt(3) * mdev,
+			N:    n,
+		})
+	}
+	return pts
+}
+
+// allanDeviation is the overlapping Allan deviation of phase data x
+// (seconds, spacing tau0) at tau = m*tau0:
+//
+//	σy²(τ) = Σ (x[i+2m] - 2x[i+m] + x[i])² / (2 τ² (N-2m))
+func allanDeviation(x []float64, m int, tau0 float64) (float64, int) {
+	n := len(x) - 2*m
+	if n < 1 {
+		return 0, 0
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		d := x[i+2*m] - 2*x[i+m] + x[i]
+		sum += d * d
+	}
+	tau := float64(m) * tau0
+	return math.Sqrt(sum / (2 * tau * tau * float64(n))), n
+}
+
+// modifiedAllanDeviation is the modified Allan deviation at tau = m*tau0:
+//
+//	Mod σy²(τ) = Σj (Σi=j..j+m-1 x[i+2m] - 2x[i+m] + x[i])² / (2 m² τ² (N-3m+1))
+func modifiedAllanDeviation(x []float64, m int, tau0 float64) float64 {
+	n := len(x) - 3*m + 1
+	if n < 1 {
+		return 0
+	}
+	// Sliding inner sum keeps this O(N) per tau
+	var inner float64
+	for i := 0; i < m; i++ {
+		inner += x[i+2*m] - 2*x[i+m] + x[i]
+	}
+	sum := inner * inner
+	for j := 1; j < n; j++ {
+		inner += x[j+3*m-1] - 2*x[j+2*m-1] + x[j+m-1]
+		inner -= x[j+2*m-1] - 2*x[j+m-1] + x[j-1]
+		sum += inner * inner
+	}
+	tau := float64(m) * tau0
+	return math.Sqrt(sum / (2 * float64(m*m) * tau * tau * float64(n)))
+}
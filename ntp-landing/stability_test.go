@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func closeTo(a, b, rel float64) bool {
+	if b == 0 {
+		return math.Abs(a) < 1e-18
+	}
+	return math.Abs(a-b)/math.Abs(b) < rel
+}
+
+func TestStabilityConstantFrequency(t *testing.T) {
+	// A pure frequency offset is a phase ramp, which both deviations remove
+	x := make([]float64, 100)
+	for i := range x {
+		x[i] = 1e-6 * float64(i)
+	}
+	for _, p := range stabilityCurve(x, 1) {
+		if p.ADEV > 1e-18 || p.MDEV > 1e-18 {
+			t.Errorf("tau %v: expected zero deviation for a phase ramp, got %v / %v", p.Tau, p.ADEV, p.MDEV)
+		}
+	}
+}
+
+func TestStabilityFrequencyDrift(t *testing.T) {
+	// x = a t²/2 has constant second difference a τ², so
+	// ADEV = MDEV = a τ / √2 at every tau
+	const a = 1e-9
+	tau0 := 10.0
+	x := make([]float64, 200)
+	for i := range x {
+		ti := float64(i) * tau0
+		x[i] = a * ti * ti / 2
+	}
+	pts := stabilityCurve(x, tau0)
+	if len(pts) == 0 {
+		t.Fatal("no stability points")
+	}
+	for _, p := range pts {
+		want := a * p.Tau / math.Sqrt2
+		if !closeTo(p.ADEV, want, 1e-9) || !closeTo(p.MDEV, want, 1e-9) {
+			t.Errorf("tau %v: ADEV %v MDEV %v, want %v", p.Tau, p.ADEV, p.MDEV, want)
+		}
+		if !closeTo(p.TDEV, p.Tau/math.Sqrt(3)*p.MDEV, 1e-12) {
+			t.Errorf("tau %v: TDEV %v inconsistent with MDEV", p.Tau, p.TDEV)
+		}
+	}
+	// Octave spacing up to N/3
+	if pts[0].Tau != tau0 || pts[1].Tau != 2*tau0 || pts[len(pts)-1].Tau != 64*tau0 {
+		t.Errorf("unexpected tau grid: first %v last %v", pts[0].Tau, pts[len(pts)-1].Tau)
+	}
+}
+
+func TestStabilityMDEVEqualsADEVAtTau0(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	x := make([]float64, 500)
+	for i := range x {
+		x[i] = rng.NormFloat64() * 1e-6
+	}
+	adev, _ := allanDeviation(x, 1, 1)
+	mdev := modifiedAllanDeviation(x, 1, 1)
+	if !closeTo(adev, mdev, 1e-12) {
+		t.Errorf("at m=1 MDEV should equal ADEV: %v vs %v", mdev, adev)
+	}
+
+	// The sliding inner sum must match the direct definition
+	m := 7
+	var sum float64
+	n := len(x) - 3*m + 1
+	for j := 0; j < n; j++ {
+		var inner float64
+		for i := j; i < j+m; i++ {
+			inner += x[i+2*m] - 2*x[i+m] + x[i]
+		}
+		sum += inner * inner
+	}
+	tau := float64(m)
+	direct := math.Sqrt(sum / (2 * float64(m*m) * tau * tau * float64(n)))
+	if got := modifiedAllanDeviation(x, m, 1); !closeTo(got, direct, 1e-9) {
+		t.Errorf("sliding MDEV %v != direct %v", got, direct)
+	}
+}
+
+func TestResamplePhase(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []timedValue{
+		{t0.Add(1 * time.Second), 1},
+		{t0.Add(5 * time.Second), 3},
+		{t0.Add(31 * time.Second), 10},
+		{t0.Add(45 * time.Second), 20},
+	}
+	got := resamplePhase(samples, 10*time.Second)
+	// buckets 1 and 2 are empty and interpolated between 2 and 10
+	want := []float64{2, 2 + 8.0/3, 2 + 16.0/3, 10, 20}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if !closeTo(got[i], want[i], 1e-12) {
+			t.Errorf("phase[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSampleIntervalSetsTau0(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var samples []timedValue
+	at := t0
+	for i := range 200 {
+		// chrony's tracking.log: about one line per 64 s poll, with jitter
+		// and the odd missed update
+		gap := 64*time.Second + time.Duration(i%5)*300*time.Millisecond
+		if i%50 == 49 {
+			gap *= 3
+		}
+		at = at.Add(gap)
+		samples = append(samples, timedValue{at, float64(i) * 1e-6})
+	}
+	got := sampleInterval(samples)
+	if got < 64*time.Second || got > 65*time.Second {
+		t.Fatalf("sampleInterval = %s, want about 64s", got)
+	}
+	// resampled at the native interval, no point is invented between two
+	// real samples except across the missed updates
+	phase := resamplePhase(samples, got.Round(time.Second))
+	if len(phase) > len(samples)+10 {
+		t.Errorf("%d phase points from %d samples", len(phase), len(samples))
+	}
+	if sampleInterval(samples[:1]) != 0 {
+		t.Error("one sample has no interval")
+	}
+}
@@ -0,0 +1,32 @@
+const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+const result = document.getElementById('result');
+
+document.querySelectorAll('form[data-op]').forEach(form => {
+    form.addEventListener('submit', async e => {
+        e.preventDefault();
+        const op = form.dataset.op;
+        const body = new URLSearchParams({op: op});
+        const target = form.querySelector('select[name="target"]');
+        if (target && target.value) body.set('target', target.value);
+        if (!confirm('Run ' + op + (body.get('target') ? ' on ' + body.get('target') : '') + '?')) return;
+
+        const button = form.querySelector('button');
+        button.disabled = true;
+        try {
+            const resp = await fetch('/api/admin/run', {
+                method: 'POST',
+                headers: {'X-CSRF-Token': csrfToken},
+                body: body,
+                credentials: 'same-origin'
+            });
+            const res = await resp.json();
+            result.className = res.ok ? 'ok' : 'fail';
+            result.textContent = op + (res.target ? ' ' + res.target : '') + ': ' + (res.ok ? (res.output || 'done') : res.error + (res.output ? '\n' + res.output : ''));
+        } catch (err) {
+            result.className = 'fail';
+            result.textContent = op + ': ' + err;
+        } finally {
+            button.disabled = false;
+        }
+    });
+});
@@ -0,0 +1,483 @@
+var pageData = JSON.parse(document.getElementById('page-data').textContent);
+var initialCharts = pageData.charts;
+var cpuData = pageData.cpu;
+var memData = pageData.mem;
+
+var chartInstances = {};
+
+function createGradient(ctx, color) {
+    var gradient = ctx.createLinearGradient(0, 0, 0, 200);
+    gradient.addColorStop(0, color.replace("1)", "0.3)").replace("rgb", "rgba"));
+    gradient.addColorStop(1, color.replace("1)", "0.01)").replace("rgb", "rgba"));
+    return gradient;
+}
+
+function hexToRgba(hex, alpha) {
+    var r = parseInt(hex.slice(1, 3), 16);
+    var g = parseInt(hex.slice(3, 5), 16);
+    var b = parseInt(hex.slice(5, 7), 16);
+    return "rgba(" + r + "," + g + "," + b + "," + alpha + ")";
+}
+
+function makeGradientFill(ctx, hex) {
+    var gradient = ctx.createLinearGradient(0, 0, 0, 200);
+    gradient.addColorStop(0, hexToRgba(hex, 0.3));
+    gradient.addColorStop(1, hexToRgba(hex, 0.01));
+    return gradient;
+}
+
+function createChart(canvasId, label, data, color, stepped, events) {
+    var canvas = document.getElementById(canvasId);
+    if (!canvas) return null;
+    var ctx = canvas.getContext("2d");
+
+    if (chartInstances[canvasId]) {
+        chartInstances[canvasId].destroy();
+    }
+
+    var labels = [];
+    var values = [];
+    if (data && data.length) {
+        for (var i = 0; i < data.length; i++) {
+            labels.push(data[i].time);
+            values.push(data[i].value);
+        }
+    }
+
+    var gradientFill = makeGradientFill(ctx, color);
+
+    var config = {
+        type: "line",
+        data: {
+            labels: labels,
+            datasets: [{
+                label: label,
+                data: values,
+                borderColor: color,
+                backgroundColor: gradientFill,
+                fill: true,
+                tension: stepped ? 0 : 0.3,
+                pointRadius: 0,
+                borderWidth: 2,
+                stepped: stepped ? "middle" : false
+            }]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            plugins: {
+                legend: { display: false }
+            },
+            scales: {
+                x: {
+                    ticks: { color: "#475569", maxTicksLimit: 8, font: { size: 10 } },
+                    grid: { color: "rgba(255,255,255,0.05)" }
+                },
+                y: {
+                    ticks: { color: "#475569", font: { size: 10 } },
+                    grid: { color: "rgba(255,255,255,0.05)" }
+                }
+            },
+            interaction: {
+                intersect: false,
+                mode: "index"
+            }
+        }
+    };
+
+    if (events && events.length) {
+        config.plugins = [eventMarkers(events)];
+        config.options.plugins.tooltip = { callbacks: { afterBody: eventTooltip(events, labels.length) } };
+    }
+
+    chartInstances[canvasId] = new Chart(ctx, config);
+    return chartInstances[canvasId];
+}
+
+function createErrorChart(canvasId, maxErrData, estErrData) {
+    var canvas = document.getElementById(canvasId);
+    if (!canvas) return null;
+    var ctx = canvas.getContext("2d");
+
+    if (chartInstances[canvasId]) {
+        chartInstances[canvasId].destroy();
+    }
+
+    var labels = [];
+    var maxVals = [];
+    var estVals = [];
+
+    var src = maxErrData && maxErrData.length ? maxErrData : estErrData;
+    if (src && src.length) {
+        for (var i = 0; i < src.length; i++) {
+            labels.push(src[i].time);
+        }
+    }
+    if (maxErrData && maxErrData.length) {
+        for (var i = 0; i < maxErrData.length; i++) {
+            maxVals.push(maxErrData[i].value);
+        }
+    }
+    if (estErrData && estErrData.length) {
+        for (var i = 0; i < estErrData.length; i++) {
+            estVals.push(estErrData[i].value);
+        }
+    }
+
+    var maxGrad = makeGradientFill(ctx, "#f59e0b");
+    var estGrad = makeGradientFill(ctx, "#ef4444");
+
+    var config = {
+        type: "line",
+        data: {
+            labels: labels,
+            datasets: [
+                {
+                    label: "Max Error",
+                    data: maxVals,
+                    borderColor: "#f59e0b",
+                    backgroundColor: maxGrad,
+                    fill: true,
+                    tension: 0.3,
+                    pointRadius: 0,
+                    borderWidth: 2
+                },
+                {
+                    label: "Est Error",
+                    data: estVals,
+                    borderColor: "#ef4444",
+                    backgroundColor: estGrad,
+                    fill: true,
+                    tension: 0.3,
+                    pointRadius: 0,
+                    borderWidth: 2
+                }
+            ]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            plugins: {
+                legend: {
+                    display: true,
+                    labels: { color: "#94a3b8", font: { size: 10 } }
+                }
+            },
+            scales: {
+                x: {
+                    ticks: { color: "#475569", maxTicksLimit: 8, font: { size: 10 } },
+                    grid: { color: "rgba(255,255,255,0.05)" }
+                },
+                y: {
+                    ticks: { color: "#475569", font: { size: 10 } },
+                    grid: { color: "rgba(255,255,255,0.05)" }
+                }
+            },
+            interaction: { intersect: false, mode: "index" }
+        }
+    };
+
+    chartInstances[canvasId] = new Chart(ctx, config);
+    return chartInstances[canvasId];
+}
+
+var backendLabels = {
+    "prometheus": "Source: Sentinella Prometheus",
+    "adjtimex": "Source: in-memory adjtimex samples (Prometheus unavailable)",
+    "chrony-logs": "Source: local chrony logs (Prometheus unavailable)"
+};
+
+function renderBackend(backend) {
+    var el = document.getElementById("chartBackend");
+    if (!el) return;
+    el.textContent = backendLabels[backend] || "";
+    el.className = "chart-backend" + (backend && backend !== "prometheus" ? " fallback" : "");
+}
+
+var eventColors = { info: "#3b82f6", warning: "#f59e0b", critical: "#ef4444" };
+
+// Draws stored events as vertical markers; position is the event's
+// fraction of the chart's time range.
+function eventMarkers(events) {
+    return {
+        id: "eventMarkers",
+        afterDatasetsDraw: function(chart) {
+            if (!events || !events.length) return;
+            var area = chart.chartArea;
+            var ctx = chart.ctx;
+            ctx.save();
+            for (var i = 0; i < events.length; i++) {
+                var x = area.left + events[i].position * (area.right - area.left);
+                ctx.strokeStyle = eventColors[events[i].severity] || eventColors.info;
+                ctx.globalAlpha = 0.7;
+                ctx.setLineDash([4, 3]);
+                ctx.beginPath();
+                ctx.moveTo(x, area.top);
+                ctx.lineTo(x, area.bottom);
+                ctx.stroke();
+            }
+            ctx.restore();
+        }
+    };
+}
+
+// Lists the events near the hovered point in the tooltip
+function eventTooltip(events, n) {
+    return function(items) {
+        if (!items.length) return "";
+        var pos = n > 1 ? items[0].dataIndex / (n - 1) : 0;
+        var lines = [];
+        for (var i = 0; i < events.length; i++) {
+            if (Math.abs(events[i].position - pos) <= 1 / Math.max(n, 1)) {
+                lines.push(events[i].time + " " + events[i].message);
+            }
+        }
+        return lines;
+    };
+}
+
+function renderCharts(data) {
+    renderBackend(data.backend);
+    createChart("chartOffset", "Clock Offset (us)", data.offset, "#3b82f6", false, data.events);
+    createChart("chartFreq", "Frequency Drift (ppm)", data.freq, "#8b5cf6", false);
+    createErrorChart("chartError", data.maxErr, data.estErr);
+    createChart("chartPLL", "PLL Time Constant", data.pll, "#06b6d4", true);
+}
+
+function updateCharts(range_) {
+    fetch("/api/v1/charts?range=" + range_)
+        .then(function(resp) { return resp.json(); })
+        .then(function(data) {
+            renderCharts(data);
+        });
+}
+
+function renderStability(report) {
+    var canvas = document.getElementById("chartStability");
+    if (!canvas) return;
+    var ctx = canvas.getContext("2d");
+    if (chartInstances["chartStability"]) {
+        chartInstances["chartStability"].destroy();
+    }
+
+    var label = document.getElementById("stabilityBackend");
+    if (label) {
+        if (report.error) {
+            label.textContent = report.error;
+            label.className = "chart-backend fallback";
+        } else {
+            label.textContent = (backendLabels[report.backend] || "") + " \u00b7 " + report.samples + " samples, \u03c40 = " + report.tau0 + " s";
+            label.className = "chart-backend" + (report.backend !== "prometheus" ? " fallback" : "");
+        }
+    }
+
+    var adev = [], mdev = [], tdev = [];
+    var pts = report.points || [];
+    for (var i = 0; i < pts.length; i++) {
+        if (pts[i].adev > 0) adev.push({ x: pts[i].tau, y: pts[i].adev });
+        if (pts[i].mdev > 0) mdev.push({ x: pts[i].tau, y: pts[i].mdev });
+        if (pts[i].tdev > 0) tdev.push({ x: pts[i].tau, y: pts[i].tdev });
+    }
+
+    function series(label, data, color, axis) {
+        return {
+            label: label, data: data, borderColor: color, backgroundColor: color,
+            showLine: true, pointRadius: 3, borderWidth: 2, yAxisID: axis
+        };
+    }
+
+    chartInstances["chartStability"] = new Chart(ctx, {
+        type: "scatter",
+        data: {
+            datasets: [
+                series("ADEV", adev, "#3b82f6", "y"),
+                series("MDEV", mdev, "#8b5cf6", "y"),
+                series("TDEV (s)", tdev, "#06b6d4", "y1")
+            ]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            plugins: { legend: { display: true, labels: { color: "#94a3b8", font: { size: 10 } } } },
+            scales: {
+                x: {
+                    type: "logarithmic",
+                    title: { display: true, text: "\u03c4 (s)", color: "#64748b" },
+                    ticks: { color: "#475569", font: { size: 10 } },
+                    grid: { color: "rgba(255,255,255,0.05)" }
+                },
+                y: {
+                    type: "logarithmic",
+                    title: { display: true, text: "\u03c3y(\u03c4)", color: "#64748b" },
+                    ticks: { color: "#475569", font: { size: 10 } },
+                    grid: { color: "rgba(255,255,255,0.05)" }
+                },
+                y1: {
+                    type: "logarithmic",
+                    position: "right",
+                    title: { display: true, text: "TDEV (s)", color: "#64748b" },
+                    ticks: { color: "#475569", font: { size: 10 } },
+                    grid: { drawOnChartArea: false }
+                }
+            }
+        }
+    });
+}
+
+function updateStability(range_) {
+    fetch("/api/v1/stability?range=" + range_)
+        .then(function(resp) { return resp.json(); })
+        .then(renderStability);
+}
+
+function createSmallChart(canvasId, data, color) {
+    var canvas = document.getElementById(canvasId);
+    if (!canvas) return null;
+    var ctx = canvas.getContext("2d");
+
+    var labels = [];
+    var values = [];
+    if (data && data.length) {
+        for (var i = 0; i < data.length; i++) {
+            labels.push(data[i].time);
+            values.push(data[i].value);
+        }
+    }
+
+    var gradientFill = makeGradientFill(ctx, color);
+
+    return new Chart(ctx, {
+        type: "line",
+        data: {
+            labels: labels,
+            datasets: [{
+                data: values,
+                borderColor: color,
+                backgroundColor: gradientFill,
+                fill: true,
+                tension: 0.3,
+                pointRadius: 0,
+                borderWidth: 1.5
+            }]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            plugins: { legend: { display: false } },
+            scales: {
+                x: {
+                    ticks: { color: "#475569", maxTicksLimit: 6, font: { size: 9 } },
+                    grid: { color: "rgba(255,255,255,0.03)" }
+                },
+                y: {
+                    ticks: { color: "#475569", font: { size: 9 } },
+                    grid: { color: "rgba(255,255,255,0.03)" }
+                }
+            }
+        }
+    });
+}
+
+function updateLogs(level) {
+    var box = document.getElementById("logLines");
+    if (!box) return;
+    var status = document.getElementById("logsStatus");
+    fetch("/api/v1/logs?level=" + level)
+        .then(function(resp) { return resp.json(); })
+        .then(function(data) {
+            box.textContent = "";
+            if (data.error) {
+                status.textContent = data.error;
+                status.className = "chart-backend fallback";
+                return;
+            }
+            status.textContent = data.lines.length + " lines \u00b7 Loki";
+            status.className = "chart-backend";
+            for (var i = 0; i < data.lines.length; i++) {
+                var l = data.lines[i];
+                var row = document.createElement("div");
+                row.className = "log-line lvl-" + l.level;
+                var ts = document.createElement("span");
+                ts.className = "log-time";
+                ts.textContent = new Date(l.time).toLocaleString();
+                row.appendChild(ts);
+                row.appendChild(document.createTextNode(l.line));
+                box.appendChild(row);
+            }
+            if (!data.lines.length) {
+                box.textContent = "No matching log lines.";
+            }
+        })
+        .catch(function(err) {
+            status.textContent = "logs unavailable: " + err;
+            status.className = "chart-backend fallback";
+        });
+}
+
+var logsTabs = document.querySelectorAll(".logs-tab");
+for (var i = 0; i < logsTabs.length; i++) {
+    logsTabs[i].addEventListener("click", function() {
+        for (var j = 0; j < logsTabs.length; j++) {
+            logsTabs[j].classList.remove("active");
+        }
+        this.classList.add("active");
+        updateLogs(this.getAttribute("data-level"));
+    });
+}
+
+// Initialize charts on load
+document.addEventListener("DOMContentLoaded", function() {
+    renderCharts(initialCharts);
+    createSmallChart("chartCPU", cpuData, "#3b82f6");
+    createSmallChart("chartMem", memData, "#8b5cf6");
+    updateStability("7d");
+    updateLogs("");
+});
+
+var stabilityTabs = document.querySelectorAll(".stability-tab");
+for (var i = 0; i < stabilityTabs.length; i++) {
+    stabilityTabs[i].addEventListener("click", function() {
+        for (var j = 0; j < stabilityTabs.length; j++) {
+            stabilityTabs[j].classList.remove("active");
+        }
+        this.classList.add("active");
+        updateStability(this.getAttribute("data-range"));
+    });
+}
+
+// Download links follow the selected chart range and data kind
+var exportRange = "24h";
+var exportData = document.getElementById("exportData");
+
+function updateExportLinks() {
+    var links = document.querySelectorAll(".chart-download");
+    for (var i = 0; i < links.length; i++) {
+        links[i].href = "/api/v1/export?data=" + exportData.value + "&range=" + exportRange +
+            "&format=" + links[i].getAttribute("data-format");
+    }
+}
+
+if (exportData) {
+    exportData.addEventListener("change", updateExportLinks);
+}
+
+// Tab click handler
+var tabs = document.querySelectorAll(".chart-tab");
+for (var i = 0; i < tabs.length; i++) {
+    tabs[i].addEventListener("click", function() {
+        for (var j = 0; j < tabs.length; j++) {
+            tabs[j].classList.remove("active");
+        }
+        this.classList.add("active");
+        updateCharts(this.getAttribute("data-range"));
+        exportRange = this.getAttribute("data-range");
+        if (exportData) {
+            updateExportLinks();
+        }
+    });
+}
+
+// Auto-refresh every 60 seconds
+setTimeout(function() {
+    window.location.reload();
+}, 60000);
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/netinfo"
+)
+
+// TestTemplateRenders executes the page template offline with every
+// optional panel populated, so template errors surface without a live host.
+func TestTemplateRenders(t *testing.T) {
+	tmpl, err := parsePageTemplate()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cfg := Config{NTSStaleAfter: 15 * time.Minute, NTSMinCookies: 2, NTSMaxAttempts: 1, NTSHistory: time.Hour}
+	tr := newNTSTracker(cfg)
+	tr.Observe(ntsSnapshot("30", "33m", "8", 0, false), time.Now())
+	tx := decodeTimex(timexRaw{Offset: 1200, Status: staPLL | staNano, Constant: 6, TAI: 37}, time.Now())
+
+	data := PageData{
+		NTP: NTPStats{
+			Synced:  true,
+			Sources: []NTPSource{{StatusIcon: "*", Name: "nts.example", NTS: true, Selected: true, ReachBits: reachToBits("377")}},
+		},
+		NTSHealth: tr.Health(),
+		Timex:     &tx,
+		Hardware:  readClockHardware("testdata/hw", time.Now()),
+		Problems: []ProblemSource{{
+			Name: "bad.example", Severity: 7, Deviation: 12, Scored: true, OutlierFraction: 1,
+			Reasons: []string{"chrony marks it a falseticker"},
+		}},
+		Events: []Event{{Time: time.Now(), Kind: "reach-lost", Severity: "warning", Source: "bad.example", Message: "bad.example became unreachable (reach 0)"}},
+		Logs:   true,
+		Network: netinfo.NetworkInfo{
+			Interfaces: []netinfo.NetInterface{{Name: "eth0", IPv4: []string{"172.16.16.108/16"}, IPv6: []netinfo.IPv6Addr{
+				{Address: "2603:8001:7400:fa9a:be24:11ff:fe60:2dfe", Prefix: 64, Scope: "global", Kind: "eui64"},
+				{Address: "2603:8001:7400:fa9a:3c1d:2e4f:5a6b:7c8d", Prefix: 64, Scope: "global", Kind: "temporary"},
+			}}},
+			Routes: []netinfo.DefaultRoute{{Family: "ipv6", Gateway: "fe80::a236:9fff:fe66:27ac", Interface: "eth0", Metric: 1024}},
+		},
+		ChartsJSON: `{"offset":[{"time":"12:00","value":1.5}]}`,
+		CPUJSON:    `[]`,
+		MemJSON:    `[]`,
+	}
+	data.Network.DNS = &netinfo.DNSCheck{Name: "ntp.alpina", AAAA: []string{"2603:8001:7400:fa9a:be24:11ff:fe60:2dfe"}, Match: true}
+	data.Hardware.ChronyRTC = &ChronyRTC{Offset: "-1.6 s"}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"nts.example", "Kernel Clock (adjtimex)", "STA_PLL", "Clock Hardware", "rtc_cmos", "health-ok", "bad.example", "falseticker", "sev-warning", "became unreachable", "Recent chronyd logs", "SLAAC EUI-64", "temporary", "via fe80::a236:9fff:fe66:27ac", "AAAA matches"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered page missing %q", want)
+		}
+	}
+
+	// landing.js reads the chart data from this block
+	_, block, _ := strings.Cut(out, `<script type="application/json" id="page-data">`)
+	block, _, _ = strings.Cut(block, "</script>")
+	var pageData struct {
+		Charts ChartDataSet `json:"charts"`
+	}
+	if err := json.Unmarshal([]byte(block), &pageData); err != nil || len(pageData.Charts.Offset) != 1 {
+		t.Errorf("page-data %q: %v", block, err)
+	}
+}
+
+func TestConfigTemplateRenders(t *testing.T) {
+	tmpl, err := parseConfigTemplate()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	conf := parseChronyConfig("testdata/chronyconf/chrony.conf")
+	data := ConfigPageData{
+		Config: conf,
+		Drift:  checkConfigDrift(conf, nil, nil),
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"time.cloudflare.com", "maxsources 2", "192.168.1.0/24", "hwtimestamp", "has never appeared", "dhcp.sources:1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered config page missing %q", want)
+		}
+	}
+}
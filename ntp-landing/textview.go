@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"landing/textview"
+)
+
+// sourceStateStyles colour chronyc's source state column
+var sourceStateStyles = map[string]string{
+	"*": textview.Green + textview.Bold, "+": textview.Cyan, "-": textview.Dim, "x": textview.Red, "?": textview.Red, "~": textview.Yellow,
+}
+
+// writeTextDashboard renders the landing page for a terminal: sync
+// status, the tracking values, the sources with their reach registers
+// and the host stats. Offsets above maxOffset are shown in red, like the
+// /status/ntp check.
+func writeTextDashboard(w io.Writer, data PageData, maxOffset time.Duration, ansi bool) {
+	p := textview.Painter(ansi)
+	ntp := data.NTP
+	row := func(label, value string) {
+		fmt.Fprintf(w, "  %s %s\n", p.Paint(textview.Dim, textview.Pad(label, 16)), value)
+	}
+
+	fmt.Fprintf(w, "%s  %s\n", p.Paint(textview.Bold+textview.Blue, "NTP "+data.System.Hostname), p.Paint(textview.Dim, data.UpdatedAt))
+	fmt.Fprintln(w)
+
+	if ntp.LeapStatus == "" {
+		row("Status", p.Paint(textview.Red+textview.Bold, "no tracking data from chronyd"))
+	} else {
+		if ntp.Synced {
+			row("Status", p.Paint(textview.Green+textview.Bold, "synchronised")+" (leap "+ntp.LeapStatus+")")
+		} else {
+			row("Status", p.Paint(textview.Red+textview.Bold, "NOT synchronised")+" (leap "+ntp.LeapStatus+")")
+		}
+		row("Reference", ntp.RefID+", stratum "+ntp.Stratum)
+		offsetStyle := textview.Green
+		if math.Abs(ntp.Offset) > maxOffset.Seconds() {
+			offsetStyle = textview.Red
+		}
+		row("System offset", p.Paint(offsetStyle, ntp.OffsetDisplay)+p.Paint(textview.Dim, "  last "+ntp.LastOffset+", RMS "+ntp.RMSOffset))
+		row("Frequency", ntp.FreqDisplay+p.Paint(textview.Dim, "  residual "+ntp.ResidualFreq+", skew "+ntp.Skew))
+		row("Root delay/disp", ntp.RootDelay+" / "+ntp.RootDisp)
+		row("Update interval", ntp.UpdateInt)
+	}
+	row("Sources", fmt.Sprintf("%d online of %d, %d NTS", ntp.OnlineSources, ntp.TotalSources, ntp.NTSCount))
+	fmt.Fprintln(w)
+
+	if len(ntp.Sources) > 0 {
+		nameWidth := len("Source")
+		for _, s := range ntp.Sources {
+			nameWidth = max(nameWidth, min(utf8.RuneCountInString(s.Name), 40))
+		}
+		fmt.Fprintf(w, "  %s\n", p.Paint(textview.Dim, fmt.Sprintf("S %s %-4s %2s %4s %-8s %6s  %s", textview.Pad("Source", nameWidth), "Auth", "St", "Poll", "Reach", "LastRx", "Offset")))
+		for _, s := range ntp.Sources {
+			var reach strings.Builder
+			for _, bit := range s.ReachBits {
+				if bit == "1" {
+					reach.WriteString(p.Paint(textview.Green, "|"))
+				} else {
+					reach.WriteString(p.Paint(textview.Red, "."))
+				}
+			}
+			auth := "-   "
+			if s.NTS {
+				auth = p.Paint(textview.Cyan, "NTS ")
+			}
+			name := p.Paint(map[bool]string{true: textview.Bold}[s.Selected], textview.Pad(s.Name, nameWidth))
+			fmt.Fprintf(w, "  %s %s %s %2s %4s %s %6s  %s\n",
+				p.Paint(sourceStateStyles[s.StatusIcon], textview.Pad(s.StatusIcon, 1)), name, auth,
+				s.Stratum, s.Poll, reach.String(), s.LastRx, s.Offset)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(data.Problems) > 0 {
+		fmt.Fprintf(w, "  %s\n", p.Paint(textview.Yellow+textview.Bold, "Problem sources"))
+		for _, ps := range data.Problems {
+			fmt.Fprintf(w, "  %s %s\n", p.Paint(textview.Yellow, "!"), ps.Name+": "+strings.Join(ps.Reasons, "; "))
+		}
+		fmt.Fprintln(w)
+	}
+
+	sys := data.System
+	row("CPU", textview.UsageBar(p, sys.CPUPercent)+fmt.Sprintf(" %5.1f%%", sys.CPUPercent))
+	row("Memory", textview.UsageBar(p, sys.MemPercent)+fmt.Sprintf(" %5.1f%%", sys.MemPercent))
+	row("Disk", sys.DiskUsed+" / "+sys.DiskTotal+" ("+sys.DiskPercent+")")
+	row("Load average", sys.LoadAvg)
+	row("Uptime", sys.Uptime)
+	row("OS / kernel", sys.OS+", "+sys.Kernel)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"landing/textview"
+)
+
+func testDashboardData() PageData {
+	return PageData{
+		NTP: NTPStats{
+			Stratum: "2", RefID: "PTB (ptbtime1.ptb.de)", Offset: 0.25, OffsetDisplay: "+250.00 ms",
+			FreqDisplay: "-12.345 ppm", LeapStatus: "Normal", Synced: true,
+			TotalSources: 2, OnlineSources: 1, NTSCount: 1,
+			Sources: []NTPSource{
+				{StatusIcon: "*", Name: "ptbtime1.ptb.de", Stratum: "1", Poll: "6", NTS: true, Selected: true,
+					ReachBits: []string{"1", "1", "1", "1", "0", "1", "1", "1"}, LastRx: "33", Offset: "+12us"},
+				{StatusIcon: "?", Name: "10.0.0.1", Stratum: "0", Poll: "6",
+					ReachBits: []string{"0", "0", "0", "0", "0", "0", "0", "0"}, LastRx: "-", Offset: "-"},
+			},
+		},
+		System:    SystemStats{Hostname: "ntp", CPUPercent: 95, MemPercent: 40},
+		Problems:  []ProblemSource{{Name: "10.0.0.1", Reasons: []string{"unreachable"}}},
+		UpdatedAt: "2026-01-02 03:04:05 UTC",
+	}
+}
+
+func TestTextDashboardPlain(t *testing.T) {
+	var buf bytes.Buffer
+	writeTextDashboard(&buf, testDashboardData(), 100*time.Millisecond, false)
+	out := buf.String()
+	if strings.Contains(out, "\x1b[") {
+		t.Error("plain text output contains escape codes")
+	}
+	for _, want := range []string{
+		"NTP ntp  2026-01-02 03:04:05 UTC",
+		"synchronised (leap Normal)",
+		"+250.00 ms",
+		"-12.345 ppm",
+		"1 online of 2, 1 NTS",
+		"* ptbtime1.ptb.de NTS   1    6 ||||.|||     33  +12us",
+		"? 10.0.0.1        -     0    6 ........      -  -",
+		"! 10.0.0.1: unreachable",
+		"[###################" + " ]  95.0%",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTextDashboardANSI(t *testing.T) {
+	var buf bytes.Buffer
+	writeTextDashboard(&buf, testDashboardData(), 100*time.Millisecond, true)
+	out := buf.String()
+	for _, want := range []string{
+		textview.Red + "+250.00 ms" + textview.Reset, // beyond the 100 ms limit
+		textview.Green + "|" + textview.Reset + textview.Green + "|",
+		textview.Red + "." + textview.Reset,
+		textview.Red + "?" + textview.Reset,
+		textview.Green + textview.Bold + "*" + textview.Reset,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Kernel time status bits from <linux/timex.h>
+const (
+	staPLL       = 0x0001
+	staPPSFreq   = 0x0002
+	staPPSTime   = 0x0004
+	staFLL       = 0x0008
+	staIns       = 0x0010
+	staDel       = 0x0020
+	staUnsync    = 0x0040
+	staFreqHold  = 0x0080
+	staPPSSignal = 0x0100
+	staPPSJitter = 0x0200
+	staPPSWander = 0x0400
+	staPPSError  = 0x0800
+	staClockErr  = 0x1000
+	staNano      = 0x2000
+	staMode      = 0x4000
+	staClk       = 0x8000
+)
+
+var timexStatusNames = []struct {
+	bit  int
+	name string
+}{
+	{staPLL, "STA_PLL"},
+	{staPPSFreq, "STA_PPSFREQ"},
+	{staPPSTime, "STA_PPSTIME"},
+	{staFLL, "STA_FLL"},
+	{staIns, "STA_INS"},
+	{staDel, "STA_DEL"},
+	{staUnsync, "STA_UNSYNC"},
+	{staFreqHold, "STA_FREQHOLD"},
+	{staPPSSignal, "STA_PPSSIGNAL"},
+	{staPPSJitter, "STA_PPSJITTER"},
+	{staPPSWander, "STA_PPSWANDER"},
+	{staPPSError, "STA_PPSERROR"},
+	{staClockErr, "STA_CLOCKERR"},
+	{staNano, "STA_NANO"},
+	{staMode, "STA_MODE"},
+	{staClk, "STA_CLK"},
+}
+
+// adjtimex return values
+var timexStates = map[int]string{
+	0: "TIME_OK",
+	1: "TIME_INS",
+	2: "TIME_DEL",
+	3: "TIME_OOP",
+	4: "TIME_WAIT",
+	5: "TIME_ERROR",
+}
+
+// timexRaw holds the adjtimex fields we use, in kernel units
+type timexRaw struct {
+	State    int
+	Offset   int64 // ns with STA_NANO, otherwise us
+	Freq     int64 // ppm scaled by 2^16
+	MaxError int64 // us
+	EstError int64 // us
+	Status   int
+	Constant int64
+	TAI      int
+}
+
+// TimexReading is a decoded kernel time status sample
+type TimexReading struct {
+	Time            string   `json:"time"`
+	OffsetSecs      float64  `json:"offsetSecs"`
+	OffsetDisplay   string   `json:"offsetDisplay"`
+	FreqPPM         float64  `json:"freqPPM"`
+	MaxErrorSecs    float64  `json:"maxErrorSecs"`
+	MaxErrorDisplay string   `json:"maxErrorDisplay"`
+	EstErrorSecs    float64  `json:"estErrorSecs"`
+	EstErrorDisplay string   `json:"estErrorDisplay"`
+	Status          int      `json:"status"`
+	StatusFlags     []string `json:"statusFlags"`
+	Unsync          bool     `json:"unsync"`
+	PLL             bool     `json:"pll"`
+	Constant        int64    `json:"constant"`
+	TAI             int      `json:"tai"`
+	State           string   `json:"state"`
+
+	at time.Time
+}
+
+func decodeTimex(raw timexRaw, at time.Time) TimexReading {
+	r := TimexReading{
+		Time:         at.Format("2006-01-02 15:04:05"),
+		FreqPPM:      float64(raw.Freq) / 65536,
+		MaxErrorSecs: float64(raw.MaxError) / 1e6,
+		EstErrorSecs: float64(raw.EstError) / 1e6,
+		Status:       raw.Status,
+		Unsync:       raw.Status&staUnsync != 0,
+		PLL:          raw.Status&staPLL != 0,
+		Constant:     raw.Constant,
+		TAI:          raw.TAI,
+		State:        timexStates[raw.State],
+		at:           at,
+	}
+	if r.State == "" {
+		r.State = fmt.Sprintf("state %d", raw.State)
+	}
+	if raw.Status&staNano != 0 {
+		r.OffsetSecs = float64(raw.Offset) / 1e9
+	} else {
+		r.OffsetSecs = float64(raw.Offset) / 1e6
+	}
+	r.OffsetDisplay = formatOffset(r.OffsetSecs)
+	r.MaxErrorDisplay = formatOffset(r.MaxErrorSecs)
+	r.EstErrorDisplay = formatOffset(r.EstErrorSecs)
+	for _, s := range timexStatusNames {
+		if raw.Status&s.bit != 0 {
+			r.StatusFlags = append(r.StatusFlags, s.name)
+		}
+	}
+	return r
+}
+
+// timexSampler reads the kernel clock state directly on a fixed interval
+// and keeps a ring buffer of recent readings, so the page has live kernel
+// values and a 1h history even when node_exporter/Prometheus are down.
+type timexSampler struct {
+	interval time.Duration
+	read     func() (timexRaw, error)
+	now      func() time.Time
+
+	mu   sync.RWMutex
+	ring []TimexReading
+	next int
+	full bool
+	err  error
+}
+
+func newTimexSampler(interval, window time.Duration) *timexSampler {
+	size := int(window / interval)
+	if size < 1 {
+		size = 1
+	}
+	return &timexSampler{
+		interval: interval,
+		read:     readTimex,
+		now:      time.Now,
+		ring:     make([]TimexReading, size),
+	}
+}
+
+// Sample takes one reading and appends it to the ring
+func (s *timexSampler) Sample() {
+	raw, err := s.read()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	if err != nil {
+		return
+	}
+	s.ring[s.next] = decodeTimex(raw, s.now())
+	s.next = (s.next + 1) % len(s.ring)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Run samples at the configured interval until ctx is cancelled
+func (s *timexSampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sample()
+		}
+	}
+}
+
+// Latest returns the most recent reading, or false if there is none
+func (s *timexSampler) Latest() (TimexReading, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.full && s.next == 0 {
+		return TimexReading{}, false
+	}
+	return s.ring[(s.next-1+len(s.ring))%len(s.ring)], true
+}
+
+// Err returns the error from the last sampling attempt
+func (s *timexSampler) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// History returns the buffered readings taken at or after since, oldest first
+func (s *timexSampler) History(since time.Time) []TimexReading {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []TimexReading
+	start, n := 0, s.next
+	if s.full {
+		start, n = s.next, len(s.ring)
+	}
+	for i := 0; i < n; i++ {
+		r := s.ring[(start+i)%len(s.ring)]
+		if !r.at.Before(since) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// samples returns the readings taken at or after since as chart series,
+// with the same units as the node_timex Prometheus queries
+func (s *timexSampler) samples(since time.Time) chartSeries {
+	series := chartSeries{}
+	for _, r := range s.History(since) {
+		series.add("offset", r.at, r.OffsetSecs*1e6)
+		series.add("freq", r.at, r.FreqPPM)
+		series.add("maxErr", r.at, r.MaxErrorSecs*1e6)
+		series.add("estErr", r.at, r.EstErrorSecs*1e6)
+		series.add("pll", r.at, float64(r.Constant))
+	}
+	return series
+}
+
+// chartSet converts buffered readings into chart series
+func (s *timexSampler) chartSet(cr chartRange, now time.Time) ChartDataSet {
+	return s.samples(now.Add(-cr.Duration)).bucket(cr)
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// readTimex queries the kernel clock with a read-only adjtimex call
+func readTimex() (timexRaw, error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return timexRaw{}, err
+	}
+	return timexRaw{
+		State:    state,
+		Offset:   int64(tx.Offset),
+		Freq:     int64(tx.Freq),
+		MaxError: int64(tx.Maxerror),
+		EstError: int64(tx.Esterror),
+		Status:   int(tx.Status),
+		Constant: int64(tx.Constant),
+		TAI:      int(tx.Tai),
+	}, nil
+}
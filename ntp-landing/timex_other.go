@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func readTimex() (timexRaw, error) {
+	return timexRaw{}, errors.New("adjtimex is only available on Linux")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeTimex(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := decodeTimex(timexRaw{
+		State:    0,
+		Offset:   -1500,
+		Freq:     -3 * 65536,
+		MaxError: 12000,
+		EstError: 4,
+		Status:   staPLL | staNano,
+		Constant: 7,
+		TAI:      37,
+	}, at)
+	if r.OffsetSecs != -1.5e-6 || r.OffsetDisplay != "-1.5 us" {
+		t.Errorf("nanosecond offset decoded as %v (%s)", r.OffsetSecs, r.OffsetDisplay)
+	}
+	if r.FreqPPM != -3 || r.MaxErrorSecs != 0.012 || r.EstErrorSecs != 4e-6 {
+		t.Errorf("unexpected freq/error: %+v", r)
+	}
+	if !r.PLL || r.Unsync || r.State != "TIME_OK" || r.TAI != 37 || r.Constant != 7 {
+		t.Errorf("unexpected status decoding: %+v", r)
+	}
+	if len(r.StatusFlags) != 2 || r.StatusFlags[0] != "STA_PLL" || r.StatusFlags[1] != "STA_NANO" {
+		t.Errorf("unexpected flags: %v", r.StatusFlags)
+	}
+
+	us := decodeTimex(timexRaw{Offset: -1500, Status: staUnsync, State: 5}, at)
+	if us.OffsetSecs != -1.5e-3 || !us.Unsync || us.State != "TIME_ERROR" {
+		t.Errorf("microsecond offset/unsync decoded wrong: %+v", us)
+	}
+}
+
+func TestTimexSamplerRing(t *testing.T) {
+	s := newTimexSampler(10*time.Second, 40*time.Second)
+	if _, ok := s.Latest(); ok {
+		t.Fatal("empty sampler should have no latest reading")
+	}
+
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	offset := int64(0)
+	s.now = func() time.Time { return clock }
+	s.read = func() (timexRaw, error) { return timexRaw{Offset: offset, Status: staNano}, nil }
+	for i := 0; i < 6; i++ {
+		offset = int64(i) * 1000
+		s.Sample()
+		clock = clock.Add(10 * time.Second)
+	}
+
+	hist := s.History(time.Time{})
+	if len(hist) != 4 {
+		t.Fatalf("ring of 4 should hold 4 readings, got %d", len(hist))
+	}
+	if hist[0].OffsetSecs != 2e-6 || hist[3].OffsetSecs != 5e-6 {
+		t.Errorf("ring not ordered oldest first: %v .. %v", hist[0].OffsetSecs, hist[3].OffsetSecs)
+	}
+	if latest, _ := s.Latest(); latest.OffsetSecs != 5e-6 {
+		t.Errorf("latest = %v, want 5e-6", latest.OffsetSecs)
+	}
+
+	ds := s.chartSet(chartRange{Duration: time.Hour, Step: 10 * time.Second, TimeFmt: "15:04:05"}, clock)
+	if len(ds.Offset) != 4 || len(ds.PLL) != 4 || ds.Offset[3].Value != 5 {
+		t.Errorf("unexpected chart set from ring: %+v", ds.Offset)
+	}
+
+	s.read = func() (timexRaw, error) { return timexRaw{}, errors.New("boom") }
+	s.Sample()
+	if s.Err() == nil {
+		t.Error("expected sampling error to be recorded")
+	}
+	if len(s.History(time.Time{})) != 4 {
+		t.Error("failed sample should not touch the ring")
+	}
+}
+
+func TestOffsetFormattingAgrees(t *testing.T) {
+	for in, want := range map[string]string{
+		"0.000012345 seconds fast": "12.3 us fast",
+		"-0.002500000 seconds":     "-2.50 ms",
+		"0.000000042 seconds":      "42.0 ns",
+		"1.500000000 seconds":      "1.5 s",
+		"90.000000000 seconds":     "1.5 min",
+	} {
+		if got := formatSecondsStr(in); got != want {
+			t.Errorf("formatSecondsStr(%q) = %q, want %q", in, got, want)
+		}
+	}
+	// the tracking strings and the parsed offset render the same way
+	if a, b := formatSecondsStr("0.000012345 seconds"), formatOffset(12.345e-6); a != b {
+		t.Errorf("tracking %q, offset %q", a, b)
+	}
+}